@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"os"
 
+	"github.com/Mixturka/vm-hub/internal/app"
 	"github.com/Mixturka/vm-hub/internal/app/config"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/server"
 )
@@ -15,7 +17,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	r := server.SetupRouter()
+	application, err := app.NewApp(context.Background(), config)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	defer application.Close()
+
+	r := application.Router()
 	server := server.NewServer(&r)
 	server.Start(config)
 }
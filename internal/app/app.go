@@ -0,0 +1,351 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/attempts"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/breach"
+	oauthconfig "github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/routes"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/server"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/pkg/security"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// App is the composition root: it owns external connections and wires
+// repositories, services, controllers and routes together.
+type App struct {
+	config *config.Config
+	db     *pgxpool.Pool
+	redis  *redis.Client
+	router chi.Router
+	// Background jobs started by the app run until stop is called.
+	jobs context.Context
+	stop context.CancelFunc
+}
+
+func NewApp(ctx context.Context, cfg *config.Config) (*App, error) {
+	db, err := pgxpool.Connect(ctx, cfg.PostgresUri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	// Redis holds sessions, login attempt counters and rate limits, the latter
+	// fall back to memory when sessions are kept elsewhere.
+	var redisClient *redis.Client
+	if cfg.SessionOptions.Storage == "redis" {
+		redisOptions, err := redis.ParseURL(cfg.RedisUri)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("invalid REDIS_URI value: %w", err)
+		}
+		redisClient = redis.NewClient(redisOptions)
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			db.Close()
+			redisClient.Close()
+			return nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+	}
+
+	app := &App{
+		config: cfg,
+		db:     db,
+		redis:  redisClient,
+	}
+	app.jobs, app.stop = context.WithCancel(context.Background())
+	if app.router, err = app.setupRouter(ctx); err != nil {
+		app.Close()
+		return nil, err
+	}
+
+	return app, nil
+}
+
+func (a *App) setupRouter(ctx context.Context) (chi.Router, error) {
+	userRepository := postgres.NewPostgresUserRepository(a.db)
+	accountRepository := postgres.NewPostgresAccountRepository(a.db)
+	tokenRepository := postgres.NewPostgresTokenRepository(a.db)
+	recoveryCodeRepository := postgres.NewPostgresRecoveryCodeRepository(a.db)
+	credentialRepository := postgres.NewPostgresCredentialRepository(a.db)
+	mailer := a.newMailer()
+	sessionStorage := a.newSessionStorage()
+	sessionManager := session.NewSessionManager(sessionStorage, a.config.SessionOptions)
+
+	userService := services.NewUserService(userRepository, a.newPasswordHasher())
+	tokenService := services.NewTokenService(tokenRepository, &a.config.TokenOptions)
+	a.startTokenPurging(tokenService)
+	verificationService := services.NewVerificationService(userService, tokenService, mailer, a.config.BaseURL)
+	breachedPasswords, err := a.newBreachedPasswords()
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicyService := services.NewPasswordPolicyService(breachedPasswords, &a.config.AuthOptions.PasswordPolicy)
+	passwordResetService := services.NewPasswordResetService(userService, tokenService, passwordPolicyService,
+		mailer, sessionManager, a.config.BaseURL)
+	loginAttemptService := services.NewLoginAttemptService(a.newAttemptCounter(), mailer, &a.config.AuthOptions.LoginThrottle)
+	twoFactorService := services.NewTwoFactorService(userService, tokenService, mailer, loginAttemptService,
+		&a.config.AuthOptions)
+	totpService := services.NewTotpService(userService, recoveryCodeRepository, loginAttemptService,
+		&a.config.AuthOptions)
+	authService := services.NewAuthService(userService, sessionManager, verificationService,
+		passwordResetService, twoFactorService, totpService, loginAttemptService, passwordPolicyService,
+		&a.config.AuthOptions)
+	oauthServiceOptions, err := a.oauthServiceOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	providerService := services.NewProviderService(oauthServiceOptions)
+	oauthService := services.NewOAuthService(userService, accountRepository, providerService, authService, sessionManager)
+	passkeyVerifier, err := auth.NewPasskeyVerifier(&a.config.WebAuthn)
+	if err != nil {
+		return nil, err
+	}
+	passkeyService := services.NewPasskeyService(userService, credentialRepository, passkeyVerifier, authService, sessionManager)
+	sessionService := services.NewSessionService(userService, sessionManager)
+
+	authController := controllers.NewAuthController(authService)
+	oauthController := controllers.NewOAuthController(oauthService)
+	userController := controllers.NewUserController(userService, twoFactorService)
+	totpController := controllers.NewTotpController(totpService)
+	passkeyController := controllers.NewPasskeyController(passkeyService)
+	sessionController := controllers.NewSessionController(sessionService)
+
+	rateLimitStore := a.newRateLimitStore()
+	mw := routes.Middlewares{
+		Auth: func(next http.Handler) http.Handler {
+			return middleware.AuthMiddleware(userService, sessionManager, next)
+		},
+		Recaptcha: func(next http.Handler) http.Handler {
+			return middleware.RecaptchaMiddleware(&a.config.GRecapOptions, next)
+		},
+		Admin: middleware.AdminMiddleware,
+		RateLimit: func(policy ratelimit.Policy) func(http.Handler) http.Handler {
+			return func(next http.Handler) http.Handler {
+				return middleware.RateLimitMiddleware(rateLimitStore, policy, next)
+			}
+		},
+	}
+	if a.config.GRecapOptions.SecretKey == "" {
+		slog.Warn("GOOGLE_RECAPTCHA_SECRET_KEY is not set, reCAPTCHA verification is disabled")
+		mw.Recaptcha = func(next http.Handler) http.Handler { return next }
+	}
+	if !a.config.RateLimit.Enabled {
+		slog.Warn("RATE_LIMIT_ENABLED is false, requests aren't rate limited")
+		mw.RateLimit = func(ratelimit.Policy) func(http.Handler) http.Handler {
+			return func(next http.Handler) http.Handler { return next }
+		}
+	}
+
+	csrf := func(next http.Handler) http.Handler {
+		return middleware.CSRFMiddleware(sessionManager, a.config.SessionOptions, next)
+	}
+	// Request ID goes first, so every error response and log line can carry it.
+	// Session is loaded once per request, before CSRF and auth checks need it.
+	r := server.SetupRouter(chimiddleware.RequestID, sessionManager.Middleware, csrf)
+	routes.RegisterAuthRoutes(r, authController, oauthController, passkeyController, mw)
+	routes.RegisterUserRoutes(r, userController, totpController, passkeyController, sessionController, mw)
+	routes.RegisterAdminRoutes(r, sessionController, mw)
+
+	return r, nil
+}
+
+// Picks session storage configured with SESSION_STORAGE.
+func (a *App) newSessionStorage() interfaces.SessionStorage {
+	options := a.config.SessionOptions
+	switch options.Storage {
+	case "cookie":
+		return session.NewCookieStore(options)
+	case "memory":
+		return session.NewMemoryStore(a.jobs, time.Duration(options.CleanupInterval)*time.Second)
+	case "postgres":
+		store := session.NewPostgresStore(a.db)
+		a.startSessionPurging(store)
+		return store
+	default:
+		return session.NewRedisStore(a.redis)
+	}
+}
+
+// Counts failed logins in Redis when sessions are kept there, in memory otherwise.
+func (a *App) newAttemptCounter() interfaces.AttemptCounter {
+	if a.redis != nil {
+		return attempts.NewRedisCounter(a.redis)
+	}
+	return attempts.NewMemoryCounter(a.jobs, time.Minute)
+}
+
+// Keeps rate limits in Redis when sessions are kept there, in memory otherwise.
+func (a *App) newRateLimitStore() ratelimit.Store {
+	if a.redis != nil {
+		return ratelimit.NewRedisStore(a.redis)
+	}
+	return ratelimit.NewMemoryStore(a.jobs, time.Minute)
+}
+
+// Picks algorithm new passwords are hashed with by PASSWORD_HASH_ALGORITHM.
+func (a *App) newPasswordHasher() security.PasswordHasher {
+	options := a.config.AuthOptions.PasswordHash
+	if options.Algorithm == "bcrypt" {
+		return security.NewBcryptHasher(options.BcryptCost)
+	}
+	return security.NewArgon2idHasher(security.Argon2idParams{
+		Memory:      options.Argon2Memory,
+		Iterations:  options.Argon2Iterations,
+		Parallelism: options.Argon2Parallelism,
+	})
+}
+
+// Looks breached password hashes up in BREACHED_PASSWORDS_FILE, which has to
+// be sorted by hash. Breached passwords aren't checked if it isn't set.
+func (a *App) newBreachedPasswords() (interfaces.BreachedPasswords, error) {
+	path := a.config.AuthOptions.PasswordPolicy.BreachedPasswordsFile
+	if path == "" {
+		slog.Warn("BREACHED_PASSWORDS_FILE is not set, breached passwords are accepted")
+		return nil, nil
+	}
+	return breach.NewFileSource(path)
+}
+
+// Picks mail delivery configured with MAIL_DRIVER.
+func (a *App) newMailer() interfaces.Mailer {
+	options := a.config.MailOptions
+	switch options.Driver {
+	case "smtp":
+		return mail.NewSMTPMailer(options.From, options.SMTP)
+	case "file":
+		return mail.NewFileMailer(options.From, options.FileDir)
+	default:
+		return mail.NewLogMailer(options.From)
+	}
+}
+
+// Builds OAuth providers for which client credentials are configured.
+func (a *App) oauthServiceOptions(ctx context.Context) (*auth.OAuthServiceOptions, error) {
+	options := &auth.OAuthServiceOptions{
+		BaseURL:  a.config.BaseURL,
+		Services: []auth.OAuthProvider{},
+	}
+
+	google := a.config.OAuthOptions.Google
+	if google.ClientID != "" {
+		provider := auth.NewGoogleProvider(oauthconfig.OAuthProviderOptions{
+			Scopes:       google.Scopes,
+			CliendID:     google.ClientID,
+			ClientSecret: google.ClientSecret,
+		})
+		options.Services = append(options.Services, provider)
+	}
+
+	yandex := a.config.OAuthOptions.Yandex
+	if yandex.ClientID != "" {
+		provider := auth.NewYandexProvider(oauthconfig.OAuthProviderOptions{
+			Scopes:       yandex.Scopes,
+			CliendID:     yandex.ClientID,
+			ClientSecret: yandex.ClientSecret,
+		})
+		options.Services = append(options.Services, provider)
+	}
+
+	oidc := a.config.OAuthOptions.OIDC
+	if oidc.IssuerURL != "" {
+		provider, err := auth.NewOIDCProvider(ctx, oauthconfig.OIDCProviderOptions{
+			Name:         oidc.Name,
+			IssuerURL:    oidc.IssuerURL,
+			Scopes:       oidc.Scopes,
+			ClientID:     oidc.ClientID,
+			ClientSecret: oidc.ClientSecret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		options.Services = append(options.Services, provider)
+	}
+
+	return options, nil
+}
+
+func (a *App) Router() chi.Router {
+	return a.router
+}
+
+// Periodically deletes expired tokens so abandoned ones don't pile up.
+func (a *App) startTokenPurging(tokenService *services.TokenService) {
+	if a.config.TokenOptions.PurgeInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(a.config.TokenOptions.PurgeInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.jobs.Done():
+				return
+			case <-ticker.C:
+				purged, err := tokenService.PurgeExpired(a.jobs)
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to purge expired tokens %s", err.Error()))
+					continue
+				}
+				slog.Debug(fmt.Sprintf("Purged %d expired tokens", purged))
+			}
+		}
+	}()
+}
+
+// Periodically deletes expired sessions from postgres storage.
+func (a *App) startSessionPurging(store *session.PostgresStore) {
+	if a.config.SessionOptions.CleanupInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(a.config.SessionOptions.CleanupInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.jobs.Done():
+				return
+			case <-ticker.C:
+				purged, err := store.PurgeExpired(a.jobs, time.Now())
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to purge expired sessions %s", err.Error()))
+					continue
+				}
+				slog.Debug(fmt.Sprintf("Purged %d expired sessions", purged))
+			}
+		}
+	}()
+}
+
+// Releases database and redis connections.
+func (a *App) Close() {
+	a.stop()
+	a.db.Close()
+	if a.redis == nil {
+		return
+	}
+	if err := a.redis.Close(); err != nil {
+		slog.Error(fmt.Sprintf("Failed to close redis client %s", err.Error()))
+	}
+}
@@ -1,11 +1,17 @@
 package controllers
 
 import (
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
 	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/web/templates"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
 type AuthController struct {
@@ -20,27 +26,26 @@ func NewAuthController(authService *services.AuthService) *AuthController {
 
 func (ac *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 	var registerDto dtos.RegisterDto
-
-	if err := json.NewDecoder(r.Body).Decode(&registerDto); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
-	}
-
-	if err := ac.authService.ValidateDto(registerDto); err != nil {
-		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+	if !decodeAndValidate(w, r, &registerDto, ac.authService.ValidateDto) {
 		return
 	}
 
-	err := ac.authService.Register(registerDto, w)
+	err := ac.authService.Register(registerDto, w, r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if writeFieldErrorsOf(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrEmailTaken) {
+			respond.Error(w, r, http.StatusConflict, respond.CodeConflict,
+				"User with this email already exists. Please use another email or login to the existing account")
+			return
+		}
+		respond.InternalError(w, r, "Failed to register user", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "User registered successfully",
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "User registered successfully. Please check your email to verify it",
 		// "user": map[string]interface{}{
 		// 	"id":    user.ID,
 		// 	"name":  user.Name,
@@ -51,38 +56,262 @@ func (ac *AuthController) Register(w http.ResponseWriter, r *http.Request) {
 
 func (ac *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 	var loginDto dtos.LoginDto
+	if !decodeAndValidate(w, r, &loginDto, ac.authService.ValidateDto) {
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&loginDto); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if err := ac.authService.Login(loginDto, w, r); err != nil {
+		writeLoginError(w, r, err)
 		return
 	}
-	if err := ac.authService.ValidateDto(loginDto); err != nil {
-		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Login successful",
+	})
+}
+
+// Finishes login started without password, e.g. with OAuth, with second factor.
+func (ac *AuthController) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	var completeDto dtos.CompleteLoginDto
+	if !decodeAndValidate(w, r, &completeDto, ac.authService.ValidateDto) {
 		return
 	}
 
-	err := ac.authService.Login(loginDto, w)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	if err := ac.authService.CompleteLogin(completeDto, w, r); err != nil {
+		if errors.Is(err, services.ErrNoPendingLogin) {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, err.Error())
+			return
+		}
+		writeLoginError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successfull",
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Login successful",
 	})
 }
 
+// Responds to failed login, including the one waiting for second factor.
+func writeLoginError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorRequired), errors.Is(err, services.ErrTotpRequired):
+		method := "email"
+		if errors.Is(err, services.ErrTotpRequired) {
+			method = "totp"
+		}
+		respond.JSON(w, http.StatusAccepted, map[string]interface{}{
+			"message":             err.Error(),
+			"two_factor_required": true,
+			"two_factor_method":   method,
+		})
+	case errors.Is(err, services.ErrInvalidCredentials):
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidCredentials, "Invalid email or password")
+	case errors.Is(err, services.ErrLoginLocked):
+		writeLockedError(w, r, err)
+	case errors.Is(err, services.ErrEmailNotVerified):
+		respond.Error(w, r, http.StatusForbidden, respond.CodeEmailNotVerified,
+			"Email is not verified. Please follow the link we've sent to your email")
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrInvalidTotpCode):
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeInvalidToken, "Invalid two-factor code")
+	case errors.Is(err, services.ErrTokenExpired):
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeTokenExpired,
+			"Two-factor code has expired. Please login again to get a new one")
+	case errors.Is(err, services.ErrTooManyAttempts):
+		respond.Error(w, r, http.StatusTooManyRequests, respond.CodeTooManyRequests,
+			"Too many invalid two-factor codes. Please login again to get a new one")
+	default:
+		respond.InternalError(w, r, "Failed to login", err)
+	}
+}
+
+// Responds to attempt refused while login of the account is locked.
+func writeLockedError(w http.ResponseWriter, r *http.Request, err error) {
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())))
+	}
+	respond.Error(w, r, http.StatusTooManyRequests, respond.CodeTooManyRequests,
+		"Too many failed login attempts. Please try again later")
+}
+
 func (ac *AuthController) Logout(w http.ResponseWriter, r *http.Request) {
 	err := ac.authService.Logout(w, r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeBadRequest,
+			"Unable to stop session, it may have been stopped already")
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Logout successful",
+	})
+}
+
+func (ac *AuthController) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respond.FieldErrors(w, r, http.StatusBadRequest, respond.CodeValidationFailed, "Missing verification token",
+			[]dtos.FieldError{{Field: "token", Code: "required", Message: "token is a required field"}})
+		return
+	}
+
+	err := ac.authService.VerifyEmail(token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrTokenExpired) {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidToken, "Verification link is invalid or has expired")
+			return
+		}
+		respond.InternalError(w, r, "Failed to verify email", err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Email verified successfully",
+	})
+}
+
+func (ac *AuthController) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var resendDto dtos.ResendVerificationDto
+	if !decodeAndValidate(w, r, &resendDto, ac.authService.ValidateDto) {
+		return
+	}
+
+	if err := ac.authService.ResendVerification(resendDto); err != nil {
+		respond.InternalError(w, r, "Failed to resend verification link", err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "If the email belongs to an unverified account, a new verification link has been sent",
+	})
+}
+
+func (ac *AuthController) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotDto dtos.ForgotPasswordDto
+	if !decodeAndValidate(w, r, &forgotDto, ac.authService.ValidateDto) {
+		return
+	}
+
+	// Response doesn't depend on the outcome, so it can't be used to find out
+	// whether the email is registered.
+	if err := ac.authService.ForgotPassword(forgotDto); err != nil {
+		slog.Error(err.Error())
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// Renders page the password reset link points to. Token is checked only once
+// the form is sent.
+func (ac *AuthController) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	csrfToken := middleware.CSRFTokenFromContext(r.Context())
+	renderPage(w, r, http.StatusOK, templates.PasswordResetPage(csrfToken, r.URL.Query().Get("token"), nil, false))
+}
+
+// Accepts JSON of API clients and form of the reset page, which is answered
+// with the page.
+func (ac *AuthController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if isFormRequest(r) {
+		ac.resetPasswordForm(w, r)
+		return
+	}
+
+	var resetDto dtos.ResetPasswordDto
+	if !decodeAndValidate(w, r, &resetDto, ac.authService.ValidateDto) {
+		return
+	}
+
+	err := ac.authService.ResetPassword(resetDto)
+	if err != nil {
+		if writeFieldErrorsOf(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrTokenExpired) {
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidToken, "Password reset link is invalid or has expired")
+			return
+		}
+		respond.InternalError(w, r, "Failed to reset password", err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Password has been reset. Please login with the new password",
+	})
+}
+
+func (ac *AuthController) resetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	resetDto := dtos.ResetPasswordDto{
+		Token:          r.PostFormValue("token"),
+		Password:       r.PostFormValue("password"),
+		PasswordRepeat: r.PostFormValue("password_repeat"),
+	}
+
+	err := ac.authService.ValidateDto(&resetDto)
+	if err == nil {
+		err = ac.authService.ResetPassword(resetDto)
+	}
+
+	csrfToken := middleware.CSRFTokenFromContext(r.Context())
+	if err == nil {
+		renderPage(w, r, http.StatusOK, templates.PasswordResetPage(csrfToken, "", nil, true))
+		return
+	}
+
+	var (
+		validationErr *services.ValidationError
+		policyErr     *services.PasswordPolicyError
+		messages      []string
+		status        = http.StatusBadRequest
+		token         = resetDto.Token
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		messages = fieldErrorMessages(validationErr.Errors)
+	case errors.As(err, &policyErr):
+		for _, message := range fieldErrorMessages(policyErr.Errors) {
+			messages = append(messages, "Password "+message)
+		}
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrTokenExpired):
+		token = ""
+	default:
+		slog.Error("Failed to reset password", "error", err, "request_id", chimiddleware.GetReqID(r.Context()))
+		messages = []string{"Failed to reset password. Please try again later"}
+		status = http.StatusInternalServerError
+	}
+	renderPage(w, r, status, templates.PasswordResetPage(csrfToken, token, messages, false))
+}
+
+func (ac *AuthController) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var changeDto dtos.ChangePasswordDto
+	if !decodeAndValidate(w, r, &changeDto, ac.authService.ValidateDto) {
+		return
+	}
+
+	if err := ac.authService.ChangePassword(user, changeDto, w, r); err != nil {
+		if writeFieldErrorsOf(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrWrongPassword) {
+			respond.Error(w, r, http.StatusForbidden, respond.CodeForbidden, "Current password is wrong")
+			return
+		}
+		if errors.Is(err, services.ErrLoginLocked) {
+			writeLockedError(w, r, err)
+			return
+		}
+		respond.InternalError(w, r, "Failed to change password", err)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Logout successfull",
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Password has been changed. Other devices have been logged out",
 	})
 }
@@ -2,24 +2,50 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"html"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
 	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
 	"github.com/Mixturka/vm-hub/internal/app/application/services"
 	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/attempts"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/routes"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
 	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/internal/pkg/test/mock"
 	"github.com/Mixturka/vm-hub/pkg/putils"
+	"github.com/Mixturka/vm-hub/pkg/security"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
+var tokenOptions = &config.TokenOptions{
+	VerificationTTL:  86400,
+	TwoFactorTTL:     300,
+	PasswordResetTTL: 3600,
+}
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
 var (
 	migrationsPath         string
 	absoluteMigrationsPath string
@@ -53,14 +79,17 @@ func TestRegister_Success(t *testing.T) {
 		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
 		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
 		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
-		userService := services.NewUserService(repo)
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
 
 		util := test.NewRedisTestUtil(t)
 		client := util.Client()
 		rs := session.NewRedisStore(client)
 
-		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{})
-		authService := services.NewAuthService(userService, sessionManager)
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionSecret: testSessionSecret})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService,
+			mail.NewLogMailer("no-reply@localhost"), "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil, nil, nil, &config.AuthOptions{})
 
 		authController := controllers.NewAuthController(authService)
 		http.HandleFunc("/register", authController.Register)
@@ -98,14 +127,17 @@ func TestLogin_Success(t *testing.T) {
 		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
 		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
 		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
-		userService := services.NewUserService(repo)
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
 
 		util := test.NewRedisTestUtil(t)
 		client := util.Client()
 		rs := session.NewRedisStore(client)
 
-		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{})
-		authService := services.NewAuthService(userService, sessionManager)
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionSecret: testSessionSecret})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService,
+			mail.NewLogMailer("no-reply@localhost"), "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil, nil, nil, &config.AuthOptions{})
 
 		authController := controllers.NewAuthController(authService)
 		http.HandleFunc("/login", authController.Login)
@@ -157,14 +189,17 @@ func TestLogout_Success(t *testing.T) {
 		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
 		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
 		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
-		userService := services.NewUserService(repo)
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
 
 		util := test.NewRedisTestUtil(t)
 		client := util.Client()
 		rs := session.NewRedisStore(client)
 
-		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{})
-		authService := services.NewAuthService(userService, sessionManager)
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionSecret: testSessionSecret})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService,
+			mail.NewLogMailer("no-reply@localhost"), "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil, nil, nil, &config.AuthOptions{})
 
 		authController := controllers.NewAuthController(authService)
 		http.HandleFunc("/logout", authController.Logout)
@@ -211,3 +246,679 @@ func TestLogout_Success(t *testing.T) {
 		assert.Contains(t, logoutRec.Body.String(), "Logout successful", "Response body does not contain expected success message")
 	})
 }
+
+var (
+	verificationLinkRe  = regexp.MustCompile(`/auth/verify\?token=(\S+)`)
+	passwordResetLinkRe = regexp.MustCompile(`/password/reset\?token=(\S+)`)
+)
+
+func TestVerifyEmail_Success(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Test email verification flow", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
+
+		util := test.NewRedisTestUtil(t)
+		client := util.Client()
+		rs := session.NewRedisStore(client)
+
+		var sentMail *dtos.MailDto
+		mailer := mock.NewMockMailer(ctrl)
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+			sentMail = mail
+			return nil
+		})
+
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionSecret: testSessionSecret})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService, mailer, "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil, nil, nil,
+			&config.AuthOptions{RequireEmailVerification: true})
+		authController := controllers.NewAuthController(authService)
+
+		user := test.NewRandomUser()
+		registerPayload, err := json.Marshal(dtos.RegisterDto{
+			Name:           user.Name,
+			Email:          user.Email,
+			Password:       user.Password,
+			PasswordRepeat: user.Password,
+		})
+		require.NoError(t, err, "Failed to marshal the register DTO")
+
+		registerRec := httptest.NewRecorder()
+		authController.Register(registerRec, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(registerPayload)))
+		assert.Equal(t, http.StatusOK, registerRec.Code, "Expected HTTP status 200 OK")
+		assert.Empty(t, registerRec.Result().Cookies(), "Session shouldn't start before email is verified")
+
+		require.NotNil(t, sentMail, "Verification email should be sent")
+		assert.Equal(t, []string{user.Email}, sentMail.To)
+		match := verificationLinkRe.FindStringSubmatch(sentMail.TextBody)
+		require.Len(t, match, 2, "Verification email should contain verification link")
+		token, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+
+		loginPayload, err := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password})
+		require.NoError(t, err, "Failed to marshal the login DTO")
+
+		loginRec := httptest.NewRecorder()
+		authController.Login(loginRec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(loginPayload)))
+		assert.Equal(t, http.StatusForbidden, loginRec.Code, "Login of unverified user should be refused")
+
+		verifyRec := httptest.NewRecorder()
+		authController.VerifyEmail(verifyRec, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+		assert.Equal(t, http.StatusOK, verifyRec.Code, "Expected HTTP status 200 OK")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		verifiedUser, err := repo.GetByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.True(t, verifiedUser.IsEmailVerified)
+
+		verifyRec = httptest.NewRecorder()
+		authController.VerifyEmail(verifyRec, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+		assert.Equal(t, http.StatusBadRequest, verifyRec.Code, "Token should be deleted after use")
+
+		loginRec = httptest.NewRecorder()
+		authController.Login(loginRec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(loginPayload)))
+		assert.Equal(t, http.StatusOK, loginRec.Code, "Expected HTTP status 200 OK")
+	})
+}
+
+func TestResetPassword_Success(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Test password reset flow", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
+
+		util := test.NewRedisTestUtil(t)
+		client := util.Client()
+		rs := session.NewRedisStore(client)
+
+		var sentMail *dtos.MailDto
+		mailer := mock.NewMockMailer(ctrl)
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+			sentMail = mail
+			return nil
+		}).AnyTimes()
+
+		sessionOptions := &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600}
+		sessionManager := session.NewSessionManager(rs, sessionOptions)
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService, mailer, "http://localhost:8080")
+		passwordResetService := services.NewPasswordResetService(userService, tokenService, nil, mailer,
+			sessionManager, "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService,
+			passwordResetService, nil, nil, nil, nil, &config.AuthOptions{})
+		authController := controllers.NewAuthController(authService)
+
+		user := test.NewRandomUser()
+		registerPayload, err := json.Marshal(dtos.RegisterDto{
+			Name:           user.Name,
+			Email:          user.Email,
+			Password:       user.Password,
+			PasswordRepeat: user.Password,
+		})
+		require.NoError(t, err, "Failed to marshal the register DTO")
+
+		registerRec := httptest.NewRecorder()
+		authController.Register(registerRec, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(registerPayload)))
+		require.Equal(t, http.StatusOK, registerRec.Code, "Expected HTTP status 200 OK")
+		sessionCookie := registerRec.Result().Cookies()[0]
+
+		forgotPayload, err := json.Marshal(dtos.ForgotPasswordDto{Email: "unknown" + user.Email})
+		require.NoError(t, err, "Failed to marshal the forgot password DTO")
+
+		sentMail = nil
+		forgotRec := httptest.NewRecorder()
+		authController.ForgotPassword(forgotRec, httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(forgotPayload)))
+		assert.Equal(t, http.StatusOK, forgotRec.Code, "Unknown email shouldn't be revealed")
+		assert.Nil(t, sentMail, "Nothing should be sent to unknown email")
+
+		forgotPayload, err = json.Marshal(dtos.ForgotPasswordDto{Email: user.Email})
+		require.NoError(t, err, "Failed to marshal the forgot password DTO")
+
+		forgotRec = httptest.NewRecorder()
+		authController.ForgotPassword(forgotRec, httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(forgotPayload)))
+		assert.Equal(t, http.StatusOK, forgotRec.Code, "Expected HTTP status 200 OK")
+
+		require.NotNil(t, sentMail, "Password reset email should be sent")
+		match := passwordResetLinkRe.FindStringSubmatch(sentMail.TextBody)
+		require.Len(t, match, 2, "Password reset email should contain reset link")
+		token, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+
+		newPassword := test.NewRandomUser().Password
+		resetPayload, err := json.Marshal(dtos.ResetPasswordDto{
+			Token:          token,
+			Password:       newPassword,
+			PasswordRepeat: newPassword,
+		})
+		require.NoError(t, err, "Failed to marshal the reset password DTO")
+
+		resetRec := httptest.NewRecorder()
+		authController.ResetPassword(resetRec, httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(resetPayload)))
+		assert.Equal(t, http.StatusOK, resetRec.Code, "Expected HTTP status 200 OK")
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(sessionCookie)
+		sess, err := sessionManager.GetSession(httptest.NewRecorder(), r)
+		require.NoError(t, err)
+		assert.Nil(t, sess, "Existing sessions should be destroyed")
+
+		resetRec = httptest.NewRecorder()
+		authController.ResetPassword(resetRec, httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(resetPayload)))
+		assert.Equal(t, http.StatusBadRequest, resetRec.Code, "Token should be single-use")
+
+		loginPayload, err := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password})
+		require.NoError(t, err, "Failed to marshal the login DTO")
+
+		loginRec := httptest.NewRecorder()
+		authController.Login(loginRec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(loginPayload)))
+		assert.Equal(t, http.StatusUnauthorized, loginRec.Code, "Old password shouldn't work")
+
+		loginPayload, err = json.Marshal(dtos.LoginDto{Email: user.Email, Password: newPassword})
+		require.NoError(t, err, "Failed to marshal the login DTO")
+
+		loginRec = httptest.NewRecorder()
+		authController.Login(loginRec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(loginPayload)))
+		assert.Equal(t, http.StatusOK, loginRec.Code, "Expected HTTP status 200 OK")
+	})
+}
+
+func TestResetPassword_FollowsLink(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	var sentMail *dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMail = mail
+		return nil
+	}).AnyTimes()
+
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+	passwordResetService := services.NewPasswordResetService(userService, tokenService, nil, mailer,
+		sessionManager, "http://localhost:8080")
+	authService := services.NewAuthService(userService, sessionManager, nil, passwordResetService,
+		nil, nil, nil, nil, &config.AuthOptions{})
+
+	passthrough := func(next http.Handler) http.Handler { return next }
+	r := chi.NewRouter()
+	routes.RegisterAuthRoutes(r, controllers.NewAuthController(authService), nil, nil, routes.Middlewares{
+		Auth:      passthrough,
+		Recaptcha: passthrough,
+		Admin:     passthrough,
+		RateLimit: func(ratelimit.Policy) func(http.Handler) http.Handler { return passthrough },
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	_, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+
+	forgotPayload, err := json.Marshal(dtos.ForgotPasswordDto{Email: user.Email})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/password/forgot", bytes.NewReader(forgotPayload)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NotNil(t, sentMail, "Password reset email should be sent")
+	match := regexp.MustCompile(`http://\S+/password/reset\?token=\S+`).FindString(sentMail.TextBody)
+	require.NotEmpty(t, match, "Password reset email should contain reset link")
+	link, err := url.Parse(match)
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link.RequestURI(), nil))
+	require.Equal(t, http.StatusOK, rec.Code, "Link should lead to existing page")
+	page := rec.Body.String()
+	assert.Contains(t, page, `action="/auth/password/reset"`)
+	hidden := regexp.MustCompile(`name="token" value="([^"]+)"`).FindStringSubmatch(page)
+	require.Len(t, hidden, 2, "Page should carry the token")
+	assert.Equal(t, link.Query().Get("token"), html.UnescapeString(hidden[1]))
+
+	newPassword := test.NewRandomUser().Password
+	submit := func() *httptest.ResponseRecorder {
+		form := url.Values{
+			"token":           {html.UnescapeString(hidden[1])},
+			"password":        {newPassword},
+			"password_repeat": {newPassword},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/auth/password/reset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = submit()
+	assert.Equal(t, http.StatusOK, rec.Code, "Expected HTTP status 200 OK")
+	assert.Contains(t, rec.Body.String(), "Password has been reset")
+
+	rec = submit()
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Token should be single-use")
+	assert.Contains(t, rec.Body.String(), "invalid or has expired")
+
+	loginPayload, err := json.Marshal(dtos.LoginDto{Email: user.Email, Password: newPassword})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(loginPayload)))
+	assert.Equal(t, http.StatusOK, rec.Code, "New password should work")
+}
+
+var twoFactorCodeRe = regexp.MustCompile(`login code is ([0-9]{6})`)
+
+func TestLogin_TwoFactor(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, maxAttempts int) (*controllers.AuthController, *entities.User, *[]*dtos.MailDto) {
+		ctrl := gomock.NewController(t)
+		t.Cleanup(ctrl.Finish)
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		userService := services.NewUserService(repo, test.NewPasswordHasher())
+
+		util := test.NewRedisTestUtil(t)
+		rs := session.NewRedisStore(util.Client())
+
+		var sentMails []*dtos.MailDto
+		mailer := mock.NewMockMailer(ctrl)
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+			sentMails = append(sentMails, mail)
+			return nil
+		}).AnyTimes()
+
+		authOptions := &config.AuthOptions{TwoFactorMaxAttempts: maxAttempts}
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService, mailer, "http://localhost:8080")
+		twoFactorService := services.NewTwoFactorService(userService, tokenService, mailer, nil, authOptions)
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil,
+			twoFactorService, nil, nil, nil, authOptions)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user := test.NewRandomUser()
+		created, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+		require.NoError(t, err)
+		created.IsTwoFactorEnabled = true
+		require.NoError(t, userService.Update(ctx, created))
+		created.Password = user.Password
+
+		return controllers.NewAuthController(authService), created, &sentMails
+	}
+
+	login := func(ac *controllers.AuthController, user *entities.User, code string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password, Code: code})
+		rec := httptest.NewRecorder()
+		ac.Login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		return rec
+	}
+
+	lastCode := func(t *testing.T, sentMails []*dtos.MailDto) string {
+		require.NotEmpty(t, sentMails, "Two-factor code should be sent")
+		match := twoFactorCodeRe.FindStringSubmatch(sentMails[len(sentMails)-1].TextBody)
+		require.Len(t, match, 2, "Email should contain two-factor code")
+		return match[1]
+	}
+
+	wrongCode := func(code string) string {
+		if code == "000000" {
+			return "111111"
+		}
+		return "000000"
+	}
+
+	t.Run("Session starts only after valid code", func(t *testing.T) {
+		t.Parallel()
+		ac, user, sentMails := setup(t, 5)
+
+		rec := login(ac, user, "")
+		assert.Equal(t, http.StatusAccepted, rec.Code, "Code should be required")
+		assert.Contains(t, rec.Body.String(), `"two_factor_required":true`)
+		assert.Empty(t, rec.Result().Cookies(), "Session shouldn't start without code")
+		code := lastCode(t, *sentMails)
+
+		rec = login(ac, user, wrongCode(code))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Wrong code should be refused")
+		assert.Empty(t, rec.Result().Cookies(), "Session shouldn't start with wrong code")
+
+		rec = login(ac, user, code)
+		assert.Equal(t, http.StatusOK, rec.Code, "Expected HTTP status 200 OK")
+		assert.NotEmpty(t, rec.Result().Cookies(), "Session should start with valid code")
+
+		rec = login(ac, user, code)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Code should be single-use")
+	})
+
+	t.Run("Code is dropped after too many attempts", func(t *testing.T) {
+		t.Parallel()
+		ac, user, sentMails := setup(t, 2)
+
+		rec := login(ac, user, "")
+		require.Equal(t, http.StatusAccepted, rec.Code, "Code should be required")
+		code := lastCode(t, *sentMails)
+
+		rec = login(ac, user, wrongCode(code))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = login(ac, user, wrongCode(code))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, "Attempts should be limited")
+
+		rec = login(ac, user, code)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Code should be invalidated after too many attempts")
+	})
+}
+
+func TestLogin_Lockout(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	var sentMails []*dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMails = append(sentMails, mail)
+		return nil
+	}).AnyTimes()
+
+	authOptions := &config.AuthOptions{
+		LoginThrottle: config.LoginThrottleOptions{
+			MaxAttempts:      3,
+			MaxAttemptsPerIP: 100,
+			Window:           900,
+			LockoutDuration:  900,
+		},
+	}
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+	verificationService := services.NewVerificationService(userService, tokenService, mailer, "http://localhost:8080")
+	loginAttemptService := services.NewLoginAttemptService(attempts.NewRedisCounter(util.Client()), mailer, &authOptions.LoginThrottle)
+	authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil,
+		loginAttemptService, nil, authOptions)
+	ac := controllers.NewAuthController(authService)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	_, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+
+	login := func(email string, password string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(dtos.LoginDto{Email: email, Password: password})
+		rec := httptest.NewRecorder()
+		ac.Login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		return rec
+	}
+
+	unknown := login(test.NewRandomUser().Email, user.Password)
+	wrong := login(user.Email, user.Password+"x")
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, unknown.Code, wrong.Code, "Unknown email and wrong password should look the same")
+	assert.Equal(t, unknown.Body.String(), wrong.Body.String(), "Unknown email and wrong password should look the same")
+
+	login(user.Email, user.Password+"x")
+	login(user.Email, user.Password+"x")
+
+	rec := login(user.Email, user.Password)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "Locked account should be refused even with valid password")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.Empty(t, rec.Result().Cookies(), "Session shouldn't start while locked")
+
+	require.Len(t, sentMails, 1, "Owner should be notified about lockout")
+	assert.Equal(t, []string{user.Email}, sentMails[0].To)
+}
+
+func TestLogin_LockoutOnWrongTwoFactorCodes(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	var sentMails []*dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMails = append(sentMails, mail)
+		return nil
+	}).AnyTimes()
+
+	authOptions := &config.AuthOptions{
+		TwoFactorMaxAttempts: 10,
+		LoginThrottle: config.LoginThrottleOptions{
+			MaxAttempts:      3,
+			MaxAttemptsPerIP: 100,
+			Window:           900,
+			LockoutDuration:  900,
+		},
+	}
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+	loginAttemptService := services.NewLoginAttemptService(attempts.NewRedisCounter(util.Client()), mailer, &authOptions.LoginThrottle)
+	twoFactorService := services.NewTwoFactorService(userService, tokenService, mailer, loginAttemptService, authOptions)
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, twoFactorService, nil,
+		loginAttemptService, nil, authOptions)
+	ac := controllers.NewAuthController(authService)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	created, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+	created.IsTwoFactorEnabled = true
+	require.NoError(t, userService.Update(ctx, created))
+
+	login := func(code string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password, Code: code})
+		rec := httptest.NewRecorder()
+		ac.Login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		return rec
+	}
+
+	rec := login("")
+	require.Equal(t, http.StatusAccepted, rec.Code, "Code should be required")
+	require.NotEmpty(t, sentMails, "Two-factor code should be sent")
+	match := twoFactorCodeRe.FindStringSubmatch(sentMails[len(sentMails)-1].TextBody)
+	require.Len(t, match, 2, "Email should contain two-factor code")
+
+	wrong := "000000"
+	if match[1] == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 3; i++ {
+		rec = login(wrong)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Wrong code should be refused")
+	}
+
+	rec = login(match[1])
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "Wrong codes should lock login like wrong passwords")
+	assert.Empty(t, rec.Result().Cookies(), "Session shouldn't start while locked")
+}
+
+func TestLogin_RehashesOutdatedPassword(t *testing.T) {
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+
+	util := test.NewRedisTestUtil(t)
+	sessionManager := session.NewSessionManager(session.NewRedisStore(util.Client()),
+		&config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Password set while bcrypt was configured.
+	user := test.NewRandomUser()
+	legacyService := services.NewUserService(repo, security.NewBcryptHasher(bcrypt.MinCost))
+	created, err := legacyService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(created.Password, "$2a$"))
+
+	userService := services.NewUserService(repo, test.NewPasswordHasher())
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, nil, nil, nil, nil, &config.AuthOptions{})
+	ac := controllers.NewAuthController(authService)
+
+	payload, _ := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password})
+	rec := httptest.NewRecorder()
+	ac.Login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err := repo.GetByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"), "Password should be rehashed with configured algorithm")
+	assert.True(t, userService.VerifyPassword(stored, user.Password))
+}
+
+func TestRegister_WeakPassword(t *testing.T) {
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	userService := services.NewUserService(repo, test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	sessionManager := session.NewSessionManager(session.NewRedisStore(util.Client()),
+		&config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	passwordPolicyService := services.NewPasswordPolicyService(nil, &config.PasswordPolicyOptions{
+		MinLength:          10,
+		MaxLength:          72,
+		RequireDigit:       true,
+		ForbidPersonalInfo: true,
+	})
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, nil, nil, nil,
+		passwordPolicyService, &config.AuthOptions{})
+	ac := controllers.NewAuthController(authService)
+
+	user := test.NewRandomUser()
+	// Random names start with "User-".
+	password := "user!"
+	payload, _ := json.Marshal(dtos.RegisterDto{Name: user.Name, Email: user.Email, Password: password, PasswordRepeat: password})
+	rec := httptest.NewRecorder()
+	ac.Register(rec, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(payload)))
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	var body struct {
+		Errors []dtos.FieldError `json:"errors"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	codes := make([]string, len(body.Errors))
+	for i, fieldErr := range body.Errors {
+		codes[i] = fieldErr.Code
+	}
+	assert.ElementsMatch(t, []string{"too_short", "missing_digit", "contains_name"}, codes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := repo.GetByEmail(ctx, user.Email)
+	assert.Error(t, err, "User shouldn't be created")
+}
+
+func TestChangePassword_CookieSessionStorage(t *testing.T) {
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+
+	sessionOptions := &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600}
+	sessionManager := session.NewSessionManager(session.NewCookieStore(sessionOptions), sessionOptions)
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, nil, nil, nil, nil, &config.AuthOptions{})
+	authController := controllers.NewAuthController(authService)
+	changePassword := middleware.AuthMiddleware(userService, sessionManager, http.HandlerFunc(authController.ChangePassword))
+	probe := middleware.AuthMiddleware(userService, sessionManager, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	_, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+
+	login := func() []*http.Cookie {
+		payload, err := json.Marshal(dtos.LoginDto{Email: user.Email, Password: user.Password})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		authController.Login(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(payload)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Result().Cookies()
+	}
+	withCookies := func(r *http.Request, cookies []*http.Cookie) *http.Request {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+	probeCode := func(cookies []*http.Cookie) int {
+		rec := httptest.NewRecorder()
+		probe.ServeHTTP(rec, withCookies(httptest.NewRequest(http.MethodGet, "/", nil), cookies))
+		return rec.Code
+	}
+
+	current, other := login(), login()
+	require.Equal(t, http.StatusNoContent, probeCode(other))
+
+	newPassword := test.NewRandomUser().Password
+	payload, err := json.Marshal(dtos.ChangePasswordDto{
+		CurrentPassword: user.Password,
+		Password:        newPassword,
+		PasswordRepeat:  newPassword,
+	})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	changePassword.ServeHTTP(rec, withCookies(httptest.NewRequest(http.MethodPut, "/users/password", bytes.NewReader(payload)), current))
+	require.Equal(t, http.StatusOK, rec.Code, "Password change shouldn't be refused with cookie storage")
+
+	assert.Equal(t, http.StatusNoContent, probeCode(rec.Result().Cookies()), "Current session should stay valid")
+	assert.Equal(t, http.StatusUnauthorized, probeCode(other), "Other sessions should be revoked")
+	assert.Equal(t, http.StatusUnauthorized, probeCode(current), "Session before rotation should be revoked")
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+type OAuthController struct {
+	oauthService *services.OAuthService
+}
+
+func NewOAuthController(oauthService *services.OAuthService) *OAuthController {
+	return &OAuthController{
+		oauthService: oauthService,
+	}
+}
+
+func (oc *OAuthController) Connect(w http.ResponseWriter, r *http.Request) {
+	authURL, err := oc.oauthService.AuthURL(chi.URLParam(r, "provider"), w, r)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownProvider) {
+			respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Unknown provider")
+			return
+		}
+		respond.InternalError(w, r, "Failed to start authorization", err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (oc *OAuthController) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		oc.oauthService.CancelFlow(w, r)
+		// Error comes from the query string, so it's only logged.
+		slog.Info("Authorization was denied by provider", "provider", chi.URLParam(r, "provider"),
+			"error", providerErr, "request_id", chimiddleware.GetReqID(r.Context()))
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Authorization was denied by provider")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		oc.oauthService.CancelFlow(w, r)
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeBadRequest, "Missing authorization code")
+		return
+	}
+
+	_, err := oc.oauthService.Authenticate(chi.URLParam(r, "provider"), code, query.Get("state"), w, r)
+	if err != nil {
+		writeOAuthError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Responds to failed OAuth login. Only provider's refusal is reported as
+// authentication failure, other errors may carry details clients shouldn't see.
+func writeOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "Unknown provider")
+	case errors.Is(err, services.ErrTotpRequired), errors.Is(err, services.ErrTwoFactorRequired):
+		writeLoginError(w, r, err)
+	case errors.Is(err, services.ErrOAuthFailed):
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Failed to authenticate with provider")
+	case errors.Is(err, services.ErrOAuthEmailNotVerified):
+		respond.Error(w, r, http.StatusConflict, respond.CodeConflict,
+			"Account with this email already exists, sign in to connect provider")
+	case errors.Is(err, services.ErrOAuthAccountLinkedToOtherUser):
+		respond.Error(w, r, http.StatusConflict, respond.CodeConflict,
+			"This provider account is already linked to another user")
+	case errors.Is(err, services.ErrOAuthProviderAlreadyLinked):
+		respond.Error(w, r, http.StatusConflict, respond.CodeConflict,
+			"Another account of this provider is already linked")
+	default:
+		respond.InternalError(w, r, "Failed to sign in with provider", err)
+	}
+}
@@ -0,0 +1,498 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	oauthconfig "github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/internal/pkg/test/mock"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Performs connect request and returns callback request the provider would redirect to.
+func oauthCallbackRequest(t *testing.T, r http.Handler, provider string, code string) (*http.Request, url.Values) {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oauth/connect/"+provider, nil))
+	require.Equal(t, http.StatusFound, rec.Code, "Expected HTTP status 302 Found")
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	authQuery := location.Query()
+
+	callbackQuery := url.Values{}
+	callbackQuery.Set("code", code)
+	callbackQuery.Set("state", authQuery.Get("state"))
+	req := httptest.NewRequest(http.MethodGet, "/auth/oauth/callback/"+provider+"?"+callbackQuery.Encode(), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	return req, authQuery
+}
+
+// Integrational tests
+func TestOAuthCallback_CreatesUserAndAccount(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Test oauth callback creates user and account", func(t *testing.T) {
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		accountRepo := postgres.NewPostgresAccountRepository(ptUtil.DB())
+		userService := services.NewUserService(userRepo, test.NewPasswordHasher())
+
+		util := test.NewRedisTestUtil(t)
+		rs := session.NewRedisStore(util.Client())
+		sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+		tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+		verificationService := services.NewVerificationService(userService, tokenService,
+			mail.NewLogMailer("no-reply@localhost"), "http://localhost:8080")
+		authService := services.NewAuthService(userService, sessionManager, verificationService, nil, nil, nil, nil, nil, &config.AuthOptions{})
+
+		user := test.NewRandomUser()
+		fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+			"sub":            "provider-user-id",
+			"email":          user.Email,
+			"email_verified": true,
+			"name":           user.Name,
+			"picture":        user.ProfilePicture,
+		})
+		providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+			BaseURL: "http://localhost:8080",
+			Services: []auth.OAuthProvider{
+				auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+					Name:         "fake",
+					Method:       entities.Google,
+					AuthorizeURL: fp.AuthorizeURL(),
+					AccessURL:    fp.AccessURL(),
+					ProfileURL:   fp.ProfileURL(),
+				}),
+			},
+		})
+		oauthService := services.NewOAuthService(userService, accountRepo, providerService, authService, sessionManager)
+		oauthController := controllers.NewOAuthController(oauthService)
+
+		r := chi.NewRouter()
+		r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+		r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+		req, authQuery := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+		assert.Equal(t, "S256", authQuery.Get("code_challenge_method"))
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusFound, rec.Code, "Expected HTTP status 302 Found")
+		require.NotEmpty(t, rec.Result().Cookies(), "Expected session cookie to be set")
+		assert.Equal(t, auth.CodeChallenge(fp.TokenRequest().Get("code_verifier")), authQuery.Get("code_challenge"),
+			"Token exchange must carry verifier matching the code challenge")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		createdUser, err := userRepo.GetByEmail(ctx, user.Email)
+		require.NoError(t, err, "OAuth user should be created")
+		assert.Equal(t, entities.Google, createdUser.Method)
+		assert.True(t, createdUser.IsEmailVerified)
+		require.Len(t, createdUser.Accounts, 1)
+		assert.Equal(t, "fake", createdUser.Accounts[0].Provider)
+		assert.Equal(t, "provider-user-id", createdUser.Accounts[0].ProviderAccountID)
+		assert.Equal(t, test.FakeOAuthAccessToken, createdUser.Accounts[0].AccessToken)
+
+		// Replaying the same callback must fail: pre-auth session is single use.
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected HTTP status 401 Unauthorized")
+
+		// Second login must reuse both user and account.
+		req, _ = oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code, "Expected HTTP status 302 Found")
+
+		relogged, err := userRepo.GetByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, createdUser.ID, relogged.ID)
+		assert.Len(t, relogged.Accounts, 1)
+	})
+}
+
+func TestOAuthCallback_RefusesUnverifiedEmailOfExistingUser(t *testing.T) {
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	accountRepo := postgres.NewPostgresAccountRepository(ptUtil.DB())
+	userService := services.NewUserService(userRepo, test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, nil, nil, nil, nil, &config.AuthOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	existing, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+
+	// Provider doesn't assert email is verified, so anyone could have claimed it there.
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+		"sub":   "attacker-id",
+		"email": user.Email,
+		"name":  "Attacker",
+	})
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Services: []auth.OAuthProvider{
+			auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+				Name:         "fake",
+				Method:       entities.Google,
+				AuthorizeURL: fp.AuthorizeURL(),
+				AccessURL:    fp.AccessURL(),
+				ProfileURL:   fp.ProfileURL(),
+			}),
+		},
+	})
+	oauthService := services.NewOAuthService(userService, accountRepo, providerService, authService, sessionManager)
+	oauthController := controllers.NewOAuthController(oauthService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+	req, _ := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code, "Expected HTTP status 409 Conflict")
+	for _, cookie := range rec.Result().Cookies() {
+		assert.NotEqual(t, "session_id", cookie.Name, "Session must not be started")
+	}
+
+	found, err := userRepo.GetByID(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found.Accounts, "Provider account must not be linked")
+}
+
+func TestOAuthCallback_KeepsLinkedAccountOfProvider(t *testing.T) {
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	accountRepo := postgres.NewPostgresAccountRepository(ptUtil.DB())
+	userService := services.NewUserService(userRepo, test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, nil, nil, nil, nil, &config.AuthOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	existing, err := userService.CreateUser(ctx, user.Email, "", user.Name, "", entities.Google, true)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	require.NoError(t, accountRepo.Save(ctx, &entities.Account{
+		ID:                uuid.NewString(),
+		Type:              "oauth",
+		Provider:          "fake",
+		ProviderAccountID: "original-id",
+		UserID:            existing.ID,
+		AccessToken:       "original-token",
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}))
+
+	// Another provider account with the same verified email must not replace the linked one.
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+		"sub":            "other-id",
+		"email":          user.Email,
+		"email_verified": true,
+	})
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Services: []auth.OAuthProvider{
+			auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+				Name:         "fake",
+				Method:       entities.Google,
+				AuthorizeURL: fp.AuthorizeURL(),
+				AccessURL:    fp.AccessURL(),
+				ProfileURL:   fp.ProfileURL(),
+			}),
+		},
+	})
+	oauthService := services.NewOAuthService(userService, accountRepo, providerService, authService, sessionManager)
+	oauthController := controllers.NewOAuthController(oauthService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+	req, _ := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code, "Expected HTTP status 409 Conflict")
+
+	found, err := userRepo.GetByID(ctx, existing.ID)
+	require.NoError(t, err)
+	require.Len(t, found.Accounts, 1)
+	assert.Equal(t, "original-id", found.Accounts[0].ProviderAccountID)
+	assert.Equal(t, "original-token", found.Accounts[0].AccessToken)
+}
+
+func TestOAuthCallback_RequiresSecondFactor(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	accountRepo := postgres.NewPostgresAccountRepository(ptUtil.DB())
+	userService := services.NewUserService(userRepo, test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	var sentMails []*dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMails = append(sentMails, mail)
+		return nil
+	}).AnyTimes()
+
+	authOptions := &config.AuthOptions{TwoFactorMaxAttempts: 5}
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+	twoFactorService := services.NewTwoFactorService(userService, tokenService, mailer, nil, authOptions)
+	authService := services.NewAuthService(userService, sessionManager, nil, nil, twoFactorService, nil, nil, nil, authOptions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	created, err := userService.CreateUser(ctx, user.Email, "", user.Name, "", entities.Google, true)
+	require.NoError(t, err)
+	created.IsTwoFactorEnabled = true
+	require.NoError(t, userService.Update(ctx, created))
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+		"sub":            "provider-user-id",
+		"email":          user.Email,
+		"email_verified": true,
+	})
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Services: []auth.OAuthProvider{
+			auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+				Name:         "fake",
+				Method:       entities.Google,
+				AuthorizeURL: fp.AuthorizeURL(),
+				AccessURL:    fp.AccessURL(),
+				ProfileURL:   fp.ProfileURL(),
+			}),
+		},
+	})
+	oauthService := services.NewOAuthService(userService, accountRepo, providerService, authService, sessionManager)
+	oauthController := controllers.NewOAuthController(oauthService)
+	authController := controllers.NewAuthController(authService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+	r.Post("/auth/login/complete", authController.CompleteLogin)
+
+	req, _ := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code, "Code should be required")
+	assert.Contains(t, rec.Body.String(), `"two_factor_required":true`)
+	var pending *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		assert.NotEqual(t, "session_id", cookie.Name, "Session shouldn't start without code")
+		if cookie.Name == "pending_login" && cookie.MaxAge > 0 {
+			pending = cookie
+		}
+	}
+	require.NotNil(t, pending, "Pending login should be remembered")
+
+	require.NotEmpty(t, sentMails, "Two-factor code should be sent")
+	match := twoFactorCodeRe.FindStringSubmatch(sentMails[len(sentMails)-1].TextBody)
+	require.Len(t, match, 2, "Email should contain two-factor code")
+
+	complete := func(code string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(dtos.CompleteLoginDto{Code: code})
+		req := httptest.NewRequest(http.MethodPost, "/auth/login/complete", bytes.NewReader(payload))
+		req.AddCookie(pending)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		// Failed attempt moves pending login to a new cookie.
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "pending_login" && cookie.MaxAge > 0 {
+				pending = cookie
+			}
+		}
+		return rec
+	}
+
+	wrong := "000000"
+	if match[1] == wrong {
+		wrong = "111111"
+	}
+	rec = complete(wrong)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "Wrong code should be refused")
+
+	rec = complete(match[1])
+	assert.Equal(t, http.StatusOK, rec.Code, "Expected HTTP status 200 OK")
+	var started bool
+	for _, cookie := range rec.Result().Cookies() {
+		started = started || cookie.Name == "session_id"
+	}
+	assert.True(t, started, "Session should start with valid code")
+}
+
+func TestOAuthCallback_StateMismatch(t *testing.T) {
+	t.Parallel()
+
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+	sessionManager := session.NewSessionManager(rs, &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{})
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Services: []auth.OAuthProvider{
+			auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+				Name:         "fake",
+				AuthorizeURL: fp.AuthorizeURL(),
+				AccessURL:    fp.AccessURL(),
+				ProfileURL:   fp.ProfileURL(),
+			}),
+		},
+	})
+	oauthService := services.NewOAuthService(nil, nil, providerService, nil, sessionManager)
+	oauthController := controllers.NewOAuthController(oauthService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+	req, _ := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+	query := req.URL.Query()
+	query.Set("state", "forged-state")
+	req.URL.RawQuery = query.Encode()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "Expected HTTP status 401 Unauthorized")
+	assert.Nil(t, fp.TokenRequest(), "Code must not be exchanged when state doesn't match")
+
+	var envelope dtos.ErrorDto
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&envelope))
+	assert.Equal(t, "Failed to authenticate with provider", envelope.Message, "Error details must not reach the client")
+}
+
+func TestOAuthConnect_UnknownProvider(t *testing.T) {
+	t.Parallel()
+
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{})
+	oauthService := services.NewOAuthService(nil, nil, providerService, nil, nil)
+	oauthController := controllers.NewOAuthController(oauthService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oauth/connect/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oauth/callback/unknown?code=code", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestOAuthCallback_ProviderError(t *testing.T) {
+	t.Parallel()
+
+	sessionManager := session.NewSessionManager(session.NewMemoryStore(context.Background(), 0),
+		&config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{})
+	providerService := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Services: []auth.OAuthProvider{
+			auth.NewBaseOAuthService(&oauthconfig.BaseOAuthProviderOptions{
+				Name:         "fake",
+				AuthorizeURL: fp.AuthorizeURL(),
+				AccessURL:    fp.AccessURL(),
+				ProfileURL:   fp.ProfileURL(),
+			}),
+		},
+	})
+	oauthController := controllers.NewOAuthController(services.NewOAuthService(nil, nil, providerService, nil, sessionManager))
+
+	r := chi.NewRouter()
+	r.Get("/auth/oauth/connect/{provider}", oauthController.Connect)
+	r.Get("/auth/oauth/callback/{provider}", oauthController.Callback)
+
+	req, _ := oauthCallbackRequest(t, r, "fake", test.FakeOAuthCode)
+	query := req.URL.Query()
+	query.Del("code")
+	query.Set("error", "<script>alert(1)</script>")
+	req.URL.RawQuery = query.Encode()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	var envelope dtos.ErrorDto
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&envelope))
+	assert.Equal(t, "Authorization was denied by provider", envelope.Message, "Provider error must not be echoed")
+
+	expired := false
+	for _, cookie := range rec.Result().Cookies() {
+		expired = expired || (cookie.Name == "oauth_flow" && cookie.MaxAge < 0)
+	}
+	assert.True(t, expired, "Flow cookie should be cleared")
+
+	// State was dropped, so it can't be replayed with a code.
+	query.Del("error")
+	query.Set("code", test.FakeOAuthCode)
+	req.URL.RawQuery = query.Encode()
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, fp.TokenRequest(), "Code must not be exchanged with dropped state")
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+)
+
+// Authenticator responses are small, anything bigger isn't a valid credential.
+const maxPasskeyResponseBytes = 64 << 10
+
+type PasskeyController struct {
+	passkeyService *services.PasskeyService
+}
+
+func NewPasskeyController(passkeyService *services.PasskeyService) *PasskeyController {
+	return &PasskeyController{
+		passkeyService: passkeyService,
+	}
+}
+
+func (pc *PasskeyController) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var registrationDto dtos.PasskeyRegistrationDto
+	if !decodeAndValidate(w, r, &registrationDto, nil) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	creation, err := pc.passkeyService.BeginRegistration(ctx, user, registrationDto, w, r)
+	if err != nil {
+		if !writeConfirmationError(w, r, err) {
+			respond.InternalError(w, r, "Failed to start passkey registration", err)
+		}
+		return
+	}
+
+	writePasskeyOptions(w, creation)
+}
+
+func (pc *PasskeyController) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	response, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPasskeyResponseBytes))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidPayload, "Invalid request payload")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	_, err = pc.passkeyService.FinishRegistration(ctx, user, response, w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidPasskey),
+			errors.Is(err, services.ErrPasskeyCeremonyExpired):
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeBadRequest, err.Error())
+		case errors.Is(err, services.ErrPasskeyAlreadyRegistered):
+			respond.Error(w, r, http.StatusConflict, respond.CodeConflict, err.Error())
+		default:
+			respond.InternalError(w, r, "Failed to register passkey", err)
+		}
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Passkey registered successfully",
+	})
+}
+
+func (pc *PasskeyController) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	assertion, err := pc.passkeyService.BeginLogin(w, r)
+	if err != nil {
+		respond.InternalError(w, r, "Failed to start passkey login", err)
+		return
+	}
+
+	writePasskeyOptions(w, assertion)
+}
+
+func (pc *PasskeyController) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	response, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPasskeyResponseBytes))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidPayload, "Invalid request payload")
+		return
+	}
+
+	_, err = pc.passkeyService.FinishLogin(response, w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPasskeyCeremonyExpired):
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeBadRequest, err.Error())
+		case errors.Is(err, services.ErrPasskeySignCountRegressed):
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, err.Error())
+		case errors.Is(err, services.ErrLoginLocked), errors.Is(err, services.ErrEmailNotVerified):
+			writeLoginError(w, r, err)
+		default:
+			// Details of failed verification are logged only.
+			slog.Info(err.Error())
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Passkey login failed")
+		}
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Login successful",
+	})
+}
+
+func writePasskeyOptions(w http.ResponseWriter, options interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, options)
+}
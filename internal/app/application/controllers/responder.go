@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/a-h/templ"
+)
+
+// Responds with per-field errors if err is ValidationError or
+// PasswordPolicyError. Returns false otherwise.
+func writeFieldErrorsOf(w http.ResponseWriter, r *http.Request, err error) bool {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		respond.FieldErrors(w, r, http.StatusBadRequest, respond.CodeValidationFailed,
+			"Some fields are invalid", validationErr.Errors)
+		return true
+	}
+
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		respond.FieldErrors(w, r, http.StatusBadRequest, respond.CodeWeakPassword,
+			"Password doesn't satisfy password policy", policyErr.Errors)
+		return true
+	}
+
+	return false
+}
+
+// Renders HTML page with status.
+func renderPage(w http.ResponseWriter, r *http.Request, status int, page templ.Component) {
+	templ.Handler(page, templ.WithStatus(status)).ServeHTTP(w, r)
+}
+
+// Reports whether request carries HTML form rather than JSON.
+func isFormRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+func fieldErrorMessages(errs []dtos.FieldError) []string {
+	messages := make([]string, len(errs))
+	for i, fieldErr := range errs {
+		messages[i] = fieldErr.Message
+	}
+	return messages
+}
+
+// Decodes JSON body into dto and validates it with validator. Responds with
+// error and returns false if the body is malformed or invalid.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dto interface{}, validate func(interface{}) error) bool {
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidPayload, "Invalid request payload")
+		return false
+	}
+	if validate == nil {
+		return true
+	}
+
+	if err := validate(dto); err != nil {
+		if !writeFieldErrorsOf(w, r, err) {
+			respond.InternalError(w, r, "Failed to validate request", err)
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithRequestID(handler http.HandlerFunc, body string) (*httptest.ResponseRecorder, dtos.ErrorDto) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set(chimiddleware.RequestIDHeader, "test-request")
+	rec := httptest.NewRecorder()
+	chimiddleware.RequestID(handler).ServeHTTP(rec, r)
+
+	var envelope dtos.ErrorDto
+	json.Unmarshal(rec.Body.Bytes(), &envelope)
+	return rec, envelope
+}
+
+func TestErrorEnvelope_Validation(t *testing.T) {
+	t.Parallel()
+
+	authService := services.NewAuthService(nil, nil, nil, nil, nil, nil, nil, nil, &config.AuthOptions{})
+	ac := controllers.NewAuthController(authService)
+
+	rec, envelope := serveWithRequestID(ac.Register,
+		`{"name": "User", "email": "user@example.com", "password": "s3cret-value", "password_repeat": "other-s3cret"}`)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, respond.CodeValidationFailed, envelope.Code)
+	assert.NotEmpty(t, envelope.Message)
+	assert.Equal(t, "test-request", envelope.RequestID)
+	assert.Equal(t, []dtos.FieldError{
+		{Field: "password_repeat", Code: "eqfield", Message: "password_repeat must be equal to Password"},
+	}, envelope.Errors)
+	assert.NotContains(t, rec.Body.String(), "s3cret", "Submitted values shouldn't be echoed back")
+}
+
+func TestErrorEnvelope_InvalidPayload(t *testing.T) {
+	t.Parallel()
+
+	ac := controllers.NewAuthController(services.NewAuthService(nil, nil, nil, nil, nil, nil, nil, nil, &config.AuthOptions{}))
+	uc := controllers.NewUserController(nil, nil)
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"Login":         ac.Login,
+		"ResetPassword": ac.ResetPassword,
+	} {
+		rec, envelope := serveWithRequestID(handler, `{"email": `)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+		assert.Equal(t, respond.CodeInvalidPayload, envelope.Code, name)
+		assert.Equal(t, "test-request", envelope.RequestID, name)
+	}
+
+	rec, envelope := serveWithRequestID(uc.FindProfile, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, respond.CodeUnauthorized, envelope.Code)
+}
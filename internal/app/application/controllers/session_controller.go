@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type SessionController struct {
+	sessionService *services.SessionService
+}
+
+func NewSessionController(sessionService *services.SessionService) *SessionController {
+	return &SessionController{
+		sessionService: sessionService,
+	}
+}
+
+func (sc *SessionController) List(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := sc.sessionService.List(ctx, user.ID, r)
+	if err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	writeSessions(w, sessions)
+}
+
+func (sc *SessionController) Revoke(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := sc.sessionService.Revoke(ctx, user.ID, chi.URLParam(r, "id")); err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logs the user out of all other devices, the current session is kept.
+func (sc *SessionController) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := sc.sessionService.RevokeOthers(ctx, user.ID, r); err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sc *SessionController) ListForUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := sc.sessionService.ListForUser(ctx, userID)
+	if err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	writeSessions(w, sessions)
+}
+
+func (sc *SessionController) RevokeForUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := sc.sessionService.RevokeForUser(ctx, userID, chi.URLParam(r, "id")); err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sc *SessionController) RevokeAllForUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := sc.sessionService.RevokeAllForUser(ctx, userID); err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := chi.URLParam(r, "userID")
+	if _, err := uuid.Parse(userID); err != nil {
+		respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, services.ErrUserNotFound.Error())
+		return "", false
+	}
+	return userID, true
+}
+
+func writeSessions(w http.ResponseWriter, sessions []dtos.SessionDto) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, sessions)
+}
+
+func writeSessionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, session.ErrSessionNotFound), errors.Is(err, services.ErrUserNotFound):
+		respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, err.Error())
+	case errors.Is(err, session.ErrSessionRevocationUnsupported):
+		respond.Error(w, r, http.StatusNotImplemented, respond.CodeNotImplemented,
+			"Sessions can't be managed with this session storage")
+	default:
+		respond.InternalError(w, r, "Failed to manage sessions", err)
+	}
+}
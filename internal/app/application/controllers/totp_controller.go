@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/pkg/putils"
+)
+
+type TotpController struct {
+	totpService *services.TotpService
+	validator   *services.Validator
+}
+
+func NewTotpController(totpService *services.TotpService) *TotpController {
+	return &TotpController{
+		totpService: totpService,
+		validator:   services.NewValidator(),
+	}
+}
+
+func (tc *TotpController) BeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	enrollment, err := tc.totpService.BeginEnrollment(ctx, user)
+	if err != nil {
+		writeTotpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, enrollment)
+}
+
+func (tc *TotpController) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var codeDto dtos.TotpCodeDto
+	if !decodeAndValidate(w, r, &codeDto, tc.validator.Validate) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	codes, err := tc.totpService.ConfirmEnrollment(ctx, user, putils.ClientIP(r), codeDto.Code)
+	if err != nil {
+		writeTotpError(w, r, err)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+func (tc *TotpController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var codeDto dtos.TotpCodeDto
+	if !decodeAndValidate(w, r, &codeDto, tc.validator.Validate) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	codes, err := tc.totpService.RegenerateRecoveryCodes(ctx, user, putils.ClientIP(r), codeDto.Code)
+	if err != nil {
+		writeTotpError(w, r, err)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+func (tc *TotpController) Disable(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var disableDto dtos.TotpDisableDto
+	if !decodeAndValidate(w, r, &disableDto, tc.validator.Validate) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := tc.totpService.Disable(ctx, user, putils.ClientIP(r), disableDto); err != nil {
+		writeTotpError(w, r, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Authenticator app has been disabled",
+	})
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, dtos.RecoveryCodesDto{RecoveryCodes: codes})
+}
+
+func writeTotpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTotpCode):
+		respond.Error(w, r, http.StatusBadRequest, respond.CodeInvalidToken, "Invalid authenticator code")
+	case errors.Is(err, services.ErrTotpAlreadyEnabled),
+		errors.Is(err, services.ErrTotpNotEnrolled),
+		errors.Is(err, services.ErrTotpNotEnabled):
+		respond.Error(w, r, http.StatusConflict, respond.CodeConflict, err.Error())
+	default:
+		if !writeConfirmationError(w, r, err) {
+			respond.InternalError(w, r, "Failed to update authenticator app settings", err)
+		}
+	}
+}
@@ -2,42 +2,120 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
 	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/pkg/putils"
 )
 
 type UserController struct {
-	userService *services.UserService
+	userService      *services.UserService
+	twoFactorService *services.TwoFactorService
+	validator        *services.Validator
 }
 
-func NewUserController(userService *services.UserService) *UserController {
+func NewUserController(userService *services.UserService, twoFactorService *services.TwoFactorService) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:      userService,
+		twoFactorService: twoFactorService,
+		validator:        services.NewValidator(),
 	}
 }
 
 func (uc *UserController) FindProfile(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
-	if !ok || userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	sessionUser, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	user, err := uc.userService.FindByID(ctx, userID)
+	user, err := uc.userService.FindByID(ctx, sessionUser.ID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		respond.Error(w, r, http.StatusNotFound, respond.CodeNotFound, "User not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	respond.JSON(w, http.StatusOK, dtos.UserProfileDto{
+		ID:                 user.ID,
+		ProfilePicture:     user.ProfilePicture,
+		Name:               user.Name,
+		Email:              user.Email,
+		IsEmailVerified:    user.IsEmailVerified,
+		IsTwoFactorEnabled: user.IsTwoFactorEnabled,
+		CreatedAt:          user.CreatedAt,
+	})
+}
+
+func (uc *UserController) SetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var settingsDto dtos.TwoFactorSettingsDto
+	if !decodeAndValidate(w, r, &settingsDto, uc.validator.Validate) {
 		return
 	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := uc.twoFactorService.SetEnabled(ctx, sessionUser, putils.ClientIP(r), settingsDto); err != nil {
+		if writeConfirmationError(w, r, err) {
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			respond.Error(w, r, http.StatusForbidden, respond.CodeEmailNotVerified,
+				"Email is not verified. Please follow the link we've sent to your email")
+			return
+		}
+		respond.InternalError(w, r, "Failed to update two-factor settings", err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Two-factor settings updated",
+	})
+}
+
+// Responds to failed confirmation of sensitive change with current password
+// or second factor code. Returns false if err isn't such failure.
+func writeConfirmationError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		respond.JSON(w, http.StatusAccepted, map[string]interface{}{
+			"message":             "Please confirm with your current password or the code we've sent to your email",
+			"two_factor_required": true,
+			"two_factor_method":   "email",
+		})
+	case errors.Is(err, services.ErrTotpRequired):
+		respond.JSON(w, http.StatusAccepted, map[string]interface{}{
+			"message":             "Please confirm with your current password or the code from your authenticator app",
+			"two_factor_required": true,
+			"two_factor_method":   "totp",
+		})
+	case errors.Is(err, services.ErrWrongPassword):
+		respond.Error(w, r, http.StatusForbidden, respond.CodeForbidden, "Current password is wrong")
+	case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrInvalidTotpCode):
+		respond.Error(w, r, http.StatusForbidden, respond.CodeInvalidToken, "Invalid two-factor code")
+	case errors.Is(err, services.ErrTokenExpired):
+		respond.Error(w, r, http.StatusForbidden, respond.CodeTokenExpired, "Two-factor code has expired")
+	case errors.Is(err, services.ErrTooManyAttempts):
+		respond.Error(w, r, http.StatusTooManyRequests, respond.CodeTooManyRequests,
+			"Too many invalid two-factor codes. Please request a new one")
+	case errors.Is(err, services.ErrLoginLocked):
+		writeLockedError(w, r, err)
+	default:
+		return false
+	}
+	return true
 }
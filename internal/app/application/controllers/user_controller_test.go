@@ -0,0 +1,113 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/internal/pkg/test/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTwoFactor_DisableRequiresProof(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+
+	util := test.NewRedisTestUtil(t)
+	sessionManager := session.NewSessionManager(session.NewRedisStore(util.Client()),
+		&config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, MaxAge: 3600})
+
+	var sentMails []*dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMails = append(sentMails, mail)
+		return nil
+	}).AnyTimes()
+
+	tokenService := services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), tokenOptions)
+	twoFactorService := services.NewTwoFactorService(userService, tokenService, mailer, nil,
+		&config.AuthOptions{TwoFactorMaxAttempts: 10})
+	handler := middleware.AuthMiddleware(userService, sessionManager,
+		http.HandlerFunc(controllers.NewUserController(userService, twoFactorService).SetTwoFactor))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := test.NewRandomUser()
+	created, err := userService.CreateUser(ctx, user.Email, user.Password, user.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+	created.IsTwoFactorEnabled = true
+	require.NoError(t, userService.Update(ctx, created))
+
+	w := httptest.NewRecorder()
+	_, err = sessionManager.CreateSession(w, httptest.NewRequest(http.MethodPost, "/login", nil),
+		&session.Session{UserID: created.ID, AuthLevel: session.AuthLevelMultiFactor})
+	require.NoError(t, err)
+	sessionCookie := w.Result().Cookies()[0]
+
+	setTwoFactor := func(settings dtos.TwoFactorSettingsDto) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(settings)
+		r := httptest.NewRequest(http.MethodPut, "/users/two-factor", bytes.NewReader(payload))
+		r.AddCookie(sessionCookie)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	twoFactorEnabled := func() bool {
+		found, err := userService.FindByID(ctx, created.ID)
+		require.NoError(t, err)
+		return found.IsTwoFactorEnabled
+	}
+
+	rec := setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: false})
+	assert.Equal(t, http.StatusAccepted, rec.Code, "Proof should be required")
+	assert.True(t, twoFactorEnabled())
+	require.NotEmpty(t, sentMails, "Code should be sent")
+	match := twoFactorCodeRe.FindStringSubmatch(sentMails[len(sentMails)-1].TextBody)
+	require.Len(t, match, 2, "Email should contain two-factor code")
+
+	rec = setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: false, CurrentPassword: "wrong-password"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, twoFactorEnabled(), "Wrong password shouldn't disable two-factor codes")
+
+	wrong := "000000"
+	if match[1] == wrong {
+		wrong = "111111"
+	}
+	rec = setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: false, Code: wrong})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, twoFactorEnabled(), "Wrong code shouldn't disable two-factor codes")
+
+	rec = setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: false, Code: match[1]})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, twoFactorEnabled())
+
+	rec = setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: true})
+	assert.Equal(t, http.StatusOK, rec.Code, "Enabling shouldn't need proof")
+	assert.True(t, twoFactorEnabled())
+
+	rec = setTwoFactor(dtos.TwoFactorSettingsDto{Enabled: false, CurrentPassword: user.Password})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, twoFactorEnabled())
+}
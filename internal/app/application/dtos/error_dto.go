@@ -0,0 +1,17 @@
+package dtos
+
+// Body of every error response. Code is stable for clients to branch on,
+// Message is for humans.
+type ErrorDto struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// Problem with a single field of request. Field is its JSON name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
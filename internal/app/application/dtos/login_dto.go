@@ -3,4 +3,14 @@ package dtos
 type LoginDto struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// Two-factor code, sent on the second step of login.
+	Code string `json:"code,omitempty" validate:"omitempty,numeric,len=6"`
+	// One-time recovery code, accepted instead of authenticator app code.
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=64"`
+}
+
+// Second step of login started without password, e.g. with OAuth.
+type CompleteLoginDto struct {
+	Code         string `json:"code,omitempty" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=64"`
 }
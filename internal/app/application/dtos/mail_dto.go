@@ -0,0 +1,8 @@
+package dtos
+
+type MailDto struct {
+	To       []string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
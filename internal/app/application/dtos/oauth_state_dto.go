@@ -0,0 +1,10 @@
+package dtos
+
+// OAuthStateDto is what the connect endpoint remembers about the pending
+// authorization request to validate the provider callback.
+type OAuthStateDto struct {
+	Provider     string
+	State        string
+	CodeVerifier string
+	Nonce        string
+}
@@ -1,12 +1,14 @@
 package dtos
 
 type OAuthUserDto struct {
-	ID           string
-	Picture      string
-	Name         string
-	Email        string
-	AccessToken  string
-	RefreshToken string
-	ExpiresAt    int64
-	Provider     string
+	ID      string
+	Picture string
+	Name    string
+	Email   string
+	// Whether provider asserts the user owns Email.
+	EmailVerified bool
+	AccessToken   string
+	RefreshToken  string
+	ExpiresAt     int64
+	Provider      string
 }
@@ -0,0 +1,8 @@
+package dtos
+
+// Registering a passkey takes the current password or a second factor code,
+// as the passkey alone is enough to login.
+type PasskeyRegistrationDto struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
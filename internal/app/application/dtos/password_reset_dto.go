@@ -0,0 +1,17 @@
+package dtos
+
+type ForgotPasswordDto struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordDto struct {
+	Token          string `json:"token" validate:"required"`
+	Password       string `json:"password" validate:"required"`
+	PasswordRepeat string `json:"password_repeat" validate:"required,eqfield=Password"`
+}
+
+type ChangePasswordDto struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	Password        string `json:"password" validate:"required"`
+	PasswordRepeat  string `json:"password_repeat" validate:"required,eqfield=Password"`
+}
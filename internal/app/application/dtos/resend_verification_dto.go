@@ -0,0 +1,5 @@
+package dtos
+
+type ResendVerificationDto struct {
+	Email string `json:"email" validate:"required,email"`
+}
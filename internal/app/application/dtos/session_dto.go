@@ -0,0 +1,14 @@
+package dtos
+
+import "time"
+
+// Session of a user as shown in the list of active sessions. ID isn't the
+// session cookie value, it only identifies the session for revocation.
+type SessionDto struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,22 @@
+package dtos
+
+type TotpEnrollmentDto struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TotpCodeDto struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Turning authenticator app off takes the current password, its code or a
+// recovery code.
+type TotpDisableDto struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+	RecoveryCode    string `json:"recovery_code"`
+}
+
+type RecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
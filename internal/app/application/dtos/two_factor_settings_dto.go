@@ -0,0 +1,9 @@
+package dtos
+
+// Turning two-factor codes off takes either the current password or a code
+// sent to user's email.
+type TwoFactorSettingsDto struct {
+	Enabled         bool   `json:"enabled"`
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
@@ -0,0 +1,13 @@
+package dtos
+
+import "time"
+
+type UserProfileDto struct {
+	ID                 string    `json:"id"`
+	ProfilePicture     string    `json:"profile_picture"`
+	Name               string    `json:"name"`
+	Email              string    `json:"email"`
+	IsEmailVerified    bool      `json:"is_email_verified"`
+	IsTwoFactorEnabled bool      `json:"is_two_factor_enabled"`
+	CreatedAt          time.Time `json:"created_at"`
+}
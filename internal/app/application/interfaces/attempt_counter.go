@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+)
+
+// Counts failed attempts per key within a fixed window and keeps temporary
+// locks of keys.
+type AttemptCounter interface {
+	// Increments counter of key and returns its new value. Window of
+	// windowSeconds starts with the first attempt, counter resets after it.
+	Increment(ctx context.Context, key string, windowSeconds int) (int, error)
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, seconds int) error
+	// Returns seconds key stays locked for, 0 if it isn't locked.
+	LockedFor(ctx context.Context, key string) (int, error)
+}
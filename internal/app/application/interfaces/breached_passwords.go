@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+)
+
+// Looks up breached passwords by k-anonymity: only the first 5 hex characters
+// of password's SHA-1 hash are given away, the match is done by the caller.
+type BreachedPasswords interface {
+	// Returns uppercase hex suffixes of breached SHA-1 hashes starting with
+	// prefix, mapped to the number of times they were seen in breaches.
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
@@ -0,0 +1,11 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, mail *dtos.MailDto) error
+}
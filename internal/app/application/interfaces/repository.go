@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
 )
@@ -11,5 +12,45 @@ type UserRepository interface {
 	GetByEmail(ctx context.Context, email string) (*entities.User, error)
 	Save(ctx context.Context, user *entities.User) error
 	Update(ctx context.Context, user *entities.User) error
+	// Moves user's last used TOTP step forward. Returns false if step isn't
+	// newer than stored one, i.e. the code was already used.
+	AdvanceTotpStep(ctx context.Context, id string, step int64) (bool, error)
+	// Moves user's session epoch forward and returns the new one. Sessions
+	// started in earlier epochs are refused from then on.
+	BumpSessionEpoch(ctx context.Context, id string) (int64, error)
 	Delete(ctx context.Context, id string) error
 }
+
+type AccountRepository interface {
+	GetByUserIDAndProvider(ctx context.Context, userID string, provider string) (*entities.Account, error)
+	GetByProviderAccountID(ctx context.Context, provider string, providerAccountID string) (*entities.Account, error)
+	Save(ctx context.Context, account *entities.Account) error
+	Update(ctx context.Context, account *entities.Account) error
+}
+
+type TokenRepository interface {
+	GetByToken(ctx context.Context, token string, tokenType entities.TokenType) (*entities.Token, error)
+	GetByEmailAndType(ctx context.Context, email string, tokenType entities.TokenType) (*entities.Token, error)
+	Save(ctx context.Context, token *entities.Token) error
+	IncrementAttempts(ctx context.Context, id string) (int, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByEmailAndType(ctx context.Context, email string, tokenType entities.TokenType) error
+	// Deletes tokens expired before now and returns how many were deleted.
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type RecoveryCodeRepository interface {
+	// Replaces all recovery codes of the user with the given ones.
+	ReplaceForUser(ctx context.Context, userID string, codes []entities.RecoveryCode) error
+	// Deletes user's code with the given hash. Returns false if there was no such code.
+	Use(ctx context.Context, userID string, codeHash string) (bool, error)
+	CountForUser(ctx context.Context, userID string) (int, error)
+}
+
+type CredentialRepository interface {
+	GetByUserID(ctx context.Context, userID string) ([]entities.Credential, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*entities.Credential, error)
+	Save(ctx context.Context, credential *entities.Credential) error
+	// Stores sign count, backup state and last usage time after successful login.
+	UpdateUsage(ctx context.Context, credential *entities.Credential) error
+}
@@ -4,8 +4,19 @@ import (
 	"context"
 )
 
+// Keeps session data serialized by SessionManager. Get returns nil for
+// missing and expired keys.
+//
+// Sets hold IDs, e.g. of all sessions of a user. Members are added and
+// removed atomically, so concurrent changes of a set aren't lost. Delete
+// removes sets as well.
 type SessionStorage interface {
-	Get(ctx context.Context, key string) (map[string]interface{}, error)
-	Set(ctx context.Context, key string, value map[string]interface{}, ttlSeconds int) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte, ttlSeconds int) error
 	Delete(ctx context.Context, key string) error
+	// Adds member to set under key. Member is kept at least ttlSeconds.
+	AddToSet(ctx context.Context, key string, member string, ttlSeconds int) error
+	RemoveFromSet(ctx context.Context, key string, member string) error
+	// Returns members of set under key, empty if there is no such set.
+	SetMembers(ctx context.Context, key string) ([]string, error)
 }
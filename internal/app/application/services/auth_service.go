@@ -4,36 +4,80 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/config"
 	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
-	"github.com/Mixturka/vm-hub/pkg/security"
-	"github.com/go-playground/validator/v10"
+	"github.com/Mixturka/vm-hub/pkg/putils"
 	"github.com/jackc/pgx/v4"
 )
 
+var (
+	ErrEmailNotVerified  = errors.New("email is not verified. Please follow the link we've sent to your email")
+	ErrTwoFactorRequired = errors.New("two-factor code is required. Please enter the code we've sent to your email")
+	ErrTotpRequired      = errors.New("two-factor code is required. Please enter the code from your authenticator app or a recovery code")
+	ErrWrongPassword     = errors.New("wrong password")
+	ErrNoPendingLogin    = errors.New("there is no login waiting for two-factor code. Please login again")
+	ErrEmailTaken        = errors.New("user with this email already exists. Please try to use other email or login to the existing account")
+	// Same for unknown email and wrong password, so registered emails can't
+	// be found out by logging in.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+const (
+	// Cookie holding user who passed the first factor of login by other means
+	// than password, e.g. OAuth, until the second factor is sent.
+	pendingLoginCookieName = "pending_login"
+	pendingLoginTTLSeconds = 300
+)
+
 type AuthService struct {
-	userServise    *UserService
-	validate       *validator.Validate
-	sessionManager *session.SessionManager
+	userServise          *UserService
+	validator            *Validator
+	sessionManager       *session.SessionManager
+	verificationService  *VerificationService
+	passwordResetService *PasswordResetService
+	twoFactorService     *TwoFactorService
+	totpService          *TotpService
+	loginAttemptService  *LoginAttemptService
+	passwordPolicy       *PasswordPolicyService
+	options              *config.AuthOptions
 }
 
-func NewAuthService(userService *UserService, sessionManager *session.SessionManager) *AuthService {
+func NewAuthService(userService *UserService, sessionManager *session.SessionManager,
+	verificationService *VerificationService, passwordResetService *PasswordResetService,
+	twoFactorService *TwoFactorService, totpService *TotpService, loginAttemptService *LoginAttemptService,
+	passwordPolicy *PasswordPolicyService, options *config.AuthOptions) *AuthService {
 	return &AuthService{
-		userServise:    userService,
-		validate:       validator.New(),
-		sessionManager: sessionManager,
+		userServise:          userService,
+		validator:            NewValidator(),
+		sessionManager:       sessionManager,
+		verificationService:  verificationService,
+		passwordResetService: passwordResetService,
+		twoFactorService:     twoFactorService,
+		totpService:          totpService,
+		loginAttemptService:  loginAttemptService,
+		passwordPolicy:       passwordPolicy,
+		options:              options,
 	}
 }
 
-func (as *AuthService) Register(dto dtos.RegisterDto, w http.ResponseWriter) error {
+// Creates user and sends email verification link. Session is started right away
+// unless login requires verified email. Password breaking password policy gives
+// PasswordPolicyError.
+func (as *AuthService) Register(dto dtos.RegisterDto, w http.ResponseWriter, r *http.Request) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := as.passwordPolicy.Check(ctx, dto.Password, dto.Email, dto.Name); err != nil {
+		return err
+	}
+
 	isExists, err := as.userServise.FindByEmail(ctx, dto.Email)
 	if err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
@@ -41,7 +85,7 @@ func (as *AuthService) Register(dto dtos.RegisterDto, w http.ResponseWriter) err
 		}
 	}
 	if isExists != nil {
-		return errors.New("registration failed: user with this email already exists. Please try to use other email or login to the existing account")
+		return ErrEmailTaken
 	}
 
 	newUser, err := as.userServise.CreateUser(ctx, dto.Email, dto.Password,
@@ -50,24 +94,319 @@ func (as *AuthService) Register(dto dtos.RegisterDto, w http.ResponseWriter) err
 		return fmt.Errorf("failed to create new user: %w", err)
 	}
 
-	return as.SaveSession(newUser, w)
+	// User is already created, so failed delivery is reported but doesn't fail
+	// registration: the link can be requested again.
+	if err := as.verificationService.SendVerification(ctx, newUser); err != nil {
+		slog.Error(err.Error())
+	}
+
+	if as.options.RequireEmailVerification {
+		return nil
+	}
+
+	return as.SaveSession(newUser, session.AuthLevelSingleFactor, w, r)
 }
 
-func (as *AuthService) Login(dto dtos.LoginDto, w http.ResponseWriter) error {
+func (as *AuthService) VerifyEmail(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return as.verificationService.Verify(ctx, token)
+}
+
+// Sends new verification link if email belongs to unverified credentials user.
+// Nothing is reported otherwise to avoid revealing registered emails.
+func (as *AuthService) ResendVerification(dto dtos.ResendVerificationDto) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	user, err := as.userServise.FindByEmail(ctx, dto.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if user.IsEmailVerified || user.Method != entities.Credentials {
+		return nil
+	}
+
+	return as.verificationService.SendVerification(ctx, user)
+}
+
+// Mails password reset link if email is registered. Nothing is reported
+// otherwise to avoid revealing registered emails.
+func (as *AuthService) ForgotPassword(dto dtos.ForgotPasswordDto) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := as.userServise.FindByEmail(ctx, dto.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return as.passwordResetService.SendReset(ctx, user)
+}
+
+func (as *AuthService) ResetPassword(dto dtos.ResetPasswordDto) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return as.passwordResetService.Reset(ctx, dto.Token, dto.Password)
+}
 
+// Sets new password after checking the current one and password policy. Wrong
+// current passwords are throttled like failed logins. Sessions on other devices
+// are revoked and the current one gets new ID.
+func (as *AuthService) ChangePassword(user *entities.User, dto dtos.ChangePasswordDto,
+	w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := confirmThrottled(ctx, as.loginAttemptService, user, putils.ClientIP(r), func() error {
+		if !as.userServise.VerifyPassword(user, dto.CurrentPassword) {
+			return ErrWrongPassword
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := as.passwordPolicy.Check(ctx, dto.Password, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	if err := as.userServise.SetPassword(user, dto.Password); err != nil {
+		return err
+	}
+	if err := as.userServise.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := revokeUserSessions(ctx, as.userServise, as.sessionManager, user, w, r); err != nil {
+		return err
+	}
+	if _, err := as.sessionManager.RotateSession(w, r); err != nil {
+		return fmt.Errorf("failed to rotate session: %w", err)
+	}
+
+	return nil
+}
+
+// Starts session if credentials are correct. Users with authenticator app have
+// to send its code or a recovery code along, ErrTotpRequired is returned otherwise.
+// Users with emailed two-factor codes get ErrTwoFactorRequired and code by email
+// first, then have to repeat login with the code.
+//
+// Unknown email and wrong password both give ErrInvalidCredentials. Failed
+// attempts, including wrong second factor codes, delay further ones and
+// eventually lock login, LoginLockedError is returned meanwhile. The counter
+// is reset only once session is started. Outdated password hash is replaced once the password
+// is verified.
+func (as *AuthService) Login(dto dtos.LoginDto, w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ip := putils.ClientIP(r)
+	if err := as.checkLoginAttempts(ctx, dto.Email, ip); err != nil {
+		return err
+	}
+
+	user, err := as.userServise.FindByEmail(ctx, dto.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		// Backend failure says nothing about credentials, so it isn't counted.
+		return fmt.Errorf("failed to find user: %w", err)
+	}
 	if err != nil || user.Password == "" {
-		return errors.New("user wasn't found. Please check entered data")
+		as.userServise.VerifyPassword(nil, dto.Password)
+		as.recordFailedLogin(ctx, nil, dto.Email, ip)
+		return ErrInvalidCredentials
+	}
+
+	if !as.userServise.VerifyPassword(user, dto.Password) {
+		as.recordFailedLogin(ctx, user, dto.Email, ip)
+		return ErrInvalidCredentials
+	}
+
+	// Old hash still works, so failing to replace it doesn't fail login.
+	if err := as.userServise.UpgradePasswordHash(ctx, user, dto.Password); err != nil {
+		slog.Error("Failed to upgrade password hash", "user", user.ID, "error", err)
 	}
 
-	if !security.ComparePasswords(user.Password, dto.Password) {
-		return errors.New("wrong password")
+	if !as.canLogin(user) {
+		return ErrEmailNotVerified
 	}
 
-	return as.SaveSession(user, w)
+	authLevel, err := as.verifySecondFactor(ctx, user, dto.Code, dto.RecoveryCode)
+	if err != nil {
+		if isWrongSecondFactor(err) {
+			as.recordFailedLogin(ctx, user, dto.Email, ip)
+		}
+		return err
+	}
+
+	if err := as.SaveSession(user, authLevel, w, r); err != nil {
+		return err
+	}
+	as.recordSuccessfulLogin(ctx, dto.Email)
+	return nil
+}
+
+// Starts session of user who authenticated without password, e.g. with OAuth.
+// Users with second factor get ErrTotpRequired or ErrTwoFactorRequired instead,
+// and login is finished by CompleteLogin within a few minutes.
+func (as *AuthService) StartLogin(ctx context.Context, user *entities.User, w http.ResponseWriter, r *http.Request) error {
+	authLevel, err := as.verifySecondFactor(ctx, user, "", "")
+	if err == nil {
+		return as.SaveSession(user, authLevel, w, r)
+	}
+	if !errors.Is(err, ErrTotpRequired) && !errors.Is(err, ErrTwoFactorRequired) {
+		return err
+	}
+
+	expiresAt := time.Now().Add(pendingLoginTTLSeconds * time.Second)
+	pendErr := as.savePendingLogin(user.ID, expiresAt, w, r)
+	if pendErr != nil {
+		return pendErr
+	}
+	return err
+}
+
+// Finishes login started by StartLogin with second factor. Failed attempts
+// are throttled like the ones of Login, and login can be retried until it
+// expires.
+func (as *AuthService) CompleteLogin(dto dtos.CompleteLoginDto, w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	values, err := as.sessionManager.PopTransientSession(w, r, pendingLoginCookieName)
+	if err != nil {
+		return fmt.Errorf("failed to load pending login: %w", err)
+	}
+	expiresAt, err := strconv.ParseInt(values["expiresAt"], 10, 64)
+	if values == nil || err != nil {
+		return ErrNoPendingLogin
+	}
+
+	user, err := as.userServise.FindByID(ctx, values["userID"])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoPendingLogin
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	ip := putils.ClientIP(r)
+	if err := as.checkLoginAttempts(ctx, user.Email, ip); err != nil {
+		return err
+	}
+
+	authLevel, err := as.verifySecondFactor(ctx, user, dto.Code, dto.RecoveryCode)
+	if err != nil {
+		if isWrongSecondFactor(err) {
+			as.recordFailedLogin(ctx, user, user.Email, ip)
+		}
+		if pendErr := as.savePendingLogin(user.ID, time.Unix(expiresAt, 0), w, r); pendErr != nil {
+			slog.Error(pendErr.Error())
+		}
+		return err
+	}
+
+	if err := as.SaveSession(user, authLevel, w, r); err != nil {
+		return err
+	}
+	as.recordSuccessfulLogin(ctx, user.Email)
+	return nil
+}
+
+func (as *AuthService) savePendingLogin(userID string, expiresAt time.Time, w http.ResponseWriter, r *http.Request) error {
+	ttl := int(time.Until(expiresAt).Seconds())
+	if ttl <= 0 {
+		return nil
+	}
+
+	err := as.sessionManager.CreateTransientSession(w, r, pendingLoginCookieName, map[string]string{
+		"userID":    userID,
+		"expiresAt": strconv.FormatInt(expiresAt.Unix(), 10),
+	}, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to save pending login: %w", err)
+	}
+	return nil
+}
+
+// Reports whether err is a refused second factor code, which counts as failed
+// login attempt like a wrong password.
+func isWrongSecondFactor(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrInvalidTotpCode) ||
+		errors.Is(err, ErrTooManyAttempts)
+}
+
+// Returns auth level user reaches with code or recoveryCode. Users with
+// authenticator app get ErrTotpRequired without codes. Users with emailed
+// codes get ErrTwoFactorRequired and code by email without code.
+func (as *AuthService) verifySecondFactor(ctx context.Context, user *entities.User, code, recoveryCode string) (session.AuthLevel, error) {
+	switch {
+	case user.IsTotpEnabled:
+		if code == "" && recoveryCode == "" {
+			return session.AuthLevelNone, ErrTotpRequired
+		}
+
+		if err := as.totpService.Verify(ctx, user, code, recoveryCode); err != nil {
+			return session.AuthLevelNone, err
+		}
+		return session.AuthLevelMultiFactor, nil
+	case user.IsTwoFactorEnabled:
+		if code == "" {
+			if err := as.twoFactorService.SendCode(ctx, user); err != nil {
+				return session.AuthLevelNone, fmt.Errorf("failed to send two-factor code: %w", err)
+			}
+			return session.AuthLevelNone, ErrTwoFactorRequired
+		}
+
+		if err := as.twoFactorService.VerifyCode(ctx, user, code); err != nil {
+			return session.AuthLevelNone, err
+		}
+		return session.AuthLevelMultiFactor, nil
+	default:
+		return session.AuthLevelSingleFactor, nil
+	}
+}
+
+// Confirms identity of signed in user making sensitive change with current
+// password or second factor code: authenticator app's one for users with it,
+// emailed one otherwise. Without either users with authenticator app get
+// ErrTotpRequired, others get ErrTwoFactorRequired and code by email. Wrong
+// answers are throttled like failed logins from ip.
+func (as *AuthService) ConfirmIdentity(ctx context.Context, user *entities.User, ip string,
+	password string, code string) error {
+	switch {
+	case password != "":
+		return confirmThrottled(ctx, as.loginAttemptService, user, ip, func() error {
+			if !as.userServise.VerifyPassword(user, password) {
+				return ErrWrongPassword
+			}
+			return nil
+		})
+	case code != "":
+		return confirmThrottled(ctx, as.loginAttemptService, user, ip, func() error {
+			if user.IsTotpEnabled {
+				return as.totpService.Verify(ctx, user, code, "")
+			}
+			return as.twoFactorService.VerifyCode(ctx, user, code)
+		})
+	case user.IsTotpEnabled:
+		return ErrTotpRequired
+	default:
+		if err := as.twoFactorService.SendCode(ctx, user); err != nil {
+			return fmt.Errorf("failed to send two-factor code: %w", err)
+		}
+		return ErrTwoFactorRequired
+	}
 }
 
 func (as *AuthService) Logout(w http.ResponseWriter, r *http.Request) error {
@@ -79,12 +418,67 @@ func (as *AuthService) Logout(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func (as *AuthService) SaveSession(user *entities.User, w http.ResponseWriter) error {
-	sessionData := map[string]interface{}{
-		"userID": user.ID,
+// Checks that user proven by other means than password, e.g. a passkey, may
+// start a session: login of the account isn't locked and email is verified if
+// Login requires it.
+func (as *AuthService) CheckLoginAllowed(ctx context.Context, user *entities.User, ip string) error {
+	if err := as.checkLoginAttempts(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	if !as.canLogin(user) {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func (as *AuthService) canLogin(user *entities.User) bool {
+	return !as.options.RequireEmailVerification || user.Method != entities.Credentials || user.IsEmailVerified
+}
+
+// Login isn't throttled without loginAttemptService. Counter failures let
+// login through rather than lock everyone out.
+func (as *AuthService) checkLoginAttempts(ctx context.Context, email string, ip string) error {
+	if as.loginAttemptService == nil {
+		return nil
+	}
+
+	err := as.loginAttemptService.Check(ctx, email, ip)
+	if errors.Is(err, ErrLoginLocked) {
+		return err
+	}
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	return nil
+}
+
+func (as *AuthService) recordFailedLogin(ctx context.Context, user *entities.User, email string, ip string) {
+	if as.loginAttemptService == nil {
+		return
+	}
+	if err := as.loginAttemptService.RecordFailure(ctx, user, email, ip); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+func (as *AuthService) recordSuccessfulLogin(ctx context.Context, email string) {
+	if as.loginAttemptService == nil {
+		return
+	}
+	if err := as.loginAttemptService.RecordSuccess(ctx, email); err != nil {
+		slog.Error(err.Error())
 	}
+}
 
-	_, err := as.sessionManager.CreateSession(w, sessionData)
+// Starts session of the user. level tells how the user proved identity.
+func (as *AuthService) SaveSession(user *entities.User, level session.AuthLevel, w http.ResponseWriter, r *http.Request) error {
+	sess := &session.Session{
+		UserID:    user.ID,
+		AuthLevel: level,
+	}
+	setSessionEpoch(sess, user.SessionEpoch)
+
+	_, err := as.sessionManager.CreateSession(w, r, sess)
 	if err != nil {
 		return fmt.Errorf("failed to save session: %w", err)
 	}
@@ -92,15 +486,7 @@ func (as *AuthService) SaveSession(user *entities.User, w http.ResponseWriter) e
 	return nil
 }
 
+// Returns ValidationError listing invalid fields of dto.
 func (as *AuthService) ValidateDto(dto interface{}) error {
-	if err := as.validate.Struct(dto); err != nil {
-		var errorMessages []string
-		for _, validationErr := range err.(validator.ValidationErrors) {
-			errorMessages = append(errorMessages,
-				fmt.Sprintf("Field '%s' failed validation. Rule: '%s', Value: '%v'",
-					validationErr.Field(), validationErr.Tag(), validationErr.Value()))
-		}
-		return errors.New("validation failed: " + strings.Join(errorMessages, ", "))
-	}
-	return nil
+	return as.validator.Validate(dto)
 }
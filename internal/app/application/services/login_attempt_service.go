@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/web/templates"
+)
+
+var ErrLoginLocked = errors.New("too many failed login attempts. Please try again later")
+
+// Returned while account or IP can't login. Matches ErrLoginLocked.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+const (
+	accountAttemptsPrefix = "login_attempts:account:"
+	ipAttemptsPrefix      = "login_attempts:ip:"
+)
+
+// Throttles password guessing. Attempts are counted by email whether such user
+// exists or not, so locks don't reveal registered emails.
+type LoginAttemptService struct {
+	counter interfaces.AttemptCounter
+	mailer  interfaces.Mailer
+	options *config.LoginThrottleOptions
+}
+
+func NewLoginAttemptService(counter interfaces.AttemptCounter, mailer interfaces.Mailer,
+	options *config.LoginThrottleOptions) *LoginAttemptService {
+	return &LoginAttemptService{
+		counter: counter,
+		mailer:  mailer,
+		options: options,
+	}
+}
+
+// Returns LoginLockedError if login with email or from ip is locked.
+func (las *LoginAttemptService) Check(ctx context.Context, email string, ip string) error {
+	retryAfter := 0
+	for _, key := range []string{accountKey(email), ipAttemptsPrefix + ip} {
+		lockedFor, err := las.counter.LockedFor(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check login lock: %w", err)
+		}
+		retryAfter = max(retryAfter, lockedFor)
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+	return nil
+}
+
+// Counts failed login and delays or locks further attempts. user is nil if
+// there is no user with email. Owner of a locked account is notified by email.
+func (las *LoginAttemptService) RecordFailure(ctx context.Context, user *entities.User, email string, ip string) error {
+	key := accountKey(email)
+	attempts, err := las.counter.Increment(ctx, key, las.options.Window)
+	if err != nil {
+		return fmt.Errorf("failed to count login attempt: %w", err)
+	}
+
+	if attempts >= las.options.MaxAttempts {
+		if err := las.lock(ctx, key); err != nil {
+			return err
+		}
+		if user != nil {
+			if err := las.sendLockoutMail(ctx, user); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	} else if delay := las.delay(attempts); delay > 0 {
+		if err := las.counter.Lock(ctx, key, delay); err != nil {
+			return fmt.Errorf("failed to delay login: %w", err)
+		}
+	}
+
+	key = ipAttemptsPrefix + ip
+	attempts, err = las.counter.Increment(ctx, key, las.options.Window)
+	if err != nil {
+		return fmt.Errorf("failed to count login attempt: %w", err)
+	}
+	if attempts >= las.options.MaxAttemptsPerIP {
+		return las.lock(ctx, key)
+	}
+
+	return nil
+}
+
+// Forgets failed attempts of the account. Attempts from IP are kept, so
+// attacker can't reset them by logging into own account.
+func (las *LoginAttemptService) RecordSuccess(ctx context.Context, email string) error {
+	if err := las.counter.Reset(ctx, accountKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// Runs check of current password or second factor code a signed in user
+// confirms sensitive change with. Wrong answers count as failed logins of the
+// account and LoginLockedError is returned while it's locked, so a stolen
+// session can't be used to guess them. Nothing is throttled if las is nil.
+func confirmThrottled(ctx context.Context, las *LoginAttemptService, user *entities.User, ip string,
+	check func() error) error {
+	if las != nil {
+		err := las.Check(ctx, user.Email, ip)
+		if errors.Is(err, ErrLoginLocked) {
+			return err
+		}
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	}
+
+	err := check()
+	if las != nil && (errors.Is(err, ErrWrongPassword) || isWrongSecondFactor(err)) {
+		if err := las.RecordFailure(ctx, user, user.Email, ip); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+	return err
+}
+
+// Locks key and starts counting its attempts anew.
+func (las *LoginAttemptService) lock(ctx context.Context, key string) error {
+	if err := las.counter.Lock(ctx, key, las.options.LockoutDuration); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	if err := las.counter.Reset(ctx, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// Returns seconds next attempt is delayed for after given number of failures.
+func (las *LoginAttemptService) delay(attempts int) int {
+	if las.options.DelayBase <= 0 {
+		return 0
+	}
+
+	delay := las.options.DelayBase
+	for i := 1; i < attempts && delay < las.options.LockoutDuration; i++ {
+		delay *= 2
+	}
+	return min(delay, las.options.LockoutDuration)
+}
+
+func (las *LoginAttemptService) sendLockoutMail(ctx context.Context, user *entities.User) error {
+	lockedFor := formatTTL(time.Duration(las.options.LockoutDuration) * time.Second)
+	mail, err := newMail(ctx, user.Email, "Login temporarily locked",
+		fmt.Sprintf("Hi %s,\n\nWe've noticed several failed attempts to login to your account, "+
+			"so login is locked for %s.\n\n"+
+			"If it wasn't you, someone may be guessing your password. Consider changing it once you can login again.\n",
+			user.Name, lockedFor),
+		templates.LockoutMail(user.Name, lockedFor))
+	if err != nil {
+		return err
+	}
+
+	if err := las.mailer.Send(ctx, mail); err != nil {
+		return fmt.Errorf("failed to send lockout notification: %w", err)
+	}
+	return nil
+}
+
+// Emails differing in case belong to the same account.
+func accountKey(email string) string {
+	return accountAttemptsPrefix + strings.ToLower(email)
+}
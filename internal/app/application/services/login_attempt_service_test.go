@@ -0,0 +1,192 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/attempts"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/internal/pkg/test/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoginAttemptService(t *testing.T, options *config.LoginThrottleOptions) (*services.LoginAttemptService, *[]*dtos.MailDto) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	var sentMails []*dtos.MailDto
+	mailer := mock.NewMockMailer(ctrl)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, mail *dtos.MailDto) error {
+		sentMails = append(sentMails, mail)
+		return nil
+	}).AnyTimes()
+
+	counter := attempts.NewMemoryCounter(context.Background(), 0)
+	return services.NewLoginAttemptService(counter, mailer, options), &sentMails
+}
+
+func assertLockedFor(t *testing.T, err error, expected time.Duration) {
+	t.Helper()
+
+	var locked *services.LoginLockedError
+	require.ErrorAs(t, err, &locked)
+	assert.ErrorIs(t, err, services.ErrLoginLocked)
+	assert.InDelta(t, expected.Seconds(), locked.RetryAfter.Seconds(), 1)
+}
+
+func TestLoginAttemptService_ProgressiveDelayAndLockout(t *testing.T) {
+	t.Parallel()
+
+	las, sentMails := newLoginAttemptService(t, &config.LoginThrottleOptions{
+		MaxAttempts:      4,
+		MaxAttemptsPerIP: 100,
+		Window:           900,
+		LockoutDuration:  600,
+		DelayBase:        2,
+	})
+	ctx := context.Background()
+	user := &entities.User{Email: "User@Example.com", Name: "User"}
+
+	require.NoError(t, las.Check(ctx, user.Email, "203.0.113.7"))
+
+	for i, expectedDelay := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		require.NoError(t, las.RecordFailure(ctx, user, user.Email, "203.0.113.7"))
+		assertLockedFor(t, las.Check(ctx, user.Email, "198.51.100.1"), expectedDelay)
+		assert.Empty(t, *sentMails, "Owner shouldn't be notified before lockout, attempt %d", i+1)
+	}
+
+	require.NoError(t, las.RecordFailure(ctx, user, "user@example.com", "203.0.113.7"))
+	assertLockedFor(t, las.Check(ctx, user.Email, "198.51.100.1"), 10*time.Minute)
+	require.Len(t, *sentMails, 1, "Owner should be notified about lockout")
+	assert.Equal(t, []string{user.Email}, (*sentMails)[0].To)
+	assert.Contains(t, (*sentMails)[0].TextBody, "10 minutes")
+
+	require.NoError(t, las.Check(ctx, "other@example.com", "203.0.113.7"), "Other accounts shouldn't be locked")
+}
+
+func TestLoginAttemptService_UnknownEmail(t *testing.T) {
+	t.Parallel()
+
+	las, sentMails := newLoginAttemptService(t, &config.LoginThrottleOptions{
+		MaxAttempts:      2,
+		MaxAttemptsPerIP: 100,
+		Window:           900,
+		LockoutDuration:  600,
+	})
+	ctx := context.Background()
+	email := uuid.NewString() + "@example.com"
+
+	require.NoError(t, las.RecordFailure(ctx, nil, email, "203.0.113.7"))
+	require.NoError(t, las.Check(ctx, email, "203.0.113.7"), "No delay should be applied without DelayBase")
+	require.NoError(t, las.RecordFailure(ctx, nil, email, "203.0.113.7"))
+
+	assertLockedFor(t, las.Check(ctx, email, "203.0.113.7"), 10*time.Minute)
+	assert.Empty(t, *sentMails, "There is no one to notify")
+}
+
+func TestLoginAttemptService_IPLockout(t *testing.T) {
+	t.Parallel()
+
+	las, _ := newLoginAttemptService(t, &config.LoginThrottleOptions{
+		MaxAttempts:      100,
+		MaxAttemptsPerIP: 3,
+		Window:           900,
+		LockoutDuration:  300,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, las.RecordFailure(ctx, nil, uuid.NewString()+"@example.com", "203.0.113.7"))
+	}
+
+	assertLockedFor(t, las.Check(ctx, "victim@example.com", "203.0.113.7"), 5*time.Minute)
+	require.NoError(t, las.Check(ctx, "victim@example.com", "198.51.100.1"), "Other IPs shouldn't be locked")
+}
+
+func TestLoginAttemptService_SuccessResetsAccount(t *testing.T) {
+	t.Parallel()
+
+	las, _ := newLoginAttemptService(t, &config.LoginThrottleOptions{
+		MaxAttempts:      2,
+		MaxAttemptsPerIP: 100,
+		Window:           900,
+		LockoutDuration:  600,
+	})
+	ctx := context.Background()
+	email := "user@example.com"
+
+	require.NoError(t, las.RecordFailure(ctx, nil, email, "203.0.113.7"))
+	require.NoError(t, las.RecordSuccess(ctx, email))
+	require.NoError(t, las.RecordFailure(ctx, nil, email, "203.0.113.7"))
+
+	require.NoError(t, las.Check(ctx, email, "203.0.113.7"), "Failures before successful login shouldn't count")
+}
+
+func TestLoginAttemptService_ThrottlesPasswordConfirmation(t *testing.T) {
+	t.Parallel()
+
+	las, _ := newLoginAttemptService(t, &config.LoginThrottleOptions{
+		MaxAttempts:      2,
+		MaxAttemptsPerIP: 100,
+		Window:           900,
+		LockoutDuration:  600,
+	})
+	userService := services.NewUserService(nil, test.NewPasswordHasher())
+	twoFactorService := services.NewTwoFactorService(userService, nil, nil, las, &config.AuthOptions{})
+	ctx := context.Background()
+
+	user := &entities.User{ID: uuid.NewString(), Email: "user@example.com", Name: "User", IsTwoFactorEnabled: true}
+	require.NoError(t, userService.SetPassword(user, "current-password"))
+
+	disable := func(password string) error {
+		return twoFactorService.SetEnabled(ctx, user, "203.0.113.7",
+			dtos.TwoFactorSettingsDto{Enabled: false, CurrentPassword: password})
+	}
+
+	assert.ErrorIs(t, disable("wrong-password"), services.ErrWrongPassword)
+	assert.ErrorIs(t, disable("wrong-password"), services.ErrWrongPassword)
+
+	assertLockedFor(t, disable("current-password"), 10*time.Minute)
+	assertLockedFor(t, las.Check(ctx, user.Email, "198.51.100.1"), 10*time.Minute)
+}
+
+func TestLoginAttemptService_LockoutMailDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		lockout  int
+		expected string
+	}{
+		{lockout: 60, expected: "locked for 1 minute."},
+		{lockout: 3600, expected: "locked for 1 hour."},
+		{lockout: 5400, expected: "locked for 1 hour and 30 minutes."},
+		{lockout: 7265, expected: "locked for 2 hours, 1 minute and 5 seconds."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			t.Parallel()
+
+			las, sentMails := newLoginAttemptService(t, &config.LoginThrottleOptions{
+				MaxAttempts:      1,
+				MaxAttemptsPerIP: 100,
+				Window:           900,
+				LockoutDuration:  tt.lockout,
+			})
+			user := &entities.User{Email: uuid.NewString() + "@example.com", Name: "User"}
+
+			require.NoError(t, las.RecordFailure(context.Background(), user, user.Email, "203.0.113.7"))
+
+			require.Len(t, *sentMails, 1)
+			assert.Contains(t, (*sentMails)[0].TextBody, tt.expected)
+		})
+	}
+}
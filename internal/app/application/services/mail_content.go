@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/a-h/templ"
+)
+
+// Builds mail with plain text body and HTML alternative rendered from template.
+func newMail(ctx context.Context, to string, subject string, textBody string, html templ.Component) (*dtos.MailDto, error) {
+	var htmlBody strings.Builder
+	if err := html.Render(ctx, &htmlBody); err != nil {
+		return nil, fmt.Errorf("failed to render %q mail: %w", subject, err)
+	}
+
+	return &dtos.MailDto{
+		To:       []string{to},
+		Subject:  subject,
+		TextBody: textBody,
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oauth provider")
+	// Callback state, authorization code or provider's response was rejected.
+	ErrOAuthFailed = errors.New("oauth authorization failed")
+	// Provider account's email belongs to existing user, but provider doesn't
+	// assert it's verified, so the account may only be linked by signed in user.
+	ErrOAuthEmailNotVerified = errors.New("email is not verified by oauth provider")
+	// Provider account is linked to another user than the signed in one.
+	ErrOAuthAccountLinkedToOtherUser = errors.New("account already linked to another user")
+	// User already has another account of the provider linked.
+	ErrOAuthProviderAlreadyLinked = errors.New("another account of this provider is already linked")
+)
+
+const (
+	oauthAccountType = "oauth"
+	// Cookie holding pending authorization request between connect and callback.
+	oauthFlowCookieName = "oauth_flow"
+	oauthFlowTTLSeconds = 600
+)
+
+type OAuthService struct {
+	userService       *UserService
+	accountRepository interfaces.AccountRepository
+	providerService   *ProviderService
+	authService       *AuthService
+	sessionManager    *session.SessionManager
+}
+
+func NewOAuthService(userService *UserService, accountRepository interfaces.AccountRepository,
+	providerService *ProviderService, authService *AuthService, sessionManager *session.SessionManager) *OAuthService {
+	return &OAuthService{
+		userService:       userService,
+		accountRepository: accountRepository,
+		providerService:   providerService,
+		authService:       authService,
+		sessionManager:    sessionManager,
+	}
+}
+
+// Returns provider's consent page URL the user should be redirected to. Generated
+// state, nonce and PKCE code verifier are stored in a short-lived pre-auth session.
+func (oas *OAuthService) AuthURL(providerName string, w http.ResponseWriter, r *http.Request) (string, error) {
+	provider := oas.providerService.GetServiceByName(providerName)
+	if provider == nil {
+		return "", ErrUnknownProvider
+	}
+
+	flow := dtos.OAuthStateDto{Provider: providerName}
+	var err error
+	if flow.State, err = auth.NewState(); err != nil {
+		return "", err
+	}
+	if flow.CodeVerifier, err = auth.NewCodeVerifier(); err != nil {
+		return "", err
+	}
+	if flow.Nonce, err = auth.NewNonce(); err != nil {
+		return "", err
+	}
+
+	err = oas.sessionManager.CreateTransientSession(w, r, oauthFlowCookieName, map[string]string{
+		"provider":     flow.Provider,
+		"state":        flow.State,
+		"codeVerifier": flow.CodeVerifier,
+		"nonce":        flow.Nonce,
+	}, oauthFlowTTLSeconds)
+	if err != nil {
+		return "", fmt.Errorf("failed to save oauth state: %w", err)
+	}
+
+	return provider.AuthURL(flow), nil
+}
+
+// Validates callback state, exchanges authorization code for provider tokens and
+// profile, finds or creates matching user, links provider account to it and starts
+// a new session. Returns ErrOAuthFailed if provider didn't authorize the user
+// and ErrOAuthEmailNotVerified if the account can only be
+// linked by signed in user. Users with second factor get ErrTotpRequired or
+// ErrTwoFactorRequired and finish login with AuthService.CompleteLogin.
+func (oas *OAuthService) Authenticate(providerName string, code string, state string,
+	w http.ResponseWriter, r *http.Request) (*entities.User, error) {
+	// State is single-use, so it's dropped whatever the outcome.
+	values, err := oas.sessionManager.PopTransientSession(w, r, oauthFlowCookieName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oauth state: %w", err)
+	}
+
+	provider := oas.providerService.GetServiceByName(providerName)
+	if provider == nil {
+		return nil, ErrUnknownProvider
+	}
+	expected := dtos.OAuthStateDto{
+		Provider:     values["provider"],
+		State:        values["state"],
+		CodeVerifier: values["codeVerifier"],
+		Nonce:        values["nonce"],
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	profile, err := auth.FindUserByCode(ctx, provider, code, state, expected)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrOAuthFailed, providerName, err)
+	}
+
+	current, err := oas.currentUser(ctx, w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := oas.findOrCreateUser(ctx, profile, provider.Method(), current)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := oas.linkAccount(ctx, user, profile); err != nil {
+		return nil, err
+	}
+
+	// Signed in user connecting another provider keeps the session.
+	if current != nil && current.ID == user.ID {
+		return user, nil
+	}
+
+	if err := oas.authService.StartLogin(ctx, user, w, r); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Drops state of OAuth flow started by AuthURL when callback doesn't get to
+// Authenticate, e.g. provider refused authorization.
+func (oas *OAuthService) CancelFlow(w http.ResponseWriter, r *http.Request) {
+	if _, err := oas.sessionManager.PopTransientSession(w, r, oauthFlowCookieName); err != nil {
+		slog.Warn("Failed to drop oauth state", "error", err)
+	}
+}
+
+// Returns user of the session request is made with or nil if there is none.
+func (oas *OAuthService) currentUser(ctx context.Context, w http.ResponseWriter, r *http.Request) (*entities.User, error) {
+	sess, err := oas.sessionManager.GetSession(w, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if sess == nil || sess.UserID == "" || sess.AuthLevel < session.AuthLevelSingleFactor {
+		return nil, nil
+	}
+
+	user, err := oas.userService.FindByID(ctx, sess.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session user: %w", err)
+	}
+	return user, nil
+}
+
+// Provider account already linked determines the user, unless it belongs to
+// another user than the signed in one. Otherwise it's linked to signed in user,
+// to existing user with the same email if provider verified it, or to a new user.
+func (oas *OAuthService) findOrCreateUser(ctx context.Context, profile dtos.OAuthUserDto,
+	method entities.AuthMethod, current *entities.User) (*entities.User, error) {
+	account, err := oas.accountRepository.GetByProviderAccountID(ctx, profile.Provider, profile.ID)
+	if err == nil {
+		if current != nil && current.ID != account.UserID {
+			return nil, ErrOAuthAccountLinkedToOtherUser
+		}
+		user, err := oas.userService.FindByID(ctx, account.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s account user: %w", profile.Provider, err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check account existence: %w", err)
+	}
+
+	if current != nil {
+		return current, nil
+	}
+
+	user, err := oas.userService.FindByEmail(ctx, profile.Email)
+	if err == nil {
+		if !profile.EmailVerified {
+			return nil, ErrOAuthEmailNotVerified
+		}
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check user existence: %w", err)
+	}
+
+	user, err = oas.userService.CreateUser(ctx, profile.Email, "", profile.Name, profile.Picture, method, profile.EmailVerified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new user: %w", err)
+	}
+
+	return user, nil
+}
+
+// Saves provider account of the user or refreshes its tokens. Returns
+// ErrOAuthProviderAlreadyLinked if user has another account of the provider.
+func (oas *OAuthService) linkAccount(ctx context.Context, user *entities.User, profile dtos.OAuthUserDto) error {
+	now := time.Now().UTC()
+
+	account, err := oas.accountRepository.GetByUserIDAndProvider(ctx, user.ID, profile.Provider)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to check account existence: %w", err)
+		}
+
+		account = &entities.Account{
+			ID:                uuid.NewString(),
+			Type:              oauthAccountType,
+			Provider:          profile.Provider,
+			ProviderAccountID: profile.ID,
+			UserID:            user.ID,
+			RefreshToken:      profile.RefreshToken,
+			AccessToken:       profile.AccessToken,
+			ExpiresAt:         int(profile.ExpiresAt),
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		if err := oas.accountRepository.Save(ctx, account); err != nil {
+			return fmt.Errorf("failed to save %s account: %w", profile.Provider, err)
+		}
+		return nil
+	}
+
+	// Accounts linked before provider account IDs were stored get one here.
+	if account.ProviderAccountID == "" {
+		account.ProviderAccountID = profile.ID
+	}
+	if account.ProviderAccountID != profile.ID {
+		return ErrOAuthProviderAlreadyLinked
+	}
+	account.AccessToken = profile.AccessToken
+	// Providers usually issue refresh token only on first consent.
+	if profile.RefreshToken != "" {
+		account.RefreshToken = profile.RefreshToken
+	}
+	account.ExpiresAt = int(profile.ExpiresAt)
+	account.UpdatedAt = now
+	if err := oas.accountRepository.Update(ctx, account); err != nil {
+		return fmt.Errorf("failed to update %s account: %w", profile.Provider, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/pkg/putils"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/jackc/pgconn"
+)
+
+var (
+	ErrPasskeyCeremonyExpired    = errors.New("passkey ceremony has expired or wasn't started. Please try again")
+	ErrPasskeyAlreadyRegistered  = errors.New("this passkey is already registered")
+	ErrPasskeySignCountRegressed = errors.New("passkey was rejected because it may have been cloned. Please use another sign in method")
+)
+
+const (
+	// Cookies holding ceremony state between begin and finish requests.
+	passkeyRegistrationCookieName = "webauthn_registration"
+	passkeyLoginCookieName        = "webauthn_login"
+	passkeyCeremonyTTLSeconds     = 300
+)
+
+type PasskeyService struct {
+	userService          *UserService
+	credentialRepository interfaces.CredentialRepository
+	verifier             *auth.PasskeyVerifier
+	authService          *AuthService
+	sessionManager       *session.SessionManager
+}
+
+func NewPasskeyService(userService *UserService, credentialRepository interfaces.CredentialRepository,
+	verifier *auth.PasskeyVerifier, authService *AuthService, sessionManager *session.SessionManager) *PasskeyService {
+	return &PasskeyService{
+		userService:          userService,
+		credentialRepository: credentialRepository,
+		verifier:             verifier,
+		authService:          authService,
+		sessionManager:       sessionManager,
+	}
+}
+
+// Returns options for navigator.credentials.create() once user confirmed
+// identity, see AuthService.ConfirmIdentity. Passkey logs in with multiple
+// factors, so a hijacked session alone mustn't be able to add one. Ceremony
+// state is kept in a short-lived pre-auth session bound to the user, so
+// registration can't be finished without it.
+func (ps *PasskeyService) BeginRegistration(ctx context.Context, user *entities.User, dto dtos.PasskeyRegistrationDto,
+	w http.ResponseWriter, r *http.Request) (*protocol.CredentialCreation, error) {
+	err := ps.authService.ConfirmIdentity(ctx, user, putils.ClientIP(r), dto.CurrentPassword, dto.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := ps.credentialRepository.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch passkeys: %w", err)
+	}
+
+	creation, state, err := ps.verifier.BeginRegistration(user, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ps.sessionManager.CreateTransientSession(w, r, passkeyRegistrationCookieName, map[string]string{
+		"userID": user.ID,
+		"state":  string(state),
+	}, passkeyCeremonyTTLSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save passkey ceremony state: %w", err)
+	}
+
+	return creation, nil
+}
+
+// Verifies authenticator's response to registration options and stores new passkey.
+func (ps *PasskeyService) FinishRegistration(ctx context.Context, user *entities.User, response []byte,
+	w http.ResponseWriter, r *http.Request) (*entities.Credential, error) {
+	state, err := ps.popCeremonyState(w, r, passkeyRegistrationCookieName)
+	if err != nil {
+		return nil, err
+	}
+	if state["userID"] != user.ID {
+		return nil, ErrPasskeyCeremonyExpired
+	}
+
+	credentials, err := ps.credentialRepository.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch passkeys: %w", err)
+	}
+
+	credential, err := ps.verifier.FinishRegistration(user, credentials, []byte(state["state"]), response)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ps.credentialRepository.Save(ctx, credential); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationPgCode {
+			return nil, ErrPasskeyAlreadyRegistered
+		}
+		return nil, fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	return credential, nil
+}
+
+// Returns options for navigator.credentials.get(). Any discoverable passkey
+// of any user is accepted, so no email has to be entered.
+func (ps *PasskeyService) BeginLogin(w http.ResponseWriter, r *http.Request) (*protocol.CredentialAssertion, error) {
+	assertion, state, err := ps.verifier.BeginLogin()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ps.sessionManager.CreateTransientSession(w, r, passkeyLoginCookieName, map[string]string{
+		"state": string(state),
+	}, passkeyCeremonyTTLSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save passkey ceremony state: %w", err)
+	}
+
+	return assertion, nil
+}
+
+// Verifies authenticator's assertion and starts a new session for passkey's
+// owner. Passkey is possession and, as user verification is required,
+// knowledge or inherence at once, so no second factor is asked for.
+func (ps *PasskeyService) FinishLogin(response []byte, w http.ResponseWriter, r *http.Request) (*entities.User, error) {
+	state, err := ps.popCeremonyState(w, r, passkeyLoginCookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lookup := func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+		user, err := ps.userService.FindByID(ctx, string(userHandle))
+		if err != nil {
+			return nil, nil, err
+		}
+		credentials, err := ps.credentialRepository.GetByUserID(ctx, user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return user, credentials, nil
+	}
+
+	user, credential, err := ps.verifier.FinishLogin([]byte(state["state"]), response, lookup)
+	if errors.Is(err, auth.ErrSignCountRegressed) {
+		slog.Warn("passkey sign count regressed", "user_id", user.ID, "credential_id", credential.ID)
+		return nil, ErrPasskeySignCountRegressed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Passkey can't be a way around lockout or email verification of Login.
+	if err := ps.authService.CheckLoginAllowed(ctx, user, putils.ClientIP(r)); err != nil {
+		return nil, err
+	}
+
+	if err := ps.credentialRepository.UpdateUsage(ctx, credential); err != nil {
+		return nil, fmt.Errorf("failed to update passkey usage: %w", err)
+	}
+
+	if err := ps.authService.SaveSession(user, session.AuthLevelMultiFactor, w, r); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (ps *PasskeyService) popCeremonyState(w http.ResponseWriter, r *http.Request, name string) (map[string]string, error) {
+	values, err := ps.sessionManager.PopTransientSession(w, r, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkey ceremony state: %w", err)
+	}
+
+	if values["state"] == "" {
+		return nil, ErrPasskeyCeremonyExpired
+	}
+
+	return values, nil
+}
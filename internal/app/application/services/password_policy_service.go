@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+)
+
+var ErrWeakPassword = errors.New("password doesn't satisfy password policy")
+
+// Lists every rule the password broke, so all of them can be fixed at once.
+type PasswordPolicyError struct {
+	Errors []dtos.FieldError
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Message
+	}
+	return ErrWeakPassword.Error() + ": " + strings.Join(messages, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Parts of email and name shorter than this aren't looked for in passwords.
+const minPersonalInfoLength = 3
+
+type PasswordPolicyService struct {
+	breached interfaces.BreachedPasswords
+	options  *config.PasswordPolicyOptions
+}
+
+// Breached passwords aren't checked without breached.
+func NewPasswordPolicyService(breached interfaces.BreachedPasswords, options *config.PasswordPolicyOptions) *PasswordPolicyService {
+	return &PasswordPolicyService{
+		breached: breached,
+		options:  options,
+	}
+}
+
+// Checks new password of the user with email and name. Returns
+// PasswordPolicyError listing broken rules. Failed breach lookup lets the
+// password through rather than block password changes. Nil service accepts
+// every password.
+func (ps *PasswordPolicyService) Check(ctx context.Context, password, email, name string) error {
+	if ps == nil {
+		return nil
+	}
+
+	var errs []dtos.FieldError
+	add := func(code, message string) {
+		errs = append(errs, dtos.FieldError{Field: "password", Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < ps.options.MinLength {
+		add("too_short", fmt.Sprintf("must be at least %d characters long", ps.options.MinLength))
+	}
+	if ps.options.MaxLength > 0 && len(password) > ps.options.MaxLength {
+		add("too_long", fmt.Sprintf("must be at most %d bytes long", ps.options.MaxLength))
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case !unicode.IsLetter(c) && !unicode.IsSpace(c):
+			hasSymbol = true
+		}
+	}
+	if ps.options.RequireLower && !hasLower {
+		add("missing_lowercase", "must contain a lowercase letter")
+	}
+	if ps.options.RequireUpper && !hasUpper {
+		add("missing_uppercase", "must contain an uppercase letter")
+	}
+	if ps.options.RequireDigit && !hasDigit {
+		add("missing_digit", "must contain a digit")
+	}
+	if ps.options.RequireSymbol && !hasSymbol {
+		add("missing_symbol", "must contain a symbol")
+	}
+
+	if ps.options.ForbidPersonalInfo {
+		lowered := strings.ToLower(password)
+		if containsAny(lowered, emailParts(email)) {
+			add("contains_email", "must not contain your email")
+		}
+		if containsAny(lowered, strings.FieldsFunc(strings.ToLower(name), isNameSeparator)) {
+			add("contains_name", "must not contain your name")
+		}
+	}
+
+	breached, err := ps.isBreached(ctx, password)
+	if err != nil {
+		slog.Error("Failed to check breached passwords", "error", err)
+	}
+	if breached {
+		add("breached", "has appeared in a data breach, choose another one")
+	}
+
+	if len(errs) > 0 {
+		return &PasswordPolicyError{Errors: errs}
+	}
+	return nil
+}
+
+// Only first 5 characters of password's hash are looked up.
+func (ps *PasswordPolicyService) isBreached(ctx context.Context, password string) (bool, error) {
+	if ps.breached == nil || password == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := ps.breached.Range(ctx, hash[:5])
+	if err != nil {
+		return false, err
+	}
+	return suffixes[hash[5:]] > 0, nil
+}
+
+// Returns whole email and its local part.
+func emailParts(email string) []string {
+	email = strings.ToLower(email)
+	local, _, _ := strings.Cut(email, "@")
+	return []string{email, local}
+}
+
+func containsAny(s string, parts []string) bool {
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(s, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNameSeparator(c rune) bool {
+	return unicode.IsSpace(c) || c == '-' || c == '.' || c == '_'
+}
@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/breach"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SHA-1 of "password123".
+const breachedPasswords = "CBFDAC6008F9CAB4083784CBD1874F76618D2A97:2254650\n"
+
+type failingBreachedPasswords struct{}
+
+func (failingBreachedPasswords) Range(context.Context, string) (map[string]int, error) {
+	return nil, errors.New("source is down")
+}
+
+func policyViolations(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var policyErr *services.PasswordPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	assert.ErrorIs(t, err, services.ErrWeakPassword)
+
+	codes := make([]string, len(policyErr.Errors))
+	for i, fieldErr := range policyErr.Errors {
+		assert.Equal(t, "password", fieldErr.Field)
+		assert.NotEmpty(t, fieldErr.Message)
+		codes[i] = fieldErr.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicyService_Rules(t *testing.T) {
+	t.Parallel()
+
+	source, err := breach.ReadSource(strings.NewReader(breachedPasswords))
+	require.NoError(t, err)
+	ps := services.NewPasswordPolicyService(source, &config.PasswordPolicyOptions{
+		MinLength:          8,
+		MaxLength:          72,
+		RequireLower:       true,
+		RequireUpper:       true,
+		RequireDigit:       true,
+		RequireSymbol:      true,
+		ForbidPersonalInfo: true,
+	})
+	ctx := context.Background()
+	email, name := "jane.doe@example.com", "Mary Smith"
+
+	tests := []struct {
+		password   string
+		violations []string
+	}{
+		{"Tr0ub4dor&3", nil},
+		{"Sh0rt!", []string{"too_short"}},
+		{"Tr0ub4dor&3" + strings.Repeat("ё", 31), []string{"too_long"}},
+		{"troubadour", []string{"missing_uppercase", "missing_digit", "missing_symbol"}},
+		{"TROUB4DOR&3", []string{"missing_lowercase"}},
+		{"My-JANE.DOE-1", []string{"contains_email"}},
+		{"SmiTH&Wess0n", []string{"contains_name"}},
+		{"password123", []string{"missing_uppercase", "missing_symbol", "breached"}},
+	}
+
+	for _, tt := range tests {
+		err := ps.Check(ctx, tt.password, email, name)
+		assert.Equal(t, tt.violations, policyViolations(t, err), "Unexpected violations of %q", tt.password)
+	}
+}
+
+func TestPasswordPolicyService_BreachLookupFailure(t *testing.T) {
+	t.Parallel()
+
+	ps := services.NewPasswordPolicyService(failingBreachedPasswords{}, &config.PasswordPolicyOptions{MinLength: 8})
+
+	assert.NoError(t, ps.Check(context.Background(), "password123", "user@example.com", "User"),
+		"Failed lookup shouldn't block password changes")
+}
+
+func TestPasswordPolicyService_Nil(t *testing.T) {
+	t.Parallel()
+
+	var ps *services.PasswordPolicyService
+	assert.NoError(t, ps.Check(context.Background(), "x", "user@example.com", "User"))
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/web/templates"
+	"github.com/jackc/pgx/v4"
+)
+
+type PasswordResetService struct {
+	userService    *UserService
+	tokenService   *TokenService
+	passwordPolicy *PasswordPolicyService
+	mailer         interfaces.Mailer
+	sessionManager *session.SessionManager
+	baseURL        string
+}
+
+func NewPasswordResetService(userService *UserService, tokenService *TokenService, passwordPolicy *PasswordPolicyService,
+	mailer interfaces.Mailer, sessionManager *session.SessionManager, baseURL string) *PasswordResetService {
+	return &PasswordResetService{
+		userService:    userService,
+		tokenService:   tokenService,
+		passwordPolicy: passwordPolicy,
+		mailer:         mailer,
+		sessionManager: sessionManager,
+		baseURL:        baseURL,
+	}
+}
+
+// Issues password reset token for user's email and mails it to the user.
+func (ps *PasswordResetService) SendReset(ctx context.Context, user *entities.User) error {
+	token, err := ps.tokenService.Issue(ctx, user.Email, entities.PasswordReset)
+	if err != nil {
+		return err
+	}
+
+	link := ps.baseURL + "/auth/password/reset?token=" + url.QueryEscape(token.Token)
+	expiresIn := formatTTL(ps.tokenService.TTL(entities.PasswordReset))
+	mail, err := newMail(ctx, user.Email, "Reset your password",
+		fmt.Sprintf("Hi %s,\n\nWe've received a request to reset your password. "+
+			"To choose a new one follow the link below:\n%s\n\n"+
+			"The link expires in %s. If you didn't request a reset, just ignore this email.\n",
+			user.Name, link, expiresIn),
+		templates.PasswordResetMail(user.Name, link, expiresIn))
+	if err != nil {
+		return err
+	}
+
+	err = ps.mailer.Send(ctx, mail)
+	if err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// Sets new password for the user the token was issued for, deletes the token
+// and destroys all user's sessions. Password breaking password policy gives
+// PasswordPolicyError and keeps the token, so another password can be tried.
+// Sessions are revoked with every session storage, see revokeUserSessions.
+func (ps *PasswordResetService) Reset(ctx context.Context, token, password string) error {
+	stored, err := ps.tokenService.Validate(ctx, token, entities.PasswordReset)
+	if err != nil {
+		return err
+	}
+
+	user, err := ps.userService.FindByEmail(ctx, stored.UserEmail)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := ps.passwordPolicy.Check(ctx, password, user.Email, user.Name); err != nil {
+		return err
+	}
+	if err := ps.userService.SetPassword(user, password); err != nil {
+		return err
+	}
+
+	// Reset link could only be followed from the mailbox, so email is confirmed too.
+	user.IsEmailVerified = true
+	if err := ps.userService.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := ps.tokenService.Revoke(ctx, stored); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	if err := revokeUserSessions(ctx, ps.userService, ps.sessionManager, user, nil, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
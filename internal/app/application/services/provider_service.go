@@ -7,18 +7,18 @@ type ProviderService struct {
 }
 
 func NewProviderService(options *auth.OAuthServiceOptions) *ProviderService {
-	for i := range options.Services {
-		options.Services[i].BaseURL = options.BaseURL
+	for _, service := range options.Services {
+		service.SetBaseURL(options.BaseURL)
 	}
 	return &ProviderService{
 		options: options,
 	}
 }
 
-func (ps *ProviderService) GetServiceByName(name string) *auth.BaseOAuthService {
+func (ps *ProviderService) GetServiceByName(name string) auth.OAuthProvider {
 	for _, service := range ps.options.Services {
-		if service.Options().Name == name {
-			return &service
+		if service.Name() == name {
+			return service
 		}
 	}
 	return nil
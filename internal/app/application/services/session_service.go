@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// Key of session values holding user's session epoch the session was started in.
+const sessionEpochKey = "sessionEpoch"
+
+// Lets users see and revoke their sessions on other devices, and admins do
+// the same for any user.
+type SessionService struct {
+	userService    *UserService
+	sessionManager *session.SessionManager
+}
+
+func NewSessionService(userService *UserService, sessionManager *session.SessionManager) *SessionService {
+	return &SessionService{
+		userService:    userService,
+		sessionManager: sessionManager,
+	}
+}
+
+// Returns user's active sessions, the one r is made with is marked as current.
+func (ss *SessionService) List(ctx context.Context, userID string, r *http.Request) ([]dtos.SessionDto, error) {
+	return ss.sessionManager.ListUserSessions(ctx, userID, r)
+}
+
+// Revokes one of user's sessions by its ID as returned by List.
+func (ss *SessionService) Revoke(ctx context.Context, userID string, id string) error {
+	return ss.sessionManager.DestroyUserSession(ctx, userID, id)
+}
+
+// Revokes all user's sessions except the one r is made with.
+func (ss *SessionService) RevokeOthers(ctx context.Context, userID string, r *http.Request) error {
+	return ss.sessionManager.DestroyOtherUserSessions(ctx, userID, r)
+}
+
+func (ss *SessionService) ListForUser(ctx context.Context, userID string) ([]dtos.SessionDto, error) {
+	if err := ss.checkUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+	return ss.sessionManager.ListUserSessions(ctx, userID, nil)
+}
+
+func (ss *SessionService) RevokeForUser(ctx context.Context, userID string, id string) error {
+	if err := ss.checkUserExists(ctx, userID); err != nil {
+		return err
+	}
+	return ss.sessionManager.DestroyUserSession(ctx, userID, id)
+}
+
+// Revokes every session of the user, e.g. when account is compromised. Works
+// with every session storage, see revokeUserSessions.
+func (ss *SessionService) RevokeAllForUser(ctx context.Context, userID string) error {
+	user, err := ss.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return revokeUserSessions(ctx, ss.userService, ss.sessionManager, user, nil, nil)
+}
+
+func (ss *SessionService) checkUserExists(ctx context.Context, userID string) error {
+	_, err := ss.findUser(ctx, userID)
+	return err
+}
+
+func (ss *SessionService) findUser(ctx context.Context, userID string) (*entities.User, error) {
+	user, err := ss.userService.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	return user, nil
+}
+
+// Tells whether sess was started in user's current session epoch. Sessions
+// started before epochs were tracked count as started in the first one.
+func IsSessionCurrent(sess *session.Session, user *entities.User) bool {
+	epoch, _ := strconv.ParseInt(sess.Values[sessionEpochKey], 10, 64)
+	return epoch == user.SessionEpoch
+}
+
+func setSessionEpoch(sess *session.Session, epoch int64) {
+	if sess.Values == nil {
+		sess.Values = make(map[string]string)
+	}
+	sess.Values[sessionEpochKey] = strconv.FormatInt(epoch, 10)
+}
+
+// Revokes all user's sessions by moving the user to a new session epoch, which
+// works with client-side session storage too. Session of r, if given, is moved
+// along and stays valid. Revoked sessions are also dropped from storage if it
+// keeps them server-side.
+func revokeUserSessions(ctx context.Context, userService *UserService, sessionManager *session.SessionManager,
+	user *entities.User, w http.ResponseWriter, r *http.Request) error {
+	if err := userService.BumpSessionEpoch(ctx, user); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if r == nil {
+		err := sessionManager.DestroyUserSessions(ctx, user.ID)
+		if err != nil && !errors.Is(err, session.ErrSessionRevocationUnsupported) {
+			return fmt.Errorf("failed to destroy sessions: %w", err)
+		}
+		return nil
+	}
+
+	sess, err := sessionManager.GetSession(w, r)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess != nil {
+		setSessionEpoch(sess, user.SessionEpoch)
+		if err := sessionManager.UpdateSession(w, r, sess); err != nil {
+			return fmt.Errorf("failed to update session: %w", err)
+		}
+	}
+
+	err = sessionManager.DestroyOtherUserSessions(ctx, user.ID, r)
+	if err != nil && !errors.Is(err, session.ErrSessionRevocationUnsupported) {
+		return fmt.Errorf("failed to destroy other sessions: %w", err)
+	}
+	return nil
+}
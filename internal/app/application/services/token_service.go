@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrInvalidToken    = errors.New("token is invalid")
+	ErrTokenExpired    = errors.New("token has expired")
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+)
+
+const (
+	randomTokenBytes   = 32
+	numericTokenDigits = 6
+	// Short numeric tokens may collide with tokens issued for other users.
+	maxIssueAttempts      = 3
+	uniqueViolationPgCode = "23505"
+)
+
+type TokenService struct {
+	repository interfaces.TokenRepository
+	options    *config.TokenOptions
+}
+
+func NewTokenService(repository interfaces.TokenRepository, options *config.TokenOptions) *TokenService {
+	return &TokenService{
+		repository: repository,
+		options:    options,
+	}
+}
+
+// Returns lifetime of tokens of the given type.
+func (ts *TokenService) TTL(tokenType entities.TokenType) time.Duration {
+	switch tokenType {
+	case entities.TwoFactor:
+		return time.Duration(ts.options.TwoFactorTTL) * time.Second
+	case entities.PasswordReset:
+		return time.Duration(ts.options.PasswordResetTTL) * time.Second
+	default:
+		return time.Duration(ts.options.VerificationTTL) * time.Second
+	}
+}
+
+// Issues new token of the given type for email, replacing ones issued before.
+// Two-factor tokens are numeric codes that can be typed in, others are random
+// url-safe strings.
+func (ts *TokenService) Issue(ctx context.Context, email string, tokenType entities.TokenType) (*entities.Token, error) {
+	if err := ts.repository.DeleteByEmailAndType(ctx, email, tokenType); err != nil {
+		return nil, fmt.Errorf("failed to delete previous tokens: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		value, err := generateToken(tokenType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token: %w", err)
+		}
+
+		token := &entities.Token{
+			ID:        uuid.NewString(),
+			UserEmail: email,
+			Token:     value,
+			Type:      tokenType,
+			ExpiresIn: time.Now().UTC().Add(ts.TTL(tokenType)),
+		}
+		err = ts.repository.Save(ctx, token)
+		if err == nil {
+			return token, nil
+		}
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationPgCode || attempt == maxIssueAttempts {
+			return nil, fmt.Errorf("failed to save token: %w", err)
+		}
+	}
+}
+
+// Returns stored token if it exists and hasn't expired yet. Expired tokens are deleted.
+func (ts *TokenService) Validate(ctx context.Context, token string, tokenType entities.TokenType) (*entities.Token, error) {
+	stored, err := ts.repository.GetByToken(ctx, token, tokenType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+
+	if time.Now().After(stored.ExpiresIn) {
+		if err := ts.repository.Delete(ctx, stored.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete expired token: %w", err)
+		}
+		return nil, ErrTokenExpired
+	}
+
+	return stored, nil
+}
+
+// Checks code against the latest token of the type issued for email. Every
+// mismatch counts as failed attempt, the token is deleted once maxAttempts is reached.
+func (ts *TokenService) ValidateForEmail(ctx context.Context, email string, tokenType entities.TokenType,
+	code string, maxAttempts int) (*entities.Token, error) {
+	stored, err := ts.repository.GetByEmailAndType(ctx, email, tokenType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+
+	if time.Now().After(stored.ExpiresIn) {
+		if err := ts.repository.Delete(ctx, stored.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete expired token: %w", err)
+		}
+		return nil, ErrTokenExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored.Token), []byte(code)) == 1 {
+		return stored, nil
+	}
+
+	attempts, err := ts.repository.IncrementAttempts(ctx, stored.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed attempt: %w", err)
+	}
+	if attempts >= maxAttempts {
+		if err := ts.repository.Delete(ctx, stored.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete token: %w", err)
+		}
+		return nil, ErrTooManyAttempts
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func (ts *TokenService) Revoke(ctx context.Context, token *entities.Token) error {
+	return ts.repository.Delete(ctx, token.ID)
+}
+
+// Deletes all expired tokens and returns how many were deleted.
+func (ts *TokenService) PurgeExpired(ctx context.Context) (int64, error) {
+	return ts.repository.PurgeExpired(ctx, time.Now().UTC())
+}
+
+// Formats token lifetime for emails, e.g. "1 hour", "15 minutes" or
+// "1 hour and 30 minutes".
+func formatTTL(ttl time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+
+	var parts []string
+	for _, unit := range units {
+		n := int(ttl / unit.size)
+		ttl -= time.Duration(n) * unit.size
+		if n == 1 {
+			parts = append(parts, "1 "+unit.name)
+		} else if n > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return "0 seconds"
+	case 1:
+		return parts[0]
+	default:
+		return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+	}
+}
+
+func generateToken(tokenType entities.TokenType) (string, error) {
+	if tokenType == entities.TwoFactor {
+		return generateNumericToken(numericTokenDigits)
+	}
+	return generateRandomToken(randomTokenBytes)
+}
+
+func generateRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Generates uniformly distributed zero-padded code of given number of digits.
+func generateNumericToken(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
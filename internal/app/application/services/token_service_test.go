@@ -0,0 +1,132 @@
+package services_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/pkg/putils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	migrationsPath         string
+	absoluteMigrationsPath string
+)
+
+func TestMain(t *testing.M) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting current working directory: %v", err)
+	}
+
+	projRoot, err := putils.GetProjectRoot(cwd)
+	if err != nil {
+		log.Fatalf("Error finding project root: %v", err)
+	}
+
+	migrationsPath = test.MustGetEnv("POSTGRES_MIGRATIONS_PATH")
+	absoluteMigrationsPath = test.GetAbsolutePath(projRoot, migrationsPath)
+
+	os.Exit(t.Run())
+}
+
+func newTestTokenService(t *testing.T, options *config.TokenOptions) *services.TokenService {
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	return services.NewTokenService(postgres.NewPostgresTokenRepository(ptUtil.DB()), options)
+}
+
+func TestTokenService_Issue(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	options := &config.TokenOptions{
+		VerificationTTL:  86400,
+		TwoFactorTTL:     300,
+		PasswordResetTTL: 3600,
+	}
+	ts := newTestTokenService(t, options)
+
+	tests := []struct {
+		name      string
+		tokenType entities.TokenType
+		pattern   *regexp.Regexp
+		ttl       time.Duration
+	}{
+		{"Verification token is random", entities.Verification, regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`), 24 * time.Hour},
+		{"Two-factor token is numeric", entities.TwoFactor, regexp.MustCompile(`^[0-9]{6}$`), 5 * time.Minute},
+		{"Password reset token is random", entities.PasswordReset, regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`), time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			email := test.NewRandomUser().Email
+			issued, err := ts.Issue(ctx, email, tt.tokenType)
+			require.NoError(t, err, "Issue shouldn't return an error")
+			assert.Regexp(t, tt.pattern, issued.Token)
+			assert.Equal(t, tt.ttl, ts.TTL(tt.tokenType))
+			assert.WithinDuration(t, time.Now().Add(tt.ttl), issued.ExpiresIn, 5*time.Second)
+
+			validated, err := ts.Validate(ctx, issued.Token, tt.tokenType)
+			require.NoError(t, err, "Validate shouldn't return an error")
+			assert.Equal(t, issued.ID, validated.ID)
+
+			reissued, err := ts.Issue(ctx, email, tt.tokenType)
+			require.NoError(t, err, "Issue shouldn't return an error")
+
+			_, err = ts.Validate(ctx, issued.Token, tt.tokenType)
+			assert.ErrorIs(t, err, services.ErrInvalidToken, "Previous token should be replaced")
+
+			require.NoError(t, ts.Revoke(ctx, reissued))
+			_, err = ts.Validate(ctx, reissued.Token, tt.tokenType)
+			assert.ErrorIs(t, err, services.ErrInvalidToken, "Revoked token should be invalid")
+		})
+	}
+}
+
+func TestTokenService_Expired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Zero lifetime makes tokens expire right away.
+	ts := newTestTokenService(t, &config.TokenOptions{})
+
+	expired, err := ts.Issue(ctx, test.NewRandomUser().Email, entities.PasswordReset)
+	require.NoError(t, err, "Issue shouldn't return an error")
+
+	purged, err := ts.PurgeExpired(ctx)
+	require.NoError(t, err, "PurgeExpired shouldn't return an error")
+	assert.Equal(t, int64(1), purged)
+
+	_, err = ts.Validate(ctx, expired.Token, entities.PasswordReset)
+	assert.ErrorIs(t, err, services.ErrInvalidToken, "Purged token should be invalid")
+
+	expired, err = ts.Issue(ctx, test.NewRandomUser().Email, entities.Verification)
+	require.NoError(t, err, "Issue shouldn't return an error")
+
+	_, err = ts.Validate(ctx, expired.Token, entities.Verification)
+	assert.ErrorIs(t, err, services.ErrTokenExpired)
+
+	_, err = ts.Validate(ctx, expired.Token, entities.Verification)
+	assert.ErrorIs(t, err, services.ErrInvalidToken, "Expired token should be deleted on validation")
+}
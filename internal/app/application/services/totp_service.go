@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/pkg/security"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTotpAlreadyEnabled = errors.New("authenticator app is already enabled")
+	ErrTotpNotEnrolled    = errors.New("authenticator app enrollment wasn't started")
+	ErrTotpNotEnabled     = errors.New("authenticator app is not enabled")
+	ErrInvalidTotpCode    = errors.New("invalid authenticator code")
+)
+
+const (
+	// Codes of adjacent time steps are accepted to tolerate clock drift.
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TotpService struct {
+	userService         *UserService
+	recoveryCodes       interfaces.RecoveryCodeRepository
+	loginAttemptService *LoginAttemptService
+	options             *config.AuthOptions
+}
+
+func NewTotpService(userService *UserService, recoveryCodes interfaces.RecoveryCodeRepository,
+	loginAttemptService *LoginAttemptService, options *config.AuthOptions) *TotpService {
+	return &TotpService{
+		userService:         userService,
+		recoveryCodes:       recoveryCodes,
+		loginAttemptService: loginAttemptService,
+		options:             options,
+	}
+}
+
+// Generates new secret for user's authenticator app. The secret isn't used for
+// login until enrollment is confirmed with a code.
+func (ts *TotpService) BeginEnrollment(ctx context.Context, user *entities.User) (*dtos.TotpEnrollmentDto, error) {
+	if user.IsTotpEnabled {
+		return nil, ErrTotpAlreadyEnabled
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	encrypted, err := ts.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TotpSecret = encrypted
+	if err := ts.userService.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return &dtos.TotpEnrollmentDto{
+		Secret: secret,
+		URI:    security.TOTPURI(ts.options.TotpIssuer, user.Email, secret),
+	}, nil
+}
+
+// Enables authenticator app if code matches pending secret and returns fresh
+// recovery codes. Wrong codes are throttled like failed logins from ip.
+func (ts *TotpService) ConfirmEnrollment(ctx context.Context, user *entities.User, ip string, code string) ([]string, error) {
+	if user.IsTotpEnabled {
+		return nil, ErrTotpAlreadyEnabled
+	}
+	if user.TotpSecret == "" {
+		return nil, ErrTotpNotEnrolled
+	}
+
+	err := confirmThrottled(ctx, ts.loginAttemptService, user, ip, func() error {
+		return ts.checkCode(ctx, user, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.IsTotpEnabled = true
+	if err := ts.userService.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return ts.replaceRecoveryCodes(ctx, user)
+}
+
+// Replaces user's recovery codes with new ones. Requires code from
+// authenticator app, so leaked session alone can't be used to get codes.
+// Wrong codes are throttled like failed logins from ip.
+func (ts *TotpService) RegenerateRecoveryCodes(ctx context.Context, user *entities.User, ip string, code string) ([]string, error) {
+	if !user.IsTotpEnabled {
+		return nil, ErrTotpNotEnabled
+	}
+
+	err := confirmThrottled(ctx, ts.loginAttemptService, user, ip, func() error {
+		return ts.checkCode(ctx, user, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.replaceRecoveryCodes(ctx, user)
+}
+
+// Turns authenticator app off and deletes recovery codes. Takes user's current
+// password, authenticator code or a recovery code, so a hijacked session can't
+// quietly remove the second factor. Without any ErrTotpRequired is returned.
+// Wrong answers are throttled like failed logins from ip.
+func (ts *TotpService) Disable(ctx context.Context, user *entities.User, ip string, dto dtos.TotpDisableDto) error {
+	if !user.IsTotpEnabled {
+		return ErrTotpNotEnabled
+	}
+
+	err := confirmThrottled(ctx, ts.loginAttemptService, user, ip, func() error {
+		switch {
+		case dto.CurrentPassword != "":
+			if !ts.userService.VerifyPassword(user, dto.CurrentPassword) {
+				return ErrWrongPassword
+			}
+			return nil
+		case dto.Code != "", dto.RecoveryCode != "":
+			return ts.Verify(ctx, user, dto.Code, dto.RecoveryCode)
+		default:
+			return ErrTotpRequired
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	user.IsTotpEnabled = false
+	user.TotpSecret = ""
+	if err := ts.userService.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := ts.recoveryCodes.ReplaceForUser(ctx, user.ID, nil); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// Verifies second factor on login: either authenticator app code or one of
+// recovery codes, which is used up.
+func (ts *TotpService) Verify(ctx context.Context, user *entities.User, code, recoveryCode string) error {
+	if !user.IsTotpEnabled {
+		return ErrTotpNotEnabled
+	}
+
+	if recoveryCode != "" {
+		used, err := ts.recoveryCodes.Use(ctx, user.ID, hashRecoveryCode(recoveryCode))
+		if err != nil {
+			return fmt.Errorf("failed to use recovery code: %w", err)
+		}
+		if !used {
+			return ErrInvalidTotpCode
+		}
+		return nil
+	}
+
+	return ts.checkCode(ctx, user, code)
+}
+
+// Accepts code only once: time step it belongs to has to be newer than the
+// one of previously accepted code.
+func (ts *TotpService) checkCode(ctx context.Context, user *entities.User, code string) error {
+	secret, err := ts.decrypt(user.TotpSecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := security.ValidateTOTP(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidTotpCode
+	}
+
+	advanced, err := ts.userService.AdvanceTotpStep(ctx, user, step)
+	if err != nil {
+		return fmt.Errorf("failed to save totp step: %w", err)
+	}
+	if !advanced {
+		return ErrInvalidTotpCode
+	}
+
+	return nil
+}
+
+func (ts *TotpService) replaceRecoveryCodes(ctx context.Context, user *entities.User) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	stored := make([]entities.RecoveryCode, 0, recoveryCodeCount)
+	now := time.Now().UTC()
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		codes = append(codes, code)
+		stored = append(stored, entities.RecoveryCode{
+			ID:        uuid.NewString(),
+			UserID:    user.ID,
+			CodeHash:  hashRecoveryCode(code),
+			CreatedAt: now,
+		})
+	}
+
+	if err := ts.recoveryCodes.ReplaceForUser(ctx, user.ID, stored); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (ts *TotpService) encrypt(secret string) (string, error) {
+	if len(ts.options.TotpEncryptionKey) == 0 {
+		return "", errors.New("totp encryption key is not configured")
+	}
+
+	encrypted, err := security.Encrypt(ts.options.TotpEncryptionKey, secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+	return encrypted, nil
+}
+
+func (ts *TotpService) decrypt(encrypted string) (string, error) {
+	if len(ts.options.TotpEncryptionKey) == 0 {
+		return "", errors.New("totp encryption key is not configured")
+	}
+
+	secret, err := security.Decrypt(ts.options.TotpEncryptionKey, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+// Generates code like "abcd-efgh-ijkl-mnop".
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// Recovery codes are random enough to be hashed with plain SHA-256. Case and
+// separators are ignored, so codes can be typed in any way.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
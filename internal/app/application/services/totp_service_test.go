@@ -0,0 +1,102 @@
+package services_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/Mixturka/vm-hub/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotpService_EnrollmentAndVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	userService := services.NewUserService(postgres.NewPostgresUserRepository(ptUtil.DB()), test.NewPasswordHasher())
+	totpService := services.NewTotpService(userService, postgres.NewPostgresRecoveryCodeRepository(ptUtil.DB()),
+		nil, &config.AuthOptions{
+			TotpIssuer:        "vm-hub",
+			TotpEncryptionKey: []byte("0123456789abcdef0123456789abcdef"),
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	random := test.NewRandomUser()
+	user, err := userService.CreateUser(ctx, random.Email, random.Password, random.Name, "", entities.Credentials, true)
+	require.NoError(t, err)
+
+	_, err = totpService.ConfirmEnrollment(ctx, user, "203.0.113.7", "123456")
+	assert.ErrorIs(t, err, services.ErrTotpNotEnrolled)
+
+	enrollment, err := totpService.BeginEnrollment(ctx, user)
+	require.NoError(t, err, "BeginEnrollment shouldn't return an error")
+	uri, err := url.Parse(enrollment.URI)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+
+	stored, err := userService.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stored.TotpSecret)
+	assert.NotContains(t, stored.TotpSecret, enrollment.Secret, "Secret should be stored encrypted")
+	assert.False(t, stored.IsTotpEnabled, "TOTP shouldn't be enabled before confirmation")
+
+	step := security.TOTPStep(time.Now())
+	previousCode, err := security.TOTPCode(enrollment.Secret, step-1)
+	require.NoError(t, err)
+	currentCode, err := security.TOTPCode(enrollment.Secret, step)
+	require.NoError(t, err)
+
+	_, err = totpService.ConfirmEnrollment(ctx, stored, "203.0.113.7", "000000")
+	if previousCode != "000000" && currentCode != "000000" {
+		assert.ErrorIs(t, err, services.ErrInvalidTotpCode)
+	}
+
+	recoveryCodes, err := totpService.ConfirmEnrollment(ctx, stored, "203.0.113.7", previousCode)
+	require.NoError(t, err, "Code of previous step should be accepted")
+	assert.Len(t, recoveryCodes, 10)
+
+	stored, err = userService.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.IsTotpEnabled)
+
+	err = totpService.Verify(ctx, stored, previousCode, "")
+	assert.ErrorIs(t, err, services.ErrInvalidTotpCode, "Used code should be refused")
+
+	err = totpService.Verify(ctx, stored, currentCode, "")
+	assert.NoError(t, err, "Code of newer step should be accepted")
+
+	err = totpService.Verify(ctx, stored, currentCode, "")
+	assert.ErrorIs(t, err, services.ErrInvalidTotpCode, "Code can't be replayed")
+
+	err = totpService.Verify(ctx, stored, "", recoveryCodes[0])
+	assert.NoError(t, err, "Recovery code should be accepted")
+
+	err = totpService.Verify(ctx, stored, "", recoveryCodes[0])
+	assert.ErrorIs(t, err, services.ErrInvalidTotpCode, "Recovery code is single-use")
+
+	nextCode, err := security.TOTPCode(enrollment.Secret, step+1)
+	require.NoError(t, err)
+	regenerated, err := totpService.RegenerateRecoveryCodes(ctx, stored, "203.0.113.7", nextCode)
+	require.NoError(t, err, "RegenerateRecoveryCodes shouldn't return an error")
+	assert.Len(t, regenerated, 10)
+
+	err = totpService.Verify(ctx, stored, "", recoveryCodes[1])
+	assert.ErrorIs(t, err, services.ErrInvalidTotpCode, "Old recovery codes should be replaced")
+
+	err = totpService.Verify(ctx, stored, "", regenerated[0])
+	assert.NoError(t, err, "New recovery code should be accepted")
+}
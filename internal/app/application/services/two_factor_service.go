@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/web/templates"
+)
+
+type TwoFactorService struct {
+	userService         *UserService
+	tokenService        *TokenService
+	mailer              interfaces.Mailer
+	loginAttemptService *LoginAttemptService
+	options             *config.AuthOptions
+}
+
+func NewTwoFactorService(userService *UserService, tokenService *TokenService, mailer interfaces.Mailer,
+	loginAttemptService *LoginAttemptService, options *config.AuthOptions) *TwoFactorService {
+	return &TwoFactorService{
+		userService:         userService,
+		tokenService:        tokenService,
+		mailer:              mailer,
+		loginAttemptService: loginAttemptService,
+		options:             options,
+	}
+}
+
+// Turns emailed two-factor codes on or off. Turning them off takes user's
+// current password or a code, so a hijacked session can't quietly remove
+// the second factor. Without either a code is mailed and
+// ErrTwoFactorRequired is returned. Wrong answers are throttled like failed
+// logins from ip.
+func (tfs *TwoFactorService) SetEnabled(ctx context.Context, user *entities.User, ip string,
+	dto dtos.TwoFactorSettingsDto) error {
+	if !dto.Enabled && user.IsTwoFactorEnabled {
+		switch {
+		case dto.CurrentPassword != "":
+			err := confirmThrottled(ctx, tfs.loginAttemptService, user, ip, func() error {
+				if !tfs.userService.VerifyPassword(user, dto.CurrentPassword) {
+					return ErrWrongPassword
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		case dto.Code != "":
+			err := confirmThrottled(ctx, tfs.loginAttemptService, user, ip, func() error {
+				return tfs.VerifyCode(ctx, user, dto.Code)
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			if err := tfs.SendCode(ctx, user); err != nil {
+				return err
+			}
+			return ErrTwoFactorRequired
+		}
+	}
+
+	return tfs.userService.SetTwoFactor(ctx, user, dto.Enabled)
+}
+
+// Issues new two-factor code for user's email, replacing previous one, and mails it.
+func (tfs *TwoFactorService) SendCode(ctx context.Context, user *entities.User) error {
+	token, err := tfs.tokenService.Issue(ctx, user.Email, entities.TwoFactor)
+	if err != nil {
+		return err
+	}
+
+	expiresIn := formatTTL(tfs.tokenService.TTL(entities.TwoFactor))
+	mail, err := newMail(ctx, user.Email, "Your login code",
+		fmt.Sprintf("Hi %s,\n\nYour login code is %s\n\n"+
+			"The code expires in %s. If you didn't try to login, please change your password.\n",
+			user.Name, token.Token, expiresIn),
+		templates.TwoFactorCodeMail(user.Name, token.Token, expiresIn))
+	if err != nil {
+		return err
+	}
+
+	err = tfs.mailer.Send(ctx, mail)
+	if err != nil {
+		return fmt.Errorf("failed to send two-factor code: %w", err)
+	}
+
+	return nil
+}
+
+// Checks code sent to user's email. The code is deleted once used.
+func (tfs *TwoFactorService) VerifyCode(ctx context.Context, user *entities.User, code string) error {
+	token, err := tfs.tokenService.ValidateForEmail(ctx, user.Email, entities.TwoFactor,
+		code, tfs.options.TwoFactorMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	return tfs.tokenService.Revoke(ctx, token)
+}
@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
 	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
@@ -12,11 +16,16 @@ import (
 
 type UserService struct {
 	repository interfaces.UserRepository
+	hasher     security.PasswordHasher
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewUserService(repository interfaces.UserRepository) *UserService {
+func NewUserService(repository interfaces.UserRepository, hasher security.PasswordHasher) *UserService {
 	return &UserService{
 		repository: repository,
+		hasher:     hasher,
 	}
 }
 
@@ -30,10 +39,16 @@ func (us *UserService) FindByEmail(ctx context.Context, email string) (*entities
 
 func (us *UserService) CreateUser(ctx context.Context, email string, password string, name string,
 	profilePic string, method entities.AuthMethod, isEmailVerified bool) (*entities.User, error) {
-	hashedPassword, err := security.HashPassword(password)
-	if err != nil {
-		return nil, fmt.Errorf("error hashing password: %w", err)
+	// Users signed up with OAuth have no password.
+	var hashedPassword string
+	if password != "" {
+		var err error
+		hashedPassword, err = us.hasher.Hash(password)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing password: %w", err)
+		}
 	}
+	now := time.Now().UTC()
 	user := &entities.User{
 		ID:              uuid.NewString(),
 		ProfilePicture:  profilePic,
@@ -42,6 +57,90 @@ func (us *UserService) CreateUser(ctx context.Context, email string, password st
 		Password:        hashedPassword,
 		Accounts:        []entities.Account{},
 		IsEmailVerified: isEmailVerified,
+		Method:          method,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
 	return user, us.repository.Save(ctx, user)
 }
+
+// Replaces user's password hash, the user isn't saved.
+func (us *UserService) SetPassword(user *entities.User, password string) error {
+	hashedPassword, err := us.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	user.Password = hashedPassword
+	return nil
+}
+
+// Reports whether password is the user's one. Nil user and users without
+// password never match, but password is hashed anyway, so response time
+// doesn't tell whether the user exists.
+func (us *UserService) VerifyPassword(user *entities.User, password string) bool {
+	if user == nil || user.Password == "" {
+		us.hasher.Verify(us.dummyPasswordHash(), password)
+		return false
+	}
+
+	ok, err := us.hasher.Verify(user.Password, password)
+	if err != nil && !errors.Is(err, security.ErrEmptyPassword) {
+		slog.Error("Failed to verify password", "user", user.ID, "error", err)
+	}
+	return ok
+}
+
+// Rehashes verified password if its hash is outdated and saves the user.
+func (us *UserService) UpgradePasswordHash(ctx context.Context, user *entities.User, password string) error {
+	if !us.hasher.NeedsRehash(user.Password) {
+		return nil
+	}
+	if err := us.SetPassword(user, password); err != nil {
+		return err
+	}
+	return us.Update(ctx, user)
+}
+
+// Hash compared against when user has no password, computed once with the
+// same parameters as real ones.
+func (us *UserService) dummyPasswordHash() string {
+	us.dummyHashOnce.Do(func() {
+		us.dummyHash, _ = us.hasher.Hash("dummy password")
+	})
+	return us.dummyHash
+}
+
+func (us *UserService) Update(ctx context.Context, user *entities.User) error {
+	user.UpdatedAt = time.Now().UTC()
+	return us.repository.Update(ctx, user)
+}
+
+func (us *UserService) AdvanceTotpStep(ctx context.Context, user *entities.User, step int64) (bool, error) {
+	ok, err := us.repository.AdvanceTotpStep(ctx, user.ID, step)
+	if ok {
+		user.TotpLastStep = step
+	}
+	return ok, err
+}
+
+// Moves user to a new session epoch, which invalidates all user's sessions
+// wherever they are stored. See revokeUserSessions.
+func (us *UserService) BumpSessionEpoch(ctx context.Context, user *entities.User) error {
+	epoch, err := us.repository.BumpSessionEpoch(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	user.SessionEpoch = epoch
+	return nil
+}
+
+// Turns emailed two-factor codes on or off. Codes are sent by email, so it has
+// to be verified first.
+func (us *UserService) SetTwoFactor(ctx context.Context, user *entities.User, enabled bool) error {
+	if enabled && !user.IsEmailVerified {
+		return ErrEmailNotVerified
+	}
+
+	user.IsTwoFactorEnabled = enabled
+	return us.Update(ctx, user)
+}
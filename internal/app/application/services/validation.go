@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+)
+
+var ErrValidation = errors.New("validation failed")
+
+// Lists every field of DTO that failed validation. Messages name the rule,
+// never the value, so passwords aren't echoed back.
+type ValidationError struct {
+	Errors []dtos.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// Validates DTOs by their validate tags. Fields are named by their json tags,
+// as clients know them.
+type Validator struct {
+	validate   *validator.Validate
+	translator ut.Translator
+}
+
+func NewValidator() *Validator {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+
+	locale := en.New()
+	translator, _ := ut.New(locale, locale).GetTranslator("en")
+	// Only fails if translations are registered twice.
+	_ = entranslations.RegisterDefaultTranslations(validate, translator)
+
+	return &Validator{
+		validate:   validate,
+		translator: translator,
+	}
+}
+
+// Returns ValidationError if dto is invalid.
+func (v *Validator) Validate(dto interface{}) error {
+	err := v.validate.Struct(dto)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	fieldErrs := make([]dtos.FieldError, len(validationErrs))
+	for i, validationErr := range validationErrs {
+		fieldErrs[i] = dtos.FieldError{
+			Field:   validationErr.Field(),
+			Code:    validationErr.Tag(),
+			Message: validationErr.Translate(v.translator),
+		}
+	}
+	return &ValidationError{Errors: fieldErrs}
+}
@@ -0,0 +1,41 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator(t *testing.T) {
+	t.Parallel()
+
+	validator := services.NewValidator()
+
+	require.NoError(t, validator.Validate(dtos.RegisterDto{
+		Name:           "User",
+		Email:          "user@example.com",
+		Password:       "correct horse",
+		PasswordRepeat: "correct horse",
+	}))
+
+	err := validator.Validate(dtos.RegisterDto{
+		Email:          "not an email",
+		Password:       "correct horse",
+		PasswordRepeat: "wrong horse",
+	})
+	var validationErr *services.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.ErrorIs(t, err, services.ErrValidation)
+
+	assert.Equal(t, []dtos.FieldError{
+		{Field: "name", Code: "required", Message: "name is a required field"},
+		{Field: "email", Code: "email", Message: "email must be a valid email address"},
+		{Field: "password_repeat", Code: "eqfield", Message: "password_repeat must be equal to Password"},
+	}, validationErr.Errors)
+
+	assert.NotContains(t, err.Error(), "horse", "Values shouldn't be echoed back")
+	assert.NotContains(t, err.Error(), "not an email", "Values shouldn't be echoed back")
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/web/templates"
+	"github.com/jackc/pgx/v4"
+)
+
+type VerificationService struct {
+	userService  *UserService
+	tokenService *TokenService
+	mailer       interfaces.Mailer
+	baseURL      string
+}
+
+func NewVerificationService(userService *UserService, tokenService *TokenService,
+	mailer interfaces.Mailer, baseURL string) *VerificationService {
+	return &VerificationService{
+		userService:  userService,
+		tokenService: tokenService,
+		mailer:       mailer,
+		baseURL:      baseURL,
+	}
+}
+
+// Issues verification token for user's email and mails verification link to it.
+func (vs *VerificationService) SendVerification(ctx context.Context, user *entities.User) error {
+	token, err := vs.tokenService.Issue(ctx, user.Email, entities.Verification)
+	if err != nil {
+		return err
+	}
+
+	link := vs.baseURL + "/auth/verify?token=" + url.QueryEscape(token.Token)
+	expiresIn := formatTTL(vs.tokenService.TTL(entities.Verification))
+	mail, err := newMail(ctx, user.Email, "Confirm your email",
+		fmt.Sprintf("Hi %s,\n\nPlease confirm your email by following the link below:\n%s\n\n"+
+			"The link expires in %s. If you didn't create an account, just ignore this email.\n",
+			user.Name, link, expiresIn),
+		templates.VerificationMail(user.Name, link, expiresIn))
+	if err != nil {
+		return err
+	}
+
+	err = vs.mailer.Send(ctx, mail)
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	return nil
+}
+
+// Marks email the token was issued for as verified and deletes the token.
+func (vs *VerificationService) Verify(ctx context.Context, token string) error {
+	stored, err := vs.tokenService.Validate(ctx, token, entities.Verification)
+	if err != nil {
+		return err
+	}
+
+	user, err := vs.userService.FindByEmail(ctx, stored.UserEmail)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if !user.IsEmailVerified {
+		user.IsEmailVerified = true
+		if err := vs.userService.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	return vs.tokenService.Revoke(ctx, stored)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -13,20 +15,61 @@ import (
 
 type Config struct {
 	ListenAddr     string
+	BaseURL        string
 	SessionOptions *SessionOptions
 	RedisUri       string
+	PostgresUri    string
 	GRecapOptions  GRecapOptions
+	OAuthOptions   OAuthOptions
+	AuthOptions    AuthOptions
+	MailOptions    MailOptions
+	TokenOptions   TokenOptions
+	WebAuthn       WebAuthnOptions
+	RateLimit      RateLimitOptions
 }
 
 type SessionOptions struct {
+	// Where session data is kept: "redis", "postgres", "memory" or "cookie".
+	// Cookie storage needs no server-side store, but sessions can't be listed
+	// or revoked remotely. Memory storage is lost on restart.
+	Storage string
+	// How session data is serialized: "json" or "gob". Data written with
+	// either is readable after switching.
+	Codec string
+	// How often expired sessions are purged from postgres and memory storages.
+	CleanupInterval int
 	MaxAge          int
-	SessionName     string
-	SessionDomain   string
-	SessionSecure   bool
-	SessionHttpOnly bool
-	SessionFolder   string
-	SessionSecret   string
-	CookiesSecret   string
+	// Extends session by MaxAge on use once less than RefreshThreshold seconds
+	// of it are left, but never beyond MaxLifetime seconds since login.
+	SlidingExpiration bool
+	RefreshThreshold  int
+	MaxLifetime       int
+	SessionName       string
+	SessionDomain     string
+	SessionSecure     bool
+	SessionHttpOnly   bool
+	SessionFolder     string
+	// Session cookies are signed with SessionSecret and, if CookiesSecret is
+	// set, encrypted with it. Previous secrets are only used to read cookies
+	// issued before the secrets were rotated.
+	SessionSecret          string
+	PreviousSessionSecrets []string
+	CookiesSecret          string
+	PreviousCookiesSecrets []string
+	CSRF                   CSRFOptions
+}
+
+type CSRFOptions struct {
+	// Require token on requests with unsafe methods.
+	Enabled bool
+	// Clients without session get token in a cookie and have to send it back
+	// in the header, so API clients don't need a rendered page to get one.
+	DoubleSubmit bool
+	// Skip the check for requests carrying a bearer token, browsers can't be
+	// made to attach one cross-site. The app itself doesn't authenticate
+	// bearer tokens, so this is off unless a proxy in front of it does.
+	ExemptBearer bool
+	CookieName   string
 }
 
 type GRecapOptions struct {
@@ -34,6 +77,121 @@ type GRecapOptions struct {
 	URL       string
 }
 
+type AuthOptions struct {
+	// Refuse login with credentials until user's email is verified.
+	RequireEmailVerification bool
+	// Failed attempts allowed per emailed two-factor code.
+	TwoFactorMaxAttempts int
+	// Issuer shown by authenticator apps.
+	TotpIssuer string
+	// AES key TOTP secrets are encrypted with.
+	TotpEncryptionKey []byte
+	LoginThrottle     LoginThrottleOptions
+	PasswordHash      PasswordHashOptions
+	PasswordPolicy    PasswordPolicyOptions
+}
+
+// Rules new passwords have to satisfy. MinLength is in characters, MaxLength
+// in bytes, as bcrypt ignores everything past 72 bytes.
+type PasswordPolicyOptions struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Refuse passwords containing user's email or name.
+	ForbidPersonalInfo bool
+	// File of breached SHA-1 hashes, breached passwords aren't checked if empty.
+	BreachedPasswordsFile string
+}
+
+// New passwords are hashed with Algorithm, "argon2id" or "bcrypt". Hashes made
+// by the other one or with other parameters are replaced on successful login.
+type PasswordHashOptions struct {
+	Algorithm string
+	// Argon2id memory in KiB.
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	BcryptCost        int
+}
+
+// Failed logins are counted per account and per IP within Window seconds.
+// Each failure delays next attempt of the account by DelayBase seconds,
+// doubled with every further failure. Reaching MaxAttempts locks the account
+// or IP for LockoutDuration seconds.
+type LoginThrottleOptions struct {
+	MaxAttempts      int
+	MaxAttemptsPerIP int
+	Window           int
+	LockoutDuration  int
+	DelayBase        int
+}
+
+// Lifetimes of tokens sent to users, in seconds.
+type TokenOptions struct {
+	VerificationTTL  int
+	TwoFactorTTL     int
+	PasswordResetTTL int
+	// How often expired tokens are purged from storage.
+	PurgeInterval int
+}
+
+// Relying party settings of passkey ceremonies.
+type WebAuthnOptions struct {
+	// Domain passkeys are bound to, host of BASE_URL by default.
+	RPID          string
+	RPDisplayName string
+	// Origins ceremonies may come from, BASE_URL by default.
+	RPOrigins []string
+}
+
+// Limits themselves are declared with routes.
+type RateLimitOptions struct {
+	Enabled bool
+}
+
+type MailOptions struct {
+	From string
+	// One of "log", "smtp" or "file".
+	Driver string
+	SMTP   SMTPOptions
+	// Directory .eml files are written to by "file" driver.
+	FileDir string
+}
+
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Refuse to send mail if server doesn't support STARTTLS.
+	RequireTLS bool
+}
+
+type OAuthOptions struct {
+	Google OAuthClientOptions
+	Yandex OAuthClientOptions
+	OIDC   OIDCClientOptions
+}
+
+type OAuthClientOptions struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type OIDCClientOptions struct {
+	OAuthClientOptions
+	// Name of the provider in /auth/oauth/{connect,callback}/{name} routes.
+	Name      string
+	IssuerURL string
+}
+
+// Session cookies are only as strong as the secret they are signed with.
+const minSessionSecretLength = 32
+
 // Parses duration with unit e.g. "3d", "15h", "12m" and returns result duration in seconds
 // with possible error. If no unit provided parses as seconds.
 func parseDuration(duration string) (int, error) {
@@ -97,26 +255,410 @@ func LoadConfig() (*Config, error) {
 		return nil, errors.New("invalid SESSION_HTTP_ONLY value")
 	}
 
+	slidingExpiration, err := strconv.ParseBool(getEnvOrDefault("SESSION_SLIDING_EXPIRATION", "false"))
+	if err != nil {
+		return nil, errors.New("invalid SESSION_SLIDING_EXPIRATION value")
+	}
+
+	refreshThreshold, err := parseDuration(os.Getenv("SESSION_REFRESH_THRESHOLD"))
+	if err != nil || refreshThreshold < 0 || refreshThreshold > sessionLifeTime {
+		return nil, errors.New("invalid SESSION_REFRESH_THRESHOLD value: expected duration not longer than SESSION_LIFETIME")
+	}
+	if refreshThreshold == 0 {
+		refreshThreshold = sessionLifeTime / 2
+	}
+
+	sessionMaxLifetime, err := parseDuration(getEnvOrDefault("SESSION_MAX_LIFETIME", "30d"))
+	if err != nil || sessionMaxLifetime < sessionLifeTime {
+		return nil, errors.New("invalid SESSION_MAX_LIFETIME value: expected duration not shorter than SESSION_LIFETIME")
+	}
+
+	sessionSecret := os.Getenv("SESSION_SECRET")
+	if len(sessionSecret) < minSessionSecretLength {
+		return nil, fmt.Errorf("invalid SESSION_SECRET value: expected at least %d characters", minSessionSecretLength)
+	}
+
+	sessionStorage := getEnvOrDefault("SESSION_STORAGE", "redis")
+	switch sessionStorage {
+	case "redis", "postgres", "memory", "cookie":
+	default:
+		return nil, errors.New("invalid SESSION_STORAGE value: expected redis, postgres, memory or cookie")
+	}
+	if sessionStorage == "cookie" && os.Getenv("COOKIES_SECRET") == "" {
+		return nil, errors.New("COOKIES_SECRET is required when SESSION_STORAGE is cookie")
+	}
+
+	sessionCodec := getEnvOrDefault("SESSION_CODEC", "json")
+	switch sessionCodec {
+	case "json", "gob":
+	default:
+		return nil, errors.New("invalid SESSION_CODEC value: expected json or gob")
+	}
+
+	sessionCleanupInterval, err := parseDuration(getEnvOrDefault("SESSION_CLEANUP_INTERVAL", "10m"))
+	if err != nil || sessionCleanupInterval < 0 {
+		return nil, errors.New("invalid SESSION_CLEANUP_INTERVAL value")
+	}
+
+	csrfEnabled, err := strconv.ParseBool(getEnvOrDefault("CSRF_ENABLED", "true"))
+	if err != nil {
+		return nil, errors.New("invalid CSRF_ENABLED value")
+	}
+
+	csrfDoubleSubmit, err := strconv.ParseBool(getEnvOrDefault("CSRF_DOUBLE_SUBMIT", "true"))
+	if err != nil {
+		return nil, errors.New("invalid CSRF_DOUBLE_SUBMIT value")
+	}
+
+	csrfExemptBearer, err := strconv.ParseBool(getEnvOrDefault("CSRF_EXEMPT_BEARER", "false"))
+	if err != nil {
+		return nil, errors.New("invalid CSRF_EXEMPT_BEARER value")
+	}
+
 	sessionOptions := &SessionOptions{
-		MaxAge:          sessionLifeTime,
-		SessionName:     os.Getenv("SESSION_NAME"),
-		SessionDomain:   os.Getenv("SESSION_DOMAIN"),
-		SessionSecure:   sessionSecure,
-		SessionHttpOnly: sessionHttpOnly,
-		SessionFolder:   os.Getenv("SESSION_FOLDER"),
-		SessionSecret:   os.Getenv("SESSION_SECRET"),
-		CookiesSecret:   os.Getenv("COOKIES_SECRET"),
+		Storage:                sessionStorage,
+		Codec:                  sessionCodec,
+		CleanupInterval:        sessionCleanupInterval,
+		MaxAge:                 sessionLifeTime,
+		SlidingExpiration:      slidingExpiration,
+		RefreshThreshold:       refreshThreshold,
+		MaxLifetime:            sessionMaxLifetime,
+		SessionName:            os.Getenv("SESSION_NAME"),
+		SessionDomain:          os.Getenv("SESSION_DOMAIN"),
+		SessionSecure:          sessionSecure,
+		SessionHttpOnly:        sessionHttpOnly,
+		SessionFolder:          os.Getenv("SESSION_FOLDER"),
+		SessionSecret:          sessionSecret,
+		PreviousSessionSecrets: strings.Fields(os.Getenv("SESSION_PREVIOUS_SECRETS")),
+		CookiesSecret:          os.Getenv("COOKIES_SECRET"),
+		PreviousCookiesSecrets: strings.Fields(os.Getenv("COOKIES_PREVIOUS_SECRETS")),
+		CSRF: CSRFOptions{
+			Enabled:      csrfEnabled,
+			DoubleSubmit: csrfDoubleSubmit,
+			ExemptBearer: csrfExemptBearer,
+			CookieName:   getEnvOrDefault("CSRF_COOKIE_NAME", "csrf_token"),
+		},
 	}
 
 	gRecapOptions := GRecapOptions{
 		SecretKey: os.Getenv("GOOGLE_RECAPTCHA_SECRET_KEY"),
-		URL:       getEnvOrDefault("RECAPTCHA_URL", ""),
+		URL:       getEnvOrDefault("RECAPTCHA_URL", "https://www.google.com/recaptcha/api/siteverify"),
+	}
+
+	requireEmailVerification, err := strconv.ParseBool(getEnvOrDefault("REQUIRE_EMAIL_VERIFICATION", "false"))
+	if err != nil {
+		return nil, errors.New("invalid REQUIRE_EMAIL_VERIFICATION value")
+	}
+
+	twoFactorMaxAttempts, err := strconv.Atoi(getEnvOrDefault("TWO_FACTOR_MAX_ATTEMPTS", "5"))
+	if err != nil || twoFactorMaxAttempts <= 0 {
+		return nil, errors.New("invalid TWO_FACTOR_MAX_ATTEMPTS value")
+	}
+
+	loginThrottleOptions, err := loadLoginThrottleOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	passwordHashOptions, err := loadPasswordHashOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	passwordPolicyOptions, err := loadPasswordPolicyOptions(passwordHashOptions.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	totpEncryptionKey, err := loadTotpEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenOptions, err := loadTokenOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	oauthOptions := OAuthOptions{
+		Google: OAuthClientOptions{
+			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			Scopes:       strings.Fields(getEnvOrDefault("GOOGLE_SCOPES", "openid email profile")),
+		},
+		Yandex: OAuthClientOptions{
+			ClientID:     os.Getenv("YANDEX_CLIENT_ID"),
+			ClientSecret: os.Getenv("YANDEX_CLIENT_SECRET"),
+			Scopes:       strings.Fields(getEnvOrDefault("YANDEX_SCOPES", "login:email login:info login:avatar")),
+		},
+		OIDC: OIDCClientOptions{
+			OAuthClientOptions: OAuthClientOptions{
+				ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+				ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+				Scopes:       strings.Fields(getEnvOrDefault("OIDC_SCOPES", "openid email profile")),
+			},
+			Name:      getEnvOrDefault("OIDC_NAME", "oidc"),
+			IssuerURL: os.Getenv("OIDC_ISSUER_URL"),
+		},
+	}
+
+	mailOptions, err := loadMailOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitEnabled, err := strconv.ParseBool(getEnvOrDefault("RATE_LIMIT_ENABLED", "true"))
+	if err != nil {
+		return nil, errors.New("invalid RATE_LIMIT_ENABLED value")
+	}
+
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	webAuthnOptions, err := loadWebAuthnOptions(baseURL)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Config{
 		ListenAddr:     os.Getenv("LISTEN_ADDR"),
+		BaseURL:        baseURL,
 		SessionOptions: sessionOptions,
 		RedisUri:       os.Getenv("REDIS_URI"),
+		PostgresUri:    os.Getenv("POSTGRES_URI"),
 		GRecapOptions:  gRecapOptions,
+		OAuthOptions:   oauthOptions,
+		AuthOptions: AuthOptions{
+			RequireEmailVerification: requireEmailVerification,
+			TwoFactorMaxAttempts:     twoFactorMaxAttempts,
+			TotpIssuer:               getEnvOrDefault("TOTP_ISSUER", "vm-hub"),
+			TotpEncryptionKey:        totpEncryptionKey,
+			LoginThrottle:            *loginThrottleOptions,
+			PasswordHash:             *passwordHashOptions,
+			PasswordPolicy:           *passwordPolicyOptions,
+		},
+		MailOptions:  *mailOptions,
+		TokenOptions: *tokenOptions,
+		WebAuthn:     *webAuthnOptions,
+		RateLimit:    RateLimitOptions{Enabled: rateLimitEnabled},
+	}, nil
+}
+
+func loadWebAuthnOptions(baseURL string) (*WebAuthnOptions, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" && baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, errors.New("invalid BASE_URL value")
+		}
+		rpID = parsed.Hostname()
+	}
+
+	origins := strings.Fields(os.Getenv("WEBAUTHN_RP_ORIGINS"))
+	if len(origins) == 0 && baseURL != "" {
+		origins = []string{baseURL}
+	}
+
+	return &WebAuthnOptions{
+		RPID:          rpID,
+		RPDisplayName: getEnvOrDefault("WEBAUTHN_RP_NAME", "vm-hub"),
+		RPOrigins:     origins,
+	}, nil
+}
+
+func loadLoginThrottleOptions() (*LoginThrottleOptions, error) {
+	maxAttempts, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts <= 0 {
+		return nil, errors.New("invalid LOGIN_MAX_ATTEMPTS value")
+	}
+
+	maxAttemptsPerIP, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_ATTEMPTS_PER_IP", "50"))
+	if err != nil || maxAttemptsPerIP <= 0 {
+		return nil, errors.New("invalid LOGIN_MAX_ATTEMPTS_PER_IP value")
+	}
+
+	window, err := parseDuration(getEnvOrDefault("LOGIN_ATTEMPT_WINDOW", "15m"))
+	if err != nil || window <= 0 {
+		return nil, errors.New("invalid LOGIN_ATTEMPT_WINDOW value")
+	}
+
+	lockoutDuration, err := parseDuration(getEnvOrDefault("LOGIN_LOCKOUT_DURATION", "15m"))
+	if err != nil || lockoutDuration <= 0 {
+		return nil, errors.New("invalid LOGIN_LOCKOUT_DURATION value")
+	}
+
+	delayBase, err := parseDuration(getEnvOrDefault("LOGIN_DELAY_BASE", "1s"))
+	if err != nil || delayBase < 0 {
+		return nil, errors.New("invalid LOGIN_DELAY_BASE value")
+	}
+
+	return &LoginThrottleOptions{
+		MaxAttempts:      maxAttempts,
+		MaxAttemptsPerIP: maxAttemptsPerIP,
+		Window:           window,
+		LockoutDuration:  lockoutDuration,
+		DelayBase:        delayBase,
+	}, nil
+}
+
+func loadPasswordHashOptions() (*PasswordHashOptions, error) {
+	algorithm := getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id")
+	if algorithm != "argon2id" && algorithm != "bcrypt" {
+		return nil, errors.New("invalid PASSWORD_HASH_ALGORITHM value, expected argon2id or bcrypt")
+	}
+
+	memory, err := strconv.ParseUint(getEnvOrDefault("ARGON2_MEMORY", "65536"), 10, 32)
+	if err != nil || memory < 8 {
+		return nil, errors.New("invalid ARGON2_MEMORY value")
+	}
+
+	iterations, err := strconv.ParseUint(getEnvOrDefault("ARGON2_ITERATIONS", "3"), 10, 32)
+	if err != nil || iterations == 0 {
+		return nil, errors.New("invalid ARGON2_ITERATIONS value")
+	}
+
+	parallelism, err := strconv.ParseUint(getEnvOrDefault("ARGON2_PARALLELISM", "2"), 10, 8)
+	if err != nil || parallelism == 0 {
+		return nil, errors.New("invalid ARGON2_PARALLELISM value")
+	}
+
+	bcryptCost, err := strconv.Atoi(getEnvOrDefault("BCRYPT_COST", "12"))
+	if err != nil || bcryptCost < 4 || bcryptCost > 31 {
+		return nil, errors.New("invalid BCRYPT_COST value")
+	}
+
+	return &PasswordHashOptions{
+		Algorithm:         algorithm,
+		Argon2Memory:      uint32(memory),
+		Argon2Iterations:  uint32(iterations),
+		Argon2Parallelism: uint8(parallelism),
+		BcryptCost:        bcryptCost,
+	}, nil
+}
+
+// bcrypt limits passwords to 72 bytes.
+const bcryptMaxPasswordLength = 72
+
+func loadPasswordPolicyOptions(hashAlgorithm string) (*PasswordPolicyOptions, error) {
+	minLength, err := strconv.Atoi(getEnvOrDefault("PASSWORD_MIN_LENGTH", "8"))
+	if err != nil || minLength <= 0 {
+		return nil, errors.New("invalid PASSWORD_MIN_LENGTH value")
+	}
+
+	maxLength, err := strconv.Atoi(getEnvOrDefault("PASSWORD_MAX_LENGTH", strconv.Itoa(bcryptMaxPasswordLength)))
+	if err != nil || maxLength < minLength {
+		return nil, errors.New("invalid PASSWORD_MAX_LENGTH value, it can't be less than PASSWORD_MIN_LENGTH")
+	}
+	if hashAlgorithm == "bcrypt" && maxLength > bcryptMaxPasswordLength {
+		return nil, errors.New("PASSWORD_MAX_LENGTH can't exceed 72 with bcrypt")
+	}
+
+	requireLower, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_REQUIRE_LOWER", "false"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_REQUIRE_LOWER value")
+	}
+
+	requireUpper, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_REQUIRE_UPPER", "false"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_REQUIRE_UPPER value")
+	}
+
+	requireDigit, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_REQUIRE_DIGIT", "false"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_REQUIRE_DIGIT value")
+	}
+
+	requireSymbol, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_REQUIRE_SYMBOL", "false"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_REQUIRE_SYMBOL value")
+	}
+
+	forbidPersonalInfo, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_FORBID_PERSONAL_INFO", "true"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_FORBID_PERSONAL_INFO value")
+	}
+
+	return &PasswordPolicyOptions{
+		MinLength:             minLength,
+		MaxLength:             maxLength,
+		RequireLower:          requireLower,
+		RequireUpper:          requireUpper,
+		RequireDigit:          requireDigit,
+		RequireSymbol:         requireSymbol,
+		ForbidPersonalInfo:    forbidPersonalInfo,
+		BreachedPasswordsFile: os.Getenv("BREACHED_PASSWORDS_FILE"),
+	}, nil
+}
+
+// Reads base64 encoded 32 byte key from TOTP_ENCRYPTION_KEY. The key is kept
+// apart from session secrets so rotating those never makes stored TOTP secrets
+// undecryptable.
+func loadTotpEncryptionKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid TOTP_ENCRYPTION_KEY value: expected base64 encoded 32 bytes")
+	}
+	return key, nil
+}
+
+func loadMailOptions() (*MailOptions, error) {
+	driver := getEnvOrDefault("MAIL_DRIVER", "log")
+	if driver != "log" && driver != "smtp" && driver != "file" {
+		return nil, errors.New("invalid MAIL_DRIVER value: expected log, smtp or file")
+	}
+
+	smtpPort, err := strconv.Atoi(getEnvOrDefault("SMTP_PORT", "587"))
+	if err != nil || smtpPort <= 0 {
+		return nil, errors.New("invalid SMTP_PORT value")
+	}
+
+	smtpRequireTLS, err := strconv.ParseBool(getEnvOrDefault("SMTP_REQUIRE_TLS", "true"))
+	if err != nil {
+		return nil, errors.New("invalid SMTP_REQUIRE_TLS value")
+	}
+
+	options := &MailOptions{
+		From:   getEnvOrDefault("MAIL_FROM", "no-reply@localhost"),
+		Driver: driver,
+		SMTP: SMTPOptions{
+			Host:       os.Getenv("SMTP_HOST"),
+			Port:       smtpPort,
+			Username:   os.Getenv("SMTP_USERNAME"),
+			Password:   os.Getenv("SMTP_PASSWORD"),
+			RequireTLS: smtpRequireTLS,
+		},
+		FileDir: getEnvOrDefault("MAIL_FILE_DIR", "tmp/mail"),
+	}
+	if driver == "smtp" && options.SMTP.Host == "" {
+		return nil, errors.New("SMTP_HOST is required when MAIL_DRIVER is smtp")
+	}
+
+	return options, nil
+}
+
+func loadTokenOptions() (*TokenOptions, error) {
+	verificationTTL, err := parseDuration(getEnvOrDefault("VERIFICATION_TOKEN_LIFETIME", "24h"))
+	if err != nil {
+		return nil, errors.New("invalid VERIFICATION_TOKEN_LIFETIME value")
+	}
+
+	twoFactorTTL, err := parseDuration(getEnvOrDefault("TWO_FACTOR_TOKEN_LIFETIME", "5m"))
+	if err != nil {
+		return nil, errors.New("invalid TWO_FACTOR_TOKEN_LIFETIME value")
+	}
+
+	passwordResetTTL, err := parseDuration(getEnvOrDefault("PASSWORD_RESET_TOKEN_LIFETIME", "1h"))
+	if err != nil {
+		return nil, errors.New("invalid PASSWORD_RESET_TOKEN_LIFETIME value")
+	}
+
+	purgeInterval, err := parseDuration(getEnvOrDefault("TOKEN_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		return nil, errors.New("invalid TOKEN_PURGE_INTERVAL value")
+	}
+
+	return &TokenOptions{
+		VerificationTTL:  verificationTTL,
+		TwoFactorTTL:     twoFactorTTL,
+		PasswordResetTTL: passwordResetTTL,
+		PurgeInterval:    purgeInterval,
 	}, nil
 }
@@ -6,8 +6,10 @@ type Account struct {
 	ID       string
 	Type     string
 	Provider string
-	User     User
-	UserID   string
+	// ID of the user at provider.
+	ProviderAccountID string
+	User              User
+	UserID            string
 
 	RefreshToken string
 	AccessToken  string
@@ -0,0 +1,21 @@
+package entities
+
+import "time"
+
+// WebAuthn credential (passkey) registered by a user.
+type Credential struct {
+	ID     string
+	UserID string
+	// ID assigned to the credential by authenticator.
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
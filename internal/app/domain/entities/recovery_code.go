@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// One-time code that replaces TOTP code when authenticator app is unavailable.
+// Only hash of the code is stored.
+type RecoveryCode struct {
+	ID        string
+	UserID    string
+	CodeHash  string
+	CreatedAt time.Time
+}
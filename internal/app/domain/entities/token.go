@@ -8,6 +8,8 @@ type Token struct {
 	Token     string
 	Type      TokenType
 	ExpiresIn time.Time
+	// Number of failed attempts to use the token.
+	Attempts int
 }
 
 type TokenType int
@@ -14,6 +14,18 @@ type User struct {
 	IsTwoFactorEnabled bool
 	Method             AuthMethod
 
+	// Encrypted secret of authenticator app. It's set once enrollment starts,
+	// but is used for login only after enrollment is confirmed.
+	TotpSecret    string
+	IsTotpEnabled bool
+	// Time step of the last accepted TOTP code, codes of earlier steps are refused.
+	TotpLastStep int64
+
+	// Admins can manage other users, e.g. revoke their sessions.
+	IsAdmin bool
+	// Sessions started in an earlier epoch are no longer valid.
+	SessionEpoch int64
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -24,4 +36,5 @@ const (
 	Credentials AuthMethod = iota
 	Google
 	Yandex
+	OpenID
 )
@@ -0,0 +1,91 @@
+package attempts_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/attempts"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Behaviour every AttemptCounter has to share.
+func testAttemptCounter(t *testing.T, counter interfaces.AttemptCounter) {
+	ctx := context.Background()
+
+	t.Run("Increment and Reset", func(t *testing.T) {
+		key := uuid.NewString()
+		other := uuid.NewString()
+
+		for i := 1; i <= 3; i++ {
+			count, err := counter.Increment(ctx, key, 60)
+			require.NoError(t, err)
+			assert.Equal(t, i, count)
+		}
+		count, err := counter.Increment(ctx, other, 60)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "Keys should be counted separately")
+
+		require.NoError(t, counter.Reset(ctx, key))
+		count, err = counter.Increment(ctx, key, 60)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		key := uuid.NewString()
+
+		lockedFor, err := counter.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.Zero(t, lockedFor)
+
+		require.NoError(t, counter.Lock(ctx, key, 30))
+		lockedFor, err = counter.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.InDelta(t, 30, lockedFor, 1)
+
+		require.NoError(t, counter.Reset(ctx, key))
+		lockedFor, err = counter.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.NotZero(t, lockedFor, "Resetting counter shouldn't unlock key")
+	})
+}
+
+func TestAttemptCounter_Memory(t *testing.T) {
+	t.Parallel()
+
+	testAttemptCounter(t, attempts.NewMemoryCounter(context.Background(), 0))
+}
+
+func TestAttemptCounter_Redis(t *testing.T) {
+	t.Parallel()
+
+	util := test.NewRedisTestUtil(t)
+	testAttemptCounter(t, attempts.NewRedisCounter(util.Client()))
+}
+
+func TestMemoryCounter_Window(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	counter := attempts.NewMemoryCounter(ctx, 100*time.Millisecond)
+
+	_, err := counter.Increment(ctx, "key", 1)
+	require.NoError(t, err)
+	require.NoError(t, counter.Lock(ctx, "key", 1))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	lockedFor, err := counter.LockedFor(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, lockedFor, "Lock should expire")
+
+	count, err := counter.Increment(ctx, "key", 60)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "Counter should start anew after window")
+}
@@ -0,0 +1,106 @@
+package attempts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryCounter struct {
+	count     int
+	expiresAt time.Time
+}
+
+// Keeps counters in process memory. Used when Redis isn't configured, counters
+// aren't shared between instances then and are lost on restart.
+type MemoryCounter struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+	locks    map[string]time.Time
+}
+
+// Starts a janitor evicting expired counters and locks every janitorInterval
+// until ctx is done.
+func NewMemoryCounter(ctx context.Context, janitorInterval time.Duration) *MemoryCounter {
+	mc := &MemoryCounter{
+		counters: make(map[string]memoryCounter),
+		locks:    make(map[string]time.Time),
+	}
+
+	if janitorInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(janitorInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					mc.purgeExpired()
+				}
+			}
+		}()
+	}
+
+	return mc
+}
+
+func (mc *MemoryCounter) Increment(ctx context.Context, key string, windowSeconds int) (int, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	now := time.Now()
+	counter, ok := mc.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: now.Add(time.Duration(windowSeconds) * time.Second)}
+	}
+	counter.count++
+	mc.counters[key] = counter
+
+	return counter.count, nil
+}
+
+func (mc *MemoryCounter) Reset(ctx context.Context, key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	delete(mc.counters, key)
+	return nil
+}
+
+func (mc *MemoryCounter) Lock(ctx context.Context, key string, seconds int) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.locks[key] = time.Now().Add(time.Duration(seconds) * time.Second)
+	return nil
+}
+
+func (mc *MemoryCounter) LockedFor(ctx context.Context, key string) (int, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	left := time.Until(mc.locks[key])
+	if left <= 0 {
+		return 0, nil
+	}
+	return int((left + time.Second - 1) / time.Second), nil
+}
+
+func (mc *MemoryCounter) purgeExpired() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	now := time.Now()
+	for key, counter := range mc.counters {
+		if !now.Before(counter.expiresAt) {
+			delete(mc.counters, key)
+		}
+	}
+	for key, lockedUntil := range mc.locks {
+		if !now.Before(lockedUntil) {
+			delete(mc.locks, key)
+		}
+	}
+}
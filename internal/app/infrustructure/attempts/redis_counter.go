@@ -0,0 +1,55 @@
+package attempts
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const lockPrefix = "lock:"
+
+// Starts window with the first attempt, so later attempts don't extend it.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// Keeps counters in Redis, so they are shared between instances.
+type RedisCounter struct {
+	client redis.Cmdable
+}
+
+func NewRedisCounter(client redis.Cmdable) *RedisCounter {
+	return &RedisCounter{
+		client: client,
+	}
+}
+
+func (rc *RedisCounter) Increment(ctx context.Context, key string, windowSeconds int) (int, error) {
+	return incrementScript.Run(ctx, rc.client, []string{key}, windowSeconds).Int()
+}
+
+func (rc *RedisCounter) Reset(ctx context.Context, key string) error {
+	return rc.client.Del(ctx, key).Err()
+}
+
+func (rc *RedisCounter) Lock(ctx context.Context, key string, seconds int) error {
+	return rc.client.Set(ctx, lockPrefix+key, 1, time.Duration(seconds)*time.Second).Err()
+}
+
+func (rc *RedisCounter) LockedFor(ctx context.Context, key string) (int, error) {
+	ttl, err := rc.client.TTL(ctx, lockPrefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Negative TTL means there is no lock, or it has no expiry which is never
+	// set by Lock.
+	if ttl <= 0 {
+		return 0, nil
+	}
+	return int((ttl + time.Second - 1) / time.Second), nil
+}
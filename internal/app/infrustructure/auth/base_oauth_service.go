@@ -1,147 +1,172 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
 )
 
-type OAuthServiceOptions struct {
-	BaseURL  string
-	Services []BaseOAuthService
-}
+// Upper bound for token and profile responses, real ones are a few kilobytes.
+const maxResponseSize = 1 << 20
 
 type BaseOAuthService struct {
 	BaseURL string
 	options *config.BaseOAuthProviderOptions
+	client  *http.Client
+
+	// Authorization scheme used to present access token to profile endpoint.
+	tokenType string
+	// Provider specific parameters added to consent page URL.
+	authParams url.Values
 }
 
-func NewBaseOAuthService(options *config.BaseOAuthProviderOptions) BaseOAuthService {
-	return BaseOAuthService{
-		options: options,
+func NewBaseOAuthService(options *config.BaseOAuthProviderOptions) *BaseOAuthService {
+	return &BaseOAuthService{
+		options:   options,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		tokenType: "Bearer",
 	}
 }
 
-func (bos BaseOAuthService) RedirectURL() string {
-	return bos.BaseURL + "/auth/oauth/callback/" + bos.options.Name
+func (bos *BaseOAuthService) Name() string {
+	return bos.options.Name
 }
 
-func (bos BaseOAuthService) Options() *config.BaseOAuthProviderOptions {
-	return bos.options
+func (bos *BaseOAuthService) Method() entities.AuthMethod {
+	return bos.options.Method
 }
 
-func (bos BaseOAuthService) ExtractUserInfo(data map[string]interface{}) (dtos.OAuthUserDto, error) {
-	dto := dtos.OAuthUserDto{}
-	var ok bool
+func (bos *BaseOAuthService) SetBaseURL(baseURL string) {
+	bos.BaseURL = baseURL
+}
 
-	if dto.ID, ok = data["id"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid ID field")
-	}
-	if dto.Picture, ok = data["picture"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid Picture field")
-	}
-	if dto.Name, ok = data["name"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid Name field")
-	}
-	if dto.Email, ok = data["email"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid Email field")
-	}
-	if dto.AccessToken, ok = data["access_token"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid AccessToken field")
-	}
-	if dto.RefreshToken, ok = data["refresh_token"].(string); !ok {
-		return dto, fmt.Errorf("missing or invalid RefreshToken field")
-	}
-	if expiresAt, ok := data["expires_at"].(float64); ok {
-		dto.ExpiresAt = int64(expiresAt)
-	} else {
-		return dto, fmt.Errorf("missing or invalid ExpiresAt field")
-	}
-	dto.Provider = bos.options.Name
+func (bos *BaseOAuthService) RedirectURL() string {
+	return bos.BaseURL + "/auth/oauth/callback/" + bos.options.Name
+}
 
-	return dto, nil
+func (bos *BaseOAuthService) Options() *config.BaseOAuthProviderOptions {
+	return bos.options
 }
 
-func (bos BaseOAuthService) AuthURL() string {
+func (bos *BaseOAuthService) AuthURL(flow dtos.OAuthStateDto) string {
 	query := url.Values{}
 	query.Add("response_type", "code")
 	query.Add("client_id", bos.options.ClientID)
 	query.Add("redirect_uri", bos.RedirectURL())
 	query.Add("scope", strings.Join(bos.options.Scopes, " "))
-	query.Add("access_type", "offline")
-	query.Add("prompt", "select_account")
+	for name, values := range bos.authParams {
+		for _, value := range values {
+			query.Add(name, value)
+		}
+	}
+	query.Add("state", flow.State)
+	query.Add("code_challenge", CodeChallenge(flow.CodeVerifier))
+	query.Add("code_challenge_method", CodeChallengeMethod)
+	if flow.Nonce != "" {
+		query.Add("nonce", flow.Nonce)
+	}
 	return fmt.Sprintf("%s?%s", bos.options.AuthorizeURL, query.Encode())
 }
 
-func (bos BaseOAuthService) FindUserByCode(code string) (dtos.OAuthUserDto, error) {
+func (bos *BaseOAuthService) ExchangeCode(ctx context.Context, code string, flow dtos.OAuthStateDto) (*Token, error) {
 	tokenQuery := url.Values{}
 	tokenQuery.Set("client_id", bos.options.ClientID)
 	tokenQuery.Set("client_secret", bos.options.ClientSecret)
 	tokenQuery.Set("redirect_uri", bos.RedirectURL())
 	tokenQuery.Set("grant_type", "authorization_code")
 	tokenQuery.Set("code", code)
+	tokenQuery.Set("code_verifier", flow.CodeVerifier)
 
-	resp, err := http.Post(bos.options.AccessURL, "application/x-www-form-urlencoded", strings.NewReader(tokenQuery.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, bos.options.AccessURL, strings.NewReader(tokenQuery.Encode()))
 	if err != nil {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to request token: %v", err)
+		return nil, fmt.Errorf("failed to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := bos.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to request token: %s", resp.Status)
+		return nil, fmt.Errorf("failed to request token: %s", resp.Status)
 	}
 
-	var tokenResponse struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		ExpiresIn    int64  `json:"expires_in"`
-		ExpiresAt    int64  `json:"expires_at"`
+	var token Token
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %v", err)
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to decode token response: %v", err)
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response doesn't contain access token")
 	}
 
-	userRequest, err := http.NewRequest("GET", bos.options.ProfileURL, nil)
+	return &token, nil
+}
+
+func (bos *BaseOAuthService) FetchProfile(ctx context.Context, token *Token, _ dtos.OAuthStateDto) ([]byte, error) {
+	userRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, bos.options.ProfileURL, nil)
 	if err != nil {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to create user info request: %v", err)
+		return nil, fmt.Errorf("failed to create user info request: %v", err)
 	}
-	userRequest.Header.Set("Authorization", "Bearer "+tokenResponse.AccessToken)
+	userRequest.Header.Set("Authorization", bos.tokenType+" "+token.AccessToken)
+	userRequest.Header.Set("Accept", "application/json")
 
-	client := &http.Client{}
-	userResp, err := client.Do(userRequest)
+	userResp, err := bos.client.Do(userRequest)
 	if err != nil {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to fetch user info: %v", err)
+		return nil, fmt.Errorf("failed to fetch user info: %v", err)
 	}
 	defer userResp.Body.Close()
 
 	if userResp.StatusCode != http.StatusOK {
-		return dtos.OAuthUserDto{}, fmt.Errorf("unauthorized: could not fetch user info from %s, check the access token", bos.options.ProfileURL)
+		return nil, fmt.Errorf("unauthorized: could not fetch user info from %s, check the access token", bos.options.ProfileURL)
 	}
 
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(userResp.Request.Body).Decode(&userInfo); err != nil {
+	profile, err := io.ReadAll(io.LimitReader(userResp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user info response: %v", err)
+	}
+
+	return profile, nil
+}
+
+// Maps profile with standard OpenID Connect claims (sub, email, name, picture).
+// Providers with other profile shapes override it.
+func (bos *BaseOAuthService) MapProfile(profile []byte) (dtos.OAuthUserDto, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(profile, &data); err != nil {
 		return dtos.OAuthUserDto{}, fmt.Errorf("failed to decode user from response: %v", err)
 	}
 
-	userData, err := bos.ExtractUserInfo(userInfo)
-	if err != nil {
-		return dtos.OAuthUserDto{}, fmt.Errorf("failed to extract userData from decoded json: %v", err)
+	return bos.ExtractUserInfo(data)
+}
+
+func (bos *BaseOAuthService) ExtractUserInfo(data map[string]interface{}) (dtos.OAuthUserDto, error) {
+	dto := dtos.OAuthUserDto{}
+	var ok bool
+
+	if dto.ID, ok = data["id"].(string); !ok {
+		if dto.ID, ok = data["sub"].(string); !ok {
+			return dto, fmt.Errorf("missing or invalid ID field")
+		}
+	}
+	if dto.Email, ok = data["email"].(string); !ok || dto.Email == "" {
+		return dto, fmt.Errorf("missing or invalid Email field")
 	}
+	dto.EmailVerified, _ = data["email_verified"].(bool)
+	dto.Picture, _ = data["picture"].(string)
+	dto.Name, _ = data["name"].(string)
+	dto.Provider = bos.options.Name
 
-	return dtos.OAuthUserDto{
-		AccessToken:  tokenResponse.AccessToken,
-		RefreshToken: tokenResponse.RefreshToken,
-		ExpiresAt:    tokenResponse.ExpiresAt,
-		Provider:     bos.options.Name,
-		ID:           userData.ID,
-		Picture:      userData.Picture,
-		Name:         userData.Name,
-		Email:        userData.Email,
-	}, nil
+	return dto, nil
 }
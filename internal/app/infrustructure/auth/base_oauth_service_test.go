@@ -0,0 +1,152 @@
+package auth_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeProviderService(fp *test.FakeOAuthProvider) *auth.BaseOAuthService {
+	service := auth.NewBaseOAuthService(&config.BaseOAuthProviderOptions{
+		Name:         "fake",
+		Method:       entities.Google,
+		AuthorizeURL: fp.AuthorizeURL(),
+		AccessURL:    fp.AccessURL(),
+		ProfileURL:   fp.ProfileURL(),
+		Scopes:       []string{"email", "profile"},
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+	})
+	service.SetBaseURL("http://localhost:8080")
+	return service
+}
+
+var fakeState = dtos.OAuthStateDto{
+	Provider:     "fake",
+	State:        "expected-state",
+	CodeVerifier: "code-verifier",
+}
+
+func TestBaseOAuthService_AuthURL(t *testing.T) {
+	t.Parallel()
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{})
+	service := newFakeProviderService(fp)
+
+	authURL, err := url.Parse(service.AuthURL(dtos.OAuthStateDto{
+		Provider:     "fake",
+		State:        "state",
+		CodeVerifier: "verifier",
+		Nonce:        "nonce",
+	}))
+	require.NoError(t, err)
+
+	query := authURL.Query()
+	assert.Equal(t, "client-id", query.Get("client_id"))
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, auth.CodeChallenge("verifier"), query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, "email profile", query.Get("scope"))
+	assert.False(t, query.Has("access_type"), "Provider specific parameters shouldn't be sent by default")
+	assert.False(t, query.Has("prompt"), "Provider specific parameters shouldn't be sent by default")
+}
+
+func TestGoogleProvider_AuthURL(t *testing.T) {
+	t.Parallel()
+
+	provider := auth.NewGoogleProvider(config.OAuthProviderOptions{CliendID: "client-id"})
+
+	authURL, err := url.Parse(provider.AuthURL(fakeState))
+	require.NoError(t, err)
+
+	query := authURL.Query()
+	assert.Equal(t, "offline", query.Get("access_type"))
+	assert.Equal(t, "select_account", query.Get("prompt"))
+	assert.Equal(t, "expected-state", query.Get("state"))
+}
+
+func TestCodeChallenge_RFC7636Example(t *testing.T) {
+	t.Parallel()
+
+	// Appendix B of RFC 7636.
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		auth.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestBaseOAuthService_FindUserByCode_Success(t *testing.T) {
+	t.Parallel()
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+		"sub":     "provider-user-id",
+		"email":   "user@example.com",
+		"name":    "User",
+		"picture": "https://example.com/user.jpg",
+	})
+	service := newFakeProviderService(fp)
+
+	dto, err := auth.FindUserByCode(context.Background(), service, test.FakeOAuthCode, "expected-state", fakeState)
+
+	require.NoError(t, err)
+	assert.Equal(t, "provider-user-id", dto.ID)
+	assert.Equal(t, "user@example.com", dto.Email)
+	assert.Equal(t, "User", dto.Name)
+	assert.Equal(t, "https://example.com/user.jpg", dto.Picture)
+	assert.Equal(t, test.FakeOAuthAccessToken, dto.AccessToken)
+	assert.Equal(t, "fake-refresh-token", dto.RefreshToken)
+	assert.NotZero(t, dto.ExpiresAt)
+	assert.Equal(t, "fake", dto.Provider)
+
+	tokenRequest := fp.TokenRequest()
+	assert.Equal(t, "authorization_code", tokenRequest.Get("grant_type"))
+	assert.Equal(t, "http://localhost:8080/auth/oauth/callback/fake", tokenRequest.Get("redirect_uri"))
+	assert.Equal(t, "code-verifier", tokenRequest.Get("code_verifier"))
+}
+
+func TestBaseOAuthService_FindUserByCode_StateMismatch(t *testing.T) {
+	t.Parallel()
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{})
+	service := newFakeProviderService(fp)
+
+	_, err := auth.FindUserByCode(context.Background(), service, test.FakeOAuthCode, "forged-state", fakeState)
+	assert.ErrorIs(t, err, auth.ErrStateMismatch)
+
+	_, err = auth.FindUserByCode(context.Background(), service, test.FakeOAuthCode, "", dtos.OAuthStateDto{Provider: "fake"})
+	assert.ErrorIs(t, err, auth.ErrStateMismatch)
+
+	assert.Nil(t, fp.TokenRequest(), "Code must not be exchanged when state doesn't match")
+}
+
+func TestBaseOAuthService_FindUserByCode_InvalidCode(t *testing.T) {
+	t.Parallel()
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{})
+	service := newFakeProviderService(fp)
+
+	_, err := auth.FindUserByCode(context.Background(), service, "wrong-code", "expected-state", fakeState)
+
+	assert.Error(t, err)
+}
+
+func TestBaseOAuthService_FindUserByCode_MissingEmail(t *testing.T) {
+	t.Parallel()
+
+	fp := test.NewFakeOAuthProvider(t, map[string]interface{}{
+		"sub": "provider-user-id",
+	})
+	service := newFakeProviderService(fp)
+
+	_, err := auth.FindUserByCode(context.Background(), service, test.FakeOAuthCode, "expected-state", fakeState)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Email")
+}
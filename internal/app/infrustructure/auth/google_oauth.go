@@ -1,7 +1,12 @@
 package auth
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
 	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
 )
 
@@ -14,7 +19,7 @@ type GoogleProfile struct {
 	FamilyName      string `json:"family_name,omitempty"`
 	GivenName       string `json:"given_name"`
 	Hd              string `json:"hd,omitempty"`
-	Iat             string `json:"iat"`
+	Iat             int64  `json:"iat"`
 	Iss             string `json:"iss"`
 	Jti             string `json:"jti,omitempty"`
 	Locale          string `json:"locale,omitempty"`
@@ -27,12 +32,13 @@ type GoogleProfile struct {
 }
 
 type GoogleProvider struct {
-	base BaseOAuthService
+	*BaseOAuthService
 }
 
-func NewGoogleProvider(options config.OAuthProviderOptions) GoogleProvider {
+func NewGoogleProvider(options config.OAuthProviderOptions) *GoogleProvider {
 	baseOptions := config.BaseOAuthProviderOptions{
 		Name:         "google",
+		Method:       entities.Google,
 		AuthorizeURL: "https://accounts.google.com/o/oauth2/v2/auth",
 		AccessURL:    "https://oauth2.googleapis.com/token",
 		ProfileURL:   "https://www.googleapis.com/oauth2/v3/userinfo",
@@ -40,15 +46,42 @@ func NewGoogleProvider(options config.OAuthProviderOptions) GoogleProvider {
 		ClientID:     options.CliendID,
 		ClientSecret: options.ClientSecret,
 	}
-	return GoogleProvider{
-		base: NewBaseOAuthService(&baseOptions),
+	base := NewBaseOAuthService(&baseOptions)
+	// Refresh token is issued only for offline access, and users with several
+	// Google accounts get to pick one.
+	base.authParams = url.Values{
+		"access_type": {"offline"},
+		"prompt":      {"select_account"},
+	}
+
+	return &GoogleProvider{
+		BaseOAuthService: base,
+	}
+}
+
+func (gp *GoogleProvider) MapProfile(profile []byte) (dtos.OAuthUserDto, error) {
+	var data GoogleProfile
+	if err := json.Unmarshal(profile, &data); err != nil {
+		return dtos.OAuthUserDto{}, fmt.Errorf("failed to decode google profile: %v", err)
 	}
+
+	return gp.ExtractUserInfo(&data)
 }
 
-func (gp GoogleProvider) ExtractUserInfo(data *GoogleProfile) (dtos.OAuthUserDto, error) {
-	return gp.base.ExtractUserInfo(map[string]interface{}{
-		"email":   data.Email,
-		"name":    data.Name,
-		"picture": data.Picture,
-	})
+func (gp *GoogleProvider) ExtractUserInfo(data *GoogleProfile) (dtos.OAuthUserDto, error) {
+	if data.Sub == "" {
+		return dtos.OAuthUserDto{}, fmt.Errorf("missing or invalid ID field")
+	}
+	if data.Email == "" {
+		return dtos.OAuthUserDto{}, fmt.Errorf("missing or invalid Email field")
+	}
+
+	return dtos.OAuthUserDto{
+		ID:            data.Sub,
+		Picture:       data.Picture,
+		Name:          data.Name,
+		Email:         data.Email,
+		EmailVerified: data.IsEmailVerified,
+		Provider:      gp.Name(),
+	}, nil
 }
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+)
+
+var ErrStateMismatch = errors.New("oauth state mismatch")
+
+// OAuthProvider is implemented by every OAuth login provider. BaseOAuthService
+// implements the protocol steps shared by all of them, so providers usually
+// embed it and override only MapProfile.
+type OAuthProvider interface {
+	Name() string
+	Method() entities.AuthMethod
+	SetBaseURL(baseURL string)
+	RedirectURL() string
+
+	// Builds provider's consent page URL carrying flow's state, nonce and
+	// S256 PKCE code challenge derived from its code verifier.
+	AuthURL(flow dtos.OAuthStateDto) string
+	// Exchanges authorization code for tokens.
+	ExchangeCode(ctx context.Context, code string, flow dtos.OAuthStateDto) (*Token, error)
+	// Fetches raw profile of the user the token was issued for.
+	FetchProfile(ctx context.Context, token *Token, flow dtos.OAuthStateDto) ([]byte, error)
+	// Maps raw provider specific profile to OAuthUserDto.
+	MapProfile(profile []byte) (dtos.OAuthUserDto, error)
+}
+
+type OAuthServiceOptions struct {
+	BaseURL  string
+	Services []OAuthProvider
+}
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// Validates callback state against the one issued with AuthURL, exchanges
+// authorization code (with PKCE code verifier) for tokens and returns mapped
+// profile of the user.
+func FindUserByCode(ctx context.Context, provider OAuthProvider, code string, state string,
+	expected dtos.OAuthStateDto) (dtos.OAuthUserDto, error) {
+	if expected.State == "" || expected.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(expected.State)) != 1 {
+		return dtos.OAuthUserDto{}, ErrStateMismatch
+	}
+
+	token, err := provider.ExchangeCode(ctx, code, expected)
+	if err != nil {
+		return dtos.OAuthUserDto{}, err
+	}
+
+	profile, err := provider.FetchProfile(ctx, token, expected)
+	if err != nil {
+		return dtos.OAuthUserDto{}, err
+	}
+
+	userData, err := provider.MapProfile(profile)
+	if err != nil {
+		return dtos.OAuthUserDto{}, fmt.Errorf("failed to extract userData from profile: %v", err)
+	}
+
+	expiresAt := token.ExpiresAt
+	if expiresAt == 0 && token.ExpiresIn > 0 {
+		expiresAt = time.Now().Unix() + token.ExpiresIn
+	}
+
+	userData.AccessToken = token.AccessToken
+	userData.RefreshToken = token.RefreshToken
+	userData.ExpiresAt = expiresAt
+	userData.Provider = provider.Name()
+
+	return userData, nil
+}
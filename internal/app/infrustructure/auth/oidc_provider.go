@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+var ErrNonceMismatch = errors.New("id_token nonce mismatch")
+
+// OIDCProvider is a generic OpenID Connect provider configured from issuer's
+// discovery document. Profile is taken from verified ID token claims and
+// completed from userinfo endpoint when the token doesn't carry them. Missing
+// email_verified claim maps to unverified email; whether such email may be used
+// to link an existing user is left to the OAuth service.
+type OIDCProvider struct {
+	*BaseOAuthService
+	verifier *oidc.IDTokenVerifier
+}
+
+// Fetches issuer's /.well-known/openid-configuration and builds provider from it.
+// Signing keys are fetched from issuer's JWKS endpoint lazily and refreshed on
+// unknown key ID.
+func NewOIDCProvider(ctx context.Context, options config.OIDCProviderOptions) (*OIDCProvider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), options.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s issuer configuration: %w", options.Name, err)
+	}
+
+	endpoint := provider.Endpoint()
+	baseOptions := config.BaseOAuthProviderOptions{
+		Name:         options.Name,
+		Method:       entities.OpenID,
+		AuthorizeURL: endpoint.AuthURL,
+		AccessURL:    endpoint.TokenURL,
+		ProfileURL:   provider.UserInfoEndpoint(),
+		Scopes:       options.Scopes,
+		ClientID:     options.ClientID,
+		ClientSecret: options.ClientSecret,
+	}
+	base := NewBaseOAuthService(&baseOptions)
+	base.client = client
+
+	return &OIDCProvider{
+		BaseOAuthService: base,
+		verifier:         provider.Verifier(&oidc.Config{ClientID: options.ClientID}),
+	}, nil
+}
+
+// Verifies ID token signature, issuer, audience, expiry and nonce and returns its
+// claims merged with userinfo claims missing from the token.
+func (op *OIDCProvider) FetchProfile(ctx context.Context, token *Token, flow dtos.OAuthStateDto) ([]byte, error) {
+	if token.IDToken == "" {
+		return nil, errors.New("token response doesn't contain id_token")
+	}
+
+	idToken, err := op.verifier.Verify(ctx, token.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if flow.Nonce == "" || subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return nil, ErrNonceMismatch
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+
+	if _, ok := claims["email"]; !ok && op.options.ProfileURL != "" {
+		profile, err := op.BaseOAuthService.FetchProfile(ctx, token, flow)
+		if err != nil {
+			return nil, err
+		}
+
+		userInfo := map[string]interface{}{}
+		if err := json.Unmarshal(profile, &userInfo); err != nil {
+			return nil, fmt.Errorf("failed to decode user from response: %v", err)
+		}
+		// Userinfo response must describe the same subject as the ID token.
+		if sub, _ := userInfo["sub"].(string); sub != idToken.Subject {
+			return nil, errors.New("userinfo subject doesn't match id_token subject")
+		}
+
+		for claim, value := range userInfo {
+			if _, ok := claims[claim]; !ok {
+				claims[claim] = value
+			}
+		}
+	}
+
+	return json.Marshal(claims)
+}
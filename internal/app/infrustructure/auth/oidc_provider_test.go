@@ -0,0 +1,219 @@
+package auth_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var oidcFlow = dtos.OAuthStateDto{
+	Provider:     "corp",
+	State:        "expected-state",
+	CodeVerifier: "code-verifier",
+	Nonce:        "expected-nonce",
+}
+
+func newOIDCProvider(t *testing.T, issuer *test.FakeOIDCIssuer) *auth.OIDCProvider {
+	provider, err := auth.NewOIDCProvider(context.Background(), config.OIDCProviderOptions{
+		Name:      "corp",
+		IssuerURL: issuer.URL(),
+		Scopes:    []string{"openid", "email", "profile"},
+		ClientID:  "client-id",
+	})
+	require.NoError(t, err)
+	provider.SetBaseURL("http://localhost:8080")
+	return provider
+}
+
+func TestOIDCProvider_Discovery(t *testing.T) {
+	t.Parallel()
+
+	issuer := test.NewFakeOIDCIssuer(t, "client-id")
+	provider := newOIDCProvider(t, issuer)
+
+	assert.Equal(t, "corp", provider.Name())
+	assert.Equal(t, entities.OpenID, provider.Method())
+	assert.Equal(t, issuer.URL()+"/token", provider.Options().AccessURL)
+	assert.Equal(t, issuer.URL()+"/userinfo", provider.Options().ProfileURL)
+
+	authURL, err := url.Parse(provider.AuthURL(oidcFlow))
+	require.NoError(t, err)
+	assert.Equal(t, issuer.URL()+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "expected-nonce", authURL.Query().Get("nonce"))
+}
+
+func TestOIDCProvider_Discovery_IssuerMismatch(t *testing.T) {
+	t.Parallel()
+
+	issuer := test.NewFakeOIDCIssuer(t, "client-id")
+
+	_, err := auth.NewOIDCProvider(context.Background(), config.OIDCProviderOptions{
+		Name:      "corp",
+		IssuerURL: issuer.URL() + "/other",
+		ClientID:  "client-id",
+	})
+
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_FindUserByCode(t *testing.T) {
+	t.Parallel()
+
+	issuer := test.NewFakeOIDCIssuer(t, "client-id")
+	issuer.SetIDTokenClaims(map[string]interface{}{
+		"nonce":          "expected-nonce",
+		"email":          "user@corp.example",
+		"email_verified": true,
+		"name":           "Corp User",
+	})
+	provider := newOIDCProvider(t, issuer)
+
+	dto, err := auth.FindUserByCode(context.Background(), provider, test.FakeOAuthCode, "expected-state", oidcFlow)
+
+	require.NoError(t, err)
+	assert.Equal(t, test.FakeOIDCSubject, dto.ID)
+	assert.Equal(t, "user@corp.example", dto.Email)
+	assert.Equal(t, "Corp User", dto.Name)
+	assert.True(t, dto.EmailVerified)
+	assert.Equal(t, "corp", dto.Provider)
+	assert.Equal(t, test.FakeOAuthAccessToken, dto.AccessToken)
+}
+
+func TestOIDCProvider_FindUserByCode_FillsClaimsFromUserInfo(t *testing.T) {
+	t.Parallel()
+
+	issuer := test.NewFakeOIDCIssuer(t, "client-id")
+	issuer.SetIDTokenClaims(map[string]interface{}{"nonce": "expected-nonce"})
+	issuer.SetUserInfo(map[string]interface{}{
+		"sub":            test.FakeOIDCSubject,
+		"email":          "user@corp.example",
+		"email_verified": true,
+		"picture":        "https://corp.example/user.jpg",
+	})
+	provider := newOIDCProvider(t, issuer)
+
+	dto, err := auth.FindUserByCode(context.Background(), provider, test.FakeOAuthCode, "expected-state", oidcFlow)
+
+	require.NoError(t, err)
+	assert.Equal(t, "user@corp.example", dto.Email)
+	assert.Equal(t, "https://corp.example/user.jpg", dto.Picture)
+
+	issuer.SetUserInfo(map[string]interface{}{"sub": "someone-else", "email": "other@corp.example"})
+	_, err = auth.FindUserByCode(context.Background(), provider, test.FakeOAuthCode, "expected-state", oidcFlow)
+	assert.Error(t, err, "Userinfo for another subject must be rejected")
+}
+
+func TestOIDCProvider_FindUserByCode_MapsUnverifiedEmail(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		verified interface{}
+	}{
+		{name: "unverified email", verified: false},
+		{name: "missing email_verified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims := map[string]interface{}{
+				"nonce": "expected-nonce",
+				"email": "user@corp.example",
+			}
+			if tt.verified != nil {
+				claims["email_verified"] = tt.verified
+			}
+			issuer := test.NewFakeOIDCIssuer(t, "client-id")
+			issuer.SetIDTokenClaims(claims)
+			provider := newOIDCProvider(t, issuer)
+
+			dto, err := auth.FindUserByCode(context.Background(), provider, test.FakeOAuthCode, "expected-state", oidcFlow)
+
+			require.NoError(t, err)
+			assert.Equal(t, "user@corp.example", dto.Email)
+			assert.False(t, dto.EmailVerified)
+		})
+	}
+}
+
+func TestOIDCProvider_FindUserByCode_RejectsInvalidIDToken(t *testing.T) {
+	t.Parallel()
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"nonce":          "expected-nonce",
+			"email":          "user@corp.example",
+			"email_verified": true,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		setup func(issuer *test.FakeOIDCIssuer)
+	}{
+		{
+			name: "wrong nonce",
+			setup: func(issuer *test.FakeOIDCIssuer) {
+				claims := validClaims()
+				claims["nonce"] = "replayed-nonce"
+				issuer.SetIDTokenClaims(claims)
+			},
+		},
+		{
+			name: "wrong audience",
+			setup: func(issuer *test.FakeOIDCIssuer) {
+				claims := validClaims()
+				claims["aud"] = "another-client"
+				issuer.SetIDTokenClaims(claims)
+			},
+		},
+		{
+			name: "wrong issuer",
+			setup: func(issuer *test.FakeOIDCIssuer) {
+				claims := validClaims()
+				claims["iss"] = "https://evil.example"
+				issuer.SetIDTokenClaims(claims)
+			},
+		},
+		{
+			name: "expired",
+			setup: func(issuer *test.FakeOIDCIssuer) {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				issuer.SetIDTokenClaims(claims)
+			},
+		},
+		{
+			name: "unknown signing key",
+			setup: func(issuer *test.FakeOIDCIssuer) {
+				issuer.SetIDTokenClaims(validClaims())
+				issuer.SignWithUnknownKey()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			issuer := test.NewFakeOIDCIssuer(t, "client-id")
+			tt.setup(issuer)
+			provider := newOIDCProvider(t, issuer)
+
+			_, err := auth.FindUserByCode(context.Background(), provider, test.FakeOAuthCode, "expected-state", oidcFlow)
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPasskey = errors.New("passkey verification failed")
+	// Authenticator reported sign count not greater than stored one, so the
+	// credential may have been cloned.
+	ErrSignCountRegressed = errors.New("passkey sign count regressed, credential may be cloned")
+)
+
+// Finds user by WebAuthn user handle together with user's credentials.
+type PasskeyUserLookup func(userHandle []byte) (*entities.User, []entities.Credential, error)
+
+// Runs WebAuthn ceremonies on top of domain users and credentials. Ceremony
+// state is returned and accepted as opaque bytes to be kept between requests.
+type PasskeyVerifier struct {
+	webAuthn *webauthn.WebAuthn
+}
+
+func NewPasskeyVerifier(options *config.WebAuthnOptions) (*PasskeyVerifier, error) {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          options.RPID,
+		RPDisplayName: options.RPDisplayName,
+		RPOrigins:     options.RPOrigins,
+		// Passkey login gives multi-factor session, so authenticator has to
+		// verify the user, not only their presence.
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn options: %w", err)
+	}
+
+	return &PasskeyVerifier{
+		webAuthn: webAuthn,
+	}, nil
+}
+
+// Starts registration of discoverable credential, excluding ones user already has.
+func (pv *PasskeyVerifier) BeginRegistration(user *entities.User, credentials []entities.Credential) (*protocol.CredentialCreation, []byte, error) {
+	passkeyUser := newPasskeyUser(user, credentials)
+	creation, session, err := pv.webAuthn.BeginRegistration(passkeyUser,
+		webauthn.WithExclusions(webauthn.Credentials(passkeyUser.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal ceremony state: %w", err)
+	}
+
+	return creation, state, nil
+}
+
+// Verifies authenticator's attestation response and returns new credential.
+func (pv *PasskeyVerifier) FinishRegistration(user *entities.User, credentials []entities.Credential,
+	state []byte, response []byte) (*entities.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ceremony state: %w", err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPasskey, describeProtocolError(err))
+	}
+
+	credential, err := pv.webAuthn.CreateCredential(newPasskeyUser(user, credentials), session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPasskey, describeProtocolError(err))
+	}
+
+	now := time.Now().UTC()
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return &entities.Credential{
+		ID:              uuid.NewString(),
+		UserID:          user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+	}, nil
+}
+
+// Starts login with discoverable credential, so user doesn't have to be known
+// upfront. Assertions without user verification are refused.
+func (pv *PasskeyVerifier) BeginLogin() (*protocol.CredentialAssertion, []byte, error) {
+	assertion, session, err := pv.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal ceremony state: %w", err)
+	}
+
+	return assertion, state, nil
+}
+
+// Verifies authenticator's assertion and returns the user with the used
+// credential, which carries updated sign count and flags.
+func (pv *PasskeyVerifier) FinishLogin(state []byte, response []byte, lookup PasskeyUserLookup) (*entities.User, *entities.Credential, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal(state, &session); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal ceremony state: %w", err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPasskey, describeProtocolError(err))
+	}
+
+	var passkeyUser *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, credentials, err := lookup(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		passkeyUser = newPasskeyUser(user, credentials)
+		return passkeyUser, nil
+	}
+
+	_, validated, err := pv.webAuthn.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPasskey, describeProtocolError(err))
+	}
+
+	var stored *entities.Credential
+	for i := range passkeyUser.stored {
+		if bytes.Equal(passkeyUser.stored[i].CredentialID, validated.ID) {
+			stored = &passkeyUser.stored[i]
+			break
+		}
+	}
+	if stored == nil {
+		return nil, nil, ErrInvalidPasskey
+	}
+
+	// Already checked against required user verification, kept in case the
+	// ceremony state was made with weaker requirement.
+	if !validated.Flags.UserVerified {
+		return nil, nil, fmt.Errorf("%w: user wasn't verified", ErrInvalidPasskey)
+	}
+
+	if validated.Authenticator.CloneWarning {
+		return passkeyUser.user, stored, ErrSignCountRegressed
+	}
+
+	stored.SignCount = validated.Authenticator.SignCount
+	stored.BackupState = validated.Flags.BackupState
+	stored.LastUsedAt = time.Now().UTC()
+
+	return passkeyUser.user, stored, nil
+}
+
+// Adapts domain user to webauthn.User. User handle is user's ID.
+type passkeyUser struct {
+	user        *entities.User
+	stored      []entities.Credential
+	credentials []webauthn.Credential
+}
+
+func newPasskeyUser(user *entities.User, stored []entities.Credential) *passkeyUser {
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, c := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, transport := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+
+	return &passkeyUser{
+		user:        user,
+		stored:      stored,
+		credentials: credentials,
+	}
+}
+
+func (pu *passkeyUser) WebAuthnID() []byte {
+	return []byte(pu.user.ID)
+}
+
+func (pu *passkeyUser) WebAuthnName() string {
+	return pu.user.Email
+}
+
+func (pu *passkeyUser) WebAuthnDisplayName() string {
+	return pu.user.Name
+}
+
+func (pu *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return pu.credentials
+}
+
+// Protocol errors keep the reason in details, the message itself is generic.
+func describeProtocolError(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.Details != "" {
+		return protocolErr.Details
+	}
+	return err.Error()
+}
@@ -0,0 +1,190 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	passkeyRPID   = "localhost"
+	passkeyOrigin = "http://localhost:8080"
+)
+
+func newPasskeyVerifier(t *testing.T) *auth.PasskeyVerifier {
+	verifier, err := auth.NewPasskeyVerifier(&config.WebAuthnOptions{
+		RPID:          passkeyRPID,
+		RPDisplayName: "vm-hub",
+		RPOrigins:     []string{passkeyOrigin},
+	})
+	require.NoError(t, err)
+	return verifier
+}
+
+func newPasskeyUser() *entities.User {
+	return &entities.User{
+		ID:    uuid.NewString(),
+		Name:  "Passkey User",
+		Email: "passkey@example.com",
+	}
+}
+
+func registerPasskey(t *testing.T, verifier *auth.PasskeyVerifier, authenticator *test.SoftwareAuthenticator,
+	user *entities.User) *entities.Credential {
+	creation, state, err := verifier.BeginRegistration(user, nil)
+	require.NoError(t, err)
+
+	options, err := json.Marshal(creation)
+	require.NoError(t, err)
+	response, err := authenticator.CreateCredential(options)
+	require.NoError(t, err)
+
+	credential, err := verifier.FinishRegistration(user, nil, state, response)
+	require.NoError(t, err)
+	return credential
+}
+
+func loginWithPasskey(t *testing.T, verifier *auth.PasskeyVerifier, authenticator *test.SoftwareAuthenticator,
+	lookup auth.PasskeyUserLookup) (*entities.User, *entities.Credential, error) {
+	assertion, state, err := verifier.BeginLogin()
+	require.NoError(t, err)
+
+	options, err := json.Marshal(assertion)
+	require.NoError(t, err)
+	response, err := authenticator.GetAssertion(options, passkeyRPID)
+	require.NoError(t, err)
+
+	return verifier.FinishLogin(state, response, lookup)
+}
+
+func TestPasskeyVerifier_RegisterAndLogin(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator(passkeyOrigin)
+	user := newPasskeyUser()
+
+	credential := registerPasskey(t, verifier, authenticator, user)
+	assert.Equal(t, user.ID, credential.UserID)
+	assert.Equal(t, authenticator.CredentialID, credential.CredentialID)
+	assert.Equal(t, []string{"internal"}, credential.Transports)
+	assert.Equal(t, uint32(0), credential.SignCount)
+	assert.Equal(t, []byte(user.ID), authenticator.UserHandle)
+
+	loggedIn, used, err := loginWithPasskey(t, verifier, authenticator,
+		func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+			require.Equal(t, []byte(user.ID), userHandle)
+			return user, []entities.Credential{*credential}, nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+	assert.Equal(t, credential.ID, used.ID)
+	assert.Equal(t, uint32(1), used.SignCount)
+}
+
+func TestPasskeyVerifier_FinishRegistration_WrongOrigin(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator("https://evil.example.com")
+	user := newPasskeyUser()
+
+	creation, state, err := verifier.BeginRegistration(user, nil)
+	require.NoError(t, err)
+	options, err := json.Marshal(creation)
+	require.NoError(t, err)
+	response, err := authenticator.CreateCredential(options)
+	require.NoError(t, err)
+
+	_, err = verifier.FinishRegistration(user, nil, state, response)
+	assert.ErrorIs(t, err, auth.ErrInvalidPasskey)
+}
+
+func TestPasskeyVerifier_FinishLogin_ChallengeMismatch(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator(passkeyOrigin)
+	user := newPasskeyUser()
+	credential := registerPasskey(t, verifier, authenticator, user)
+
+	assertion, _, err := verifier.BeginLogin()
+	require.NoError(t, err)
+	_, otherState, err := verifier.BeginLogin()
+	require.NoError(t, err)
+
+	options, err := json.Marshal(assertion)
+	require.NoError(t, err)
+	response, err := authenticator.GetAssertion(options, passkeyRPID)
+	require.NoError(t, err)
+
+	_, _, err = verifier.FinishLogin(otherState, response,
+		func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+			return user, []entities.Credential{*credential}, nil
+		})
+	assert.ErrorIs(t, err, auth.ErrInvalidPasskey)
+}
+
+func TestPasskeyVerifier_FinishLogin_UnknownUser(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator(passkeyOrigin)
+	registerPasskey(t, verifier, authenticator, newPasskeyUser())
+
+	_, _, err := loginWithPasskey(t, verifier, authenticator,
+		func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+			return nil, nil, errors.New("user not found")
+		})
+	assert.ErrorIs(t, err, auth.ErrInvalidPasskey)
+}
+
+func TestPasskeyVerifier_FinishLogin_SignCountRegressed(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator(passkeyOrigin)
+	user := newPasskeyUser()
+	credential := registerPasskey(t, verifier, authenticator, user)
+
+	// Stored counter is ahead of authenticator, as if a clone was used meanwhile.
+	credential.SignCount = 10
+	authenticator.SignCount = 4
+
+	_, used, err := loginWithPasskey(t, verifier, authenticator,
+		func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+			return user, []entities.Credential{*credential}, nil
+		})
+	assert.ErrorIs(t, err, auth.ErrSignCountRegressed)
+	require.NotNil(t, used)
+	assert.Equal(t, uint32(10), used.SignCount)
+}
+
+func TestPasskeyVerifier_FinishLogin_RequiresUserVerification(t *testing.T) {
+	t.Parallel()
+
+	verifier := newPasskeyVerifier(t)
+	authenticator := test.NewSoftwareAuthenticator(passkeyOrigin)
+	user := newPasskeyUser()
+	credential := registerPasskey(t, verifier, authenticator, user)
+
+	assertion, _, err := verifier.BeginLogin()
+	require.NoError(t, err)
+	assert.Equal(t, protocol.VerificationRequired, assertion.Response.UserVerification)
+
+	authenticator.SkipUserVerification = true
+	_, _, err = loginWithPasskey(t, verifier, authenticator,
+		func(userHandle []byte) (*entities.User, []entities.Credential, error) {
+			return user, []entities.Credential{*credential}, nil
+		})
+	assert.ErrorIs(t, err, auth.ErrInvalidPasskey)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+const CodeChallengeMethod = "S256"
+
+// Returns random URL-safe string built from n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Generates opaque value for the OAuth state parameter.
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+// Generates value for the OpenID Connect nonce parameter which binds ID token
+// to the authorization request.
+func NewNonce() (string, error) {
+	return randomString(32)
+}
+
+// Generates PKCE code verifier as described in RFC 7636, section 4.1.
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// Derives S256 code challenge from PKCE code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
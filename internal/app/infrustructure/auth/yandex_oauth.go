@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+)
+
+const yandexAvatarURL = "https://avatars.yandex.net/get-yandex-passport-avatar/%s/islands-200"
+
+// Profile returned by https://login.yandex.ru/info, see
+// https://yandex.ru/dev/id/doc/en/user-information
+type YandexProfile struct {
+	ID              string   `json:"id"`
+	Login           string   `json:"login"`
+	ClientID        string   `json:"client_id"`
+	DefaultEmail    string   `json:"default_email"`
+	Emails          []string `json:"emails,omitempty"`
+	RealName        string   `json:"real_name"`
+	DisplayName     string   `json:"display_name"`
+	FirstName       string   `json:"first_name,omitempty"`
+	LastName        string   `json:"last_name,omitempty"`
+	DefaultAvatarID string   `json:"default_avatar_id"`
+	IsAvatarEmpty   bool     `json:"is_avatar_empty"`
+}
+
+type YandexProvider struct {
+	*BaseOAuthService
+}
+
+func NewYandexProvider(options config.OAuthProviderOptions) *YandexProvider {
+	baseOptions := config.BaseOAuthProviderOptions{
+		Name:         "yandex",
+		Method:       entities.Yandex,
+		AuthorizeURL: "https://oauth.yandex.ru/authorize",
+		AccessURL:    "https://oauth.yandex.ru/token",
+		ProfileURL:   "https://login.yandex.ru/info?format=json",
+		Scopes:       options.Scopes,
+		ClientID:     options.CliendID,
+		ClientSecret: options.ClientSecret,
+	}
+	base := NewBaseOAuthService(&baseOptions)
+	base.tokenType = "OAuth"
+
+	return &YandexProvider{
+		BaseOAuthService: base,
+	}
+}
+
+func (yp *YandexProvider) MapProfile(profile []byte) (dtos.OAuthUserDto, error) {
+	var data YandexProfile
+	if err := json.Unmarshal(profile, &data); err != nil {
+		return dtos.OAuthUserDto{}, fmt.Errorf("failed to decode yandex profile: %v", err)
+	}
+
+	return yp.ExtractUserInfo(&data)
+}
+
+func (yp *YandexProvider) ExtractUserInfo(data *YandexProfile) (dtos.OAuthUserDto, error) {
+	if data.ID == "" {
+		return dtos.OAuthUserDto{}, fmt.Errorf("missing or invalid ID field")
+	}
+	if data.DefaultEmail == "" {
+		return dtos.OAuthUserDto{}, fmt.Errorf("missing or invalid Email field")
+	}
+
+	// Yandex doesn't tell whether default email is verified, so it isn't
+	// trusted to link existing users.
+	dto := dtos.OAuthUserDto{
+		ID:       data.ID,
+		Name:     data.RealName,
+		Email:    data.DefaultEmail,
+		Provider: yp.Name(),
+	}
+	if dto.Name == "" {
+		dto.Name = data.DisplayName
+	}
+	if data.DefaultAvatarID != "" && !data.IsAvatarEmpty {
+		dto.Picture = fmt.Sprintf(yandexAvatarURL, data.DefaultAvatarID)
+	}
+
+	return dto, nil
+}
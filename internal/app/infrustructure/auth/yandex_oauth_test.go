@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/auth"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYandexProvider_MapProfile(t *testing.T) {
+	t.Parallel()
+
+	provider := auth.NewYandexProvider(config.OAuthProviderOptions{CliendID: "client-id"})
+
+	dto, err := provider.MapProfile([]byte(`{
+		"id": "1000034426",
+		"login": "ivan",
+		"client_id": "client-id",
+		"default_email": "ivan@yandex.ru",
+		"emails": ["ivan@yandex.ru"],
+		"real_name": "Ivan Ivanov",
+		"display_name": "ivan",
+		"default_avatar_id": "131652443",
+		"is_avatar_empty": false
+	}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, "1000034426", dto.ID)
+	assert.Equal(t, "ivan@yandex.ru", dto.Email)
+	assert.Equal(t, "Ivan Ivanov", dto.Name)
+	assert.Equal(t, "https://avatars.yandex.net/get-yandex-passport-avatar/131652443/islands-200", dto.Picture)
+	assert.Equal(t, "yandex", dto.Provider)
+}
+
+func TestYandexProvider_ExtractUserInfo_Fallbacks(t *testing.T) {
+	t.Parallel()
+
+	provider := auth.NewYandexProvider(config.OAuthProviderOptions{})
+
+	dto, err := provider.ExtractUserInfo(&auth.YandexProfile{
+		ID:              "1000034426",
+		DefaultEmail:    "ivan@yandex.ru",
+		DisplayName:     "ivan",
+		DefaultAvatarID: "0/0-0",
+		IsAvatarEmpty:   true,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "ivan", dto.Name)
+	assert.Empty(t, dto.Picture)
+
+	_, err = provider.ExtractUserInfo(&auth.YandexProfile{ID: "1000034426"})
+	assert.Error(t, err, "Profile without default_email should be rejected")
+}
+
+func TestGoogleProvider_MapProfile(t *testing.T) {
+	t.Parallel()
+
+	provider := auth.NewGoogleProvider(config.OAuthProviderOptions{CliendID: "client-id"})
+
+	dto, err := provider.MapProfile([]byte(`{
+		"sub": "110169484474386276334",
+		"email": "user@gmail.com",
+		"email_verified": true,
+		"name": "User",
+		"picture": "https://lh3.googleusercontent.com/a/photo.jpg"
+	}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, "110169484474386276334", dto.ID)
+	assert.Equal(t, "user@gmail.com", dto.Email)
+	assert.Equal(t, "User", dto.Name)
+	assert.Equal(t, "https://lh3.googleusercontent.com/a/photo.jpg", dto.Picture)
+	assert.Equal(t, "google", dto.Provider)
+}
+
+func TestProviderService_GetServiceByName(t *testing.T) {
+	t.Parallel()
+
+	yandex := auth.NewYandexProvider(config.OAuthProviderOptions{CliendID: "client-id"})
+	google := auth.NewGoogleProvider(config.OAuthProviderOptions{CliendID: "client-id"})
+	ps := services.NewProviderService(&auth.OAuthServiceOptions{
+		BaseURL:  "http://localhost:8080",
+		Services: []auth.OAuthProvider{google, yandex},
+	})
+
+	service := ps.GetServiceByName("yandex")
+	require.NotNil(t, service)
+	assert.Equal(t, entities.Yandex, service.Method())
+	assert.Equal(t, "http://localhost:8080/auth/oauth/callback/yandex", service.RedirectURL())
+
+	service = ps.GetServiceByName("google")
+	require.NotNil(t, service)
+	assert.Equal(t, entities.Google, service.Method())
+
+	assert.Nil(t, ps.GetServiceByName("github"))
+}
@@ -0,0 +1,184 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	prefixLength = 5
+	hashLength   = 40
+)
+
+// Looks up breached SHA-1 hashes in a local file sorted by hash, so breached
+// passwords are checked without network access. Ranges are found by binary
+// search on demand, only a few KB of the file are read per lookup, so the
+// full Pwned Passwords corpus doesn't have to fit into memory.
+type FileSource struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// Opens file in the format of Pwned Passwords downloads ordered by hash: one
+// uppercase or lowercase hex SHA-1 hash per line, optionally followed by
+// ":<count>". Empty lines and lines starting with # are skipped. The file is
+// kept open and is only checked as far as it's read, so lines of unsorted or
+// malformed files make lookups fail or go unnoticed.
+func NewFileSource(path string) (*FileSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+	}
+
+	fs := &FileSource{r: file, size: info.Size()}
+	// Catches files of other formats early, e.g. plain passwords.
+	if _, _, _, err := nextEntry(bufio.NewReader(io.NewSectionReader(file, 0, fs.size))); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to load breached passwords file %s: %w", path, err)
+	}
+	return fs, nil
+}
+
+// Reads hashes from r in the format NewFileSource expects, except they don't
+// have to be sorted. Every line is checked and the whole list is kept in
+// memory, so it's meant for short lists.
+func ReadSource(r io.Reader) (*FileSource, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hash, count, ok, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			lines = append(lines, hash+":"+strconv.Itoa(count))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(lines)
+	data := []byte(strings.Join(lines, "\n"))
+	return &FileSource{r: bytes.NewReader(data), size: int64(len(data))}, nil
+}
+
+func (fs *FileSource) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != prefixLength {
+		return nil, fmt.Errorf("prefix has to be %d characters long", prefixLength)
+	}
+
+	// Finds the smallest offset whose next line has hash not below prefix.
+	// Hash of the next line only grows with offset, as lines are sorted.
+	var searchErr error
+	offset := sort.Search(int(fs.size), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		hash, _, ok, err := nextEntry(fs.linesFrom(int64(i)))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return !ok || hash[:prefixLength] >= prefix
+	})
+	if searchErr != nil {
+		return nil, fmt.Errorf("failed to search breached passwords: %w", searchErr)
+	}
+
+	suffixes := make(map[string]int)
+	lines := fs.linesFrom(int64(offset))
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hash, count, ok, err := nextEntry(lines)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read breached passwords: %w", err)
+		}
+		if !ok || hash[:prefixLength] != prefix {
+			return suffixes, nil
+		}
+		suffixes[hash[prefixLength:]] += count
+	}
+}
+
+// Returns reader of lines starting at or after offset. Line offset falls
+// into is skipped, unless offset is where it starts.
+func (fs *FileSource) linesFrom(offset int64) *bufio.Reader {
+	if offset == 0 {
+		return bufio.NewReader(io.NewSectionReader(fs.r, 0, fs.size))
+	}
+
+	lines := bufio.NewReader(io.NewSectionReader(fs.r, offset-1, fs.size-offset+1))
+	lines.ReadString('\n')
+	return lines
+}
+
+// Returns the next hash of lines with its count. ok is false once lines are
+// over.
+func nextEntry(lines *bufio.Reader) (hash string, count int, ok bool, err error) {
+	for {
+		text, readErr := lines.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return "", 0, false, readErr
+		}
+
+		hash, count, ok, err = parseLine(text)
+		if err != nil || ok {
+			return hash, count, ok, err
+		}
+		if readErr != nil {
+			return "", 0, false, nil
+		}
+	}
+}
+
+// Parses line holding hash and optional count. ok is false for empty lines
+// and comments.
+func parseLine(text string) (hash string, count int, ok bool, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return "", 0, false, nil
+	}
+
+	hash, countStr, hasCount := strings.Cut(text, ":")
+	hash = strings.ToUpper(hash)
+	if !isSHA1(hash) {
+		return "", 0, false, errors.New("invalid SHA-1 hash")
+	}
+	count = 1
+	if hasCount {
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			return "", 0, false, errors.New("invalid count")
+		}
+	}
+	return hash, count, true, nil
+}
+
+func isSHA1(hash string) bool {
+	if len(hash) != hashLength {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
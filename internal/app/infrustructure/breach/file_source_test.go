@@ -0,0 +1,117 @@
+package breach_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/breach"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{
+		"# SHA-1 of breached passwords",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8",
+		"",
+		"cbfdac0000000000000000000000000000000000:3",
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A97:2254650",
+	}, "\n")), 0o600))
+
+	source, err := breach.NewFileSource(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	suffixes, err := source.Range(ctx, "cbfda")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"C6008F9CAB4083784CBD1874F76618D2A97": 2254650,
+		"C0000000000000000000000000000000000": 3,
+	}, suffixes)
+
+	suffixes, err = source.Range(ctx, "5BAA6")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 1}, suffixes, "Count should default to 1")
+
+	suffixes, err = source.Range(ctx, "00000")
+	require.NoError(t, err)
+	assert.Empty(t, suffixes)
+
+	_, err = source.Range(ctx, "CBFDAC")
+	assert.Error(t, err, "Only 5 character prefixes should be accepted")
+}
+
+func TestFileSource_Search(t *testing.T) {
+	t.Parallel()
+
+	expected := make(map[string]map[string]int)
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		hash := fmt.Sprintf("%X", sha1.Sum([]byte(strconv.Itoa(i))))
+		prefix, suffix := hash[:5], hash[5:]
+		if expected[prefix] == nil {
+			expected[prefix] = make(map[string]int)
+		}
+		expected[prefix][suffix] = i + 1
+		lines = append(lines, hash+":"+strconv.Itoa(i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o600))
+	source, err := breach.NewFileSource(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	first, last := lines[0][:5], lines[len(lines)-1][:5]
+	for _, prefix := range []string{first, last, lines[len(lines)/2][:5]} {
+		suffixes, err := source.Range(ctx, prefix)
+		require.NoError(t, err)
+		assert.Equal(t, expected[prefix], suffixes, prefix)
+	}
+	for prefix, suffixes := range expected {
+		result, err := source.Range(ctx, prefix)
+		require.NoError(t, err)
+		require.Equal(t, suffixes, result, prefix)
+	}
+
+	for _, prefix := range []string{"00000", "FFFFF"} {
+		if expected[prefix] == nil {
+			suffixes, err := source.Range(ctx, prefix)
+			require.NoError(t, err)
+			assert.Empty(t, suffixes, prefix)
+		}
+	}
+}
+
+func TestReadSource_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		"not a hash",
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A9",
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A97:many",
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A97:0",
+	} {
+		_, err := breach.ReadSource(strings.NewReader(content))
+		assert.Error(t, err, "%q should be rejected", content)
+	}
+
+	_, err := breach.NewFileSource(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte("password\n123456\n"), 0o600))
+	_, err = breach.NewFileSource(path)
+	assert.Error(t, err, "Files of other formats should be rejected")
+}
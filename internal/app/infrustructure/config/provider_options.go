@@ -1,7 +1,10 @@
 package config
 
+import "github.com/Mixturka/vm-hub/internal/app/domain/entities"
+
 type BaseOAuthProviderOptions struct {
 	Name         string
+	Method       entities.AuthMethod
 	AuthorizeURL string
 	AccessURL    string
 	ProfileURL   string
@@ -15,3 +18,11 @@ type OAuthProviderOptions struct {
 	CliendID     string
 	ClientSecret string
 }
+
+type OIDCProviderOptions struct {
+	Name         string
+	IssuerURL    string
+	Scopes       []string
+	ClientID     string
+	ClientSecret string
+}
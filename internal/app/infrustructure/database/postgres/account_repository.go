@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PostgresAccountRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresAccountRepository(db *pgxpool.Pool) interfaces.AccountRepository {
+	return &PostgresAccountRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresAccountRepository) GetByUserIDAndProvider(ctx context.Context, userID string, provider string) (*entities.Account, error) {
+	var account entities.Account
+
+	query := `SELECT id, user_id, type, provider, COALESCE(provider_account_id, ''), refresh_token,
+				access_token, expires_at, created_at, updated_at
+			  FROM accounts WHERE user_id = $1 AND provider = $2`
+
+	err := r.db.QueryRow(ctx, query, userID, provider).Scan(&account.ID, &account.UserID, &account.Type,
+		&account.Provider, &account.ProviderAccountID, &account.RefreshToken, &account.AccessToken,
+		&account.ExpiresAt, &account.CreatedAt, &account.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("%s account for user %s not found: %w", provider, userID, pgx.ErrNoRows)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching %s account for user %s: %w", provider, userID, err)
+	}
+
+	return &account, nil
+}
+
+func (r *PostgresAccountRepository) GetByProviderAccountID(ctx context.Context, provider string, providerAccountID string) (*entities.Account, error) {
+	var account entities.Account
+
+	query := `SELECT id, user_id, type, provider, provider_account_id, refresh_token,
+				access_token, expires_at, created_at, updated_at
+			  FROM accounts WHERE provider = $1 AND provider_account_id = $2`
+
+	err := r.db.QueryRow(ctx, query, provider, providerAccountID).Scan(&account.ID, &account.UserID, &account.Type,
+		&account.Provider, &account.ProviderAccountID, &account.RefreshToken, &account.AccessToken,
+		&account.ExpiresAt, &account.CreatedAt, &account.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("%s account %s not found: %w", provider, providerAccountID, pgx.ErrNoRows)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching %s account %s: %w", provider, providerAccountID, err)
+	}
+
+	return &account, nil
+}
+
+func (r *PostgresAccountRepository) Save(ctx context.Context, account *entities.Account) error {
+	query := `INSERT INTO accounts (id, user_id, type, provider, provider_account_id, refresh_token,
+				access_token, expires_at, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)`
+	_, err := r.db.Exec(ctx, query, account.ID, account.UserID, account.Type, account.Provider,
+		account.ProviderAccountID, account.RefreshToken, account.AccessToken, account.ExpiresAt,
+		account.CreatedAt, account.UpdatedAt)
+	return err
+}
+
+func (r *PostgresAccountRepository) Update(ctx context.Context, account *entities.Account) error {
+	query := `UPDATE accounts SET type = $2, provider = $3, provider_account_id = NULLIF($4, ''),
+				refresh_token = $5, access_token = $6, expires_at = $7, updated_at = $8
+			  WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, account.ID, account.Type, account.Provider, account.ProviderAccountID,
+		account.RefreshToken, account.AccessToken, account.ExpiresAt, account.UpdatedAt)
+	return err
+}
@@ -0,0 +1,60 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresAccountRepository_Save_Update_Get(t *testing.T) {
+	t.Run("Save, Update And Get Account Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		accountRepo := postgres.NewPostgresAccountRepository(ptUtil.DB())
+		user := *test.NewRandomUser()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := userRepo.Save(ctx, &user)
+		assert.NoError(t, err, "Save user shouldn't return an error")
+
+		account := entities.Account{
+			ID:           uuid.NewString(),
+			Type:         "oauth",
+			Provider:     "google",
+			UserID:       user.ID,
+			RefreshToken: "refresh",
+			AccessToken:  "access",
+			ExpiresAt:    int(time.Now().Unix()),
+			CreatedAt:    time.Now().UTC(),
+			UpdatedAt:    time.Now().UTC(),
+		}
+		err = accountRepo.Save(ctx, &account)
+		assert.NoError(t, err, "Save account shouldn't return an error")
+
+		account.AccessToken = "new-access"
+		err = accountRepo.Update(ctx, &account)
+		assert.NoError(t, err, "Update account shouldn't return an error")
+
+		fetched, err := accountRepo.GetByUserIDAndProvider(ctx, user.ID, "google")
+		assert.NoError(t, err, "GetByUserIDAndProvider shouldn't return an error")
+		assert.Equal(t, "new-access", fetched.AccessToken)
+		assert.Equal(t, account.ID, fetched.ID)
+
+		_, err = accountRepo.GetByUserIDAndProvider(ctx, user.ID, "yandex")
+		assert.Error(t, err, "Expected an error for missing account")
+	})
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PostgresCredentialRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresCredentialRepository(db *pgxpool.Pool) interfaces.CredentialRepository {
+	return &PostgresCredentialRepository{
+		db: db,
+	}
+}
+
+const credentialColumns = `id, user_id, credential_id, public_key, attestation_type, aaguid,
+			  sign_count, transports, backup_eligible, backup_state, created_at, last_used_at`
+
+func scanCredential(row pgx.Row, c *entities.Credential) error {
+	var signCount int64
+	if err := row.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.AttestationType, &c.AAGUID,
+		&signCount, &c.Transports, &c.BackupEligible, &c.BackupState, &c.CreatedAt, &c.LastUsedAt); err != nil {
+		return err
+	}
+	c.SignCount = uint32(signCount)
+	return nil
+}
+
+func (r *PostgresCredentialRepository) GetByUserID(ctx context.Context, userID string) ([]entities.Credential, error) {
+	query := `SELECT ` + credentialColumns + `
+			  FROM credentials WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching credentials for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	credentials := []entities.Credential{}
+	for rows.Next() {
+		var credential entities.Credential
+		if err := scanCredential(rows, &credential); err != nil {
+			return nil, fmt.Errorf("error scanning credential for user %s: %w", userID, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over credentials for user %s: %w", userID, err)
+	}
+
+	return credentials, nil
+}
+
+func (r *PostgresCredentialRepository) GetByCredentialID(ctx context.Context, credentialID []byte) (*entities.Credential, error) {
+	var credential entities.Credential
+
+	query := `SELECT ` + credentialColumns + `
+			  FROM credentials WHERE credential_id = $1`
+
+	err := scanCredential(r.db.QueryRow(ctx, query, credentialID), &credential)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("credential not found: %w", pgx.ErrNoRows)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching credential: %w", err)
+	}
+
+	return &credential, nil
+}
+
+func (r *PostgresCredentialRepository) Save(ctx context.Context, credential *entities.Credential) error {
+	query := `INSERT INTO credentials (` + credentialColumns + `)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := r.db.Exec(ctx, query, credential.ID, credential.UserID, credential.CredentialID,
+		credential.PublicKey, credential.AttestationType, credential.AAGUID, int64(credential.SignCount),
+		credential.Transports, credential.BackupEligible, credential.BackupState,
+		credential.CreatedAt, credential.LastUsedAt)
+	return err
+}
+
+func (r *PostgresCredentialRepository) UpdateUsage(ctx context.Context, credential *entities.Credential) error {
+	query := `UPDATE credentials SET sign_count = $2, backup_state = $3, last_used_at = $4
+			  WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, credential.ID, int64(credential.SignCount),
+		credential.BackupState, credential.LastUsedAt)
+	return err
+}
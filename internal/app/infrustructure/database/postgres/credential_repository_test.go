@@ -0,0 +1,105 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCredential(userID string) *entities.Credential {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return &entities.Credential{
+		ID:              uuid.NewString(),
+		UserID:          userID,
+		CredentialID:    []byte(uuid.NewString()),
+		PublicKey:       []byte("public-key"),
+		AttestationType: "none",
+		AAGUID:          make([]byte, 16),
+		SignCount:       1,
+		Transports:      []string{"internal", "hybrid"},
+		BackupEligible:  true,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+	}
+}
+
+func TestPostgresCredentialRepository_SaveAndGet(t *testing.T) {
+	t.Run("Save And Get Credential Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		credentialRepo := postgres.NewPostgresCredentialRepository(ptUtil.DB())
+		user := test.NewRandomUser()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		require.NoError(t, userRepo.Save(ctx, user), "Save user shouldn't return an error")
+
+		credential := newTestCredential(user.ID)
+		require.NoError(t, credentialRepo.Save(ctx, credential), "Save shouldn't return an error")
+
+		fetched, err := credentialRepo.GetByCredentialID(ctx, credential.CredentialID)
+		require.NoError(t, err, "GetByCredentialID shouldn't return an error")
+		assert.Equal(t, credential, fetched)
+
+		credentials, err := credentialRepo.GetByUserID(ctx, user.ID)
+		require.NoError(t, err, "GetByUserID shouldn't return an error")
+		require.Len(t, credentials, 1)
+		assert.Equal(t, *credential, credentials[0])
+
+		_, err = credentialRepo.GetByCredentialID(ctx, []byte("unknown"))
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		duplicate := newTestCredential(user.ID)
+		duplicate.CredentialID = credential.CredentialID
+		assert.Error(t, credentialRepo.Save(ctx, duplicate), "Credential IDs should be unique")
+	})
+}
+
+func TestPostgresCredentialRepository_UpdateUsage(t *testing.T) {
+	t.Run("Update Credential Usage Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		credentialRepo := postgres.NewPostgresCredentialRepository(ptUtil.DB())
+		user := test.NewRandomUser()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		require.NoError(t, userRepo.Save(ctx, user), "Save user shouldn't return an error")
+
+		credential := newTestCredential(user.ID)
+		require.NoError(t, credentialRepo.Save(ctx, credential), "Save shouldn't return an error")
+
+		credential.SignCount = 42
+		credential.BackupState = true
+		credential.LastUsedAt = credential.LastUsedAt.Add(time.Hour)
+		require.NoError(t, credentialRepo.UpdateUsage(ctx, credential), "UpdateUsage shouldn't return an error")
+
+		fetched, err := credentialRepo.GetByCredentialID(ctx, credential.CredentialID)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(42), fetched.SignCount)
+		assert.True(t, fetched.BackupState)
+		assert.Equal(t, credential.LastUsedAt, fetched.LastUsedAt)
+	})
+}
@@ -0,0 +1,3 @@
+-- 10_create_session_set_members_table.down.sql
+
+DROP TABLE IF EXISTS session_set_members;
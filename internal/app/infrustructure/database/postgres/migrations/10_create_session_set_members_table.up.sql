@@ -0,0 +1,13 @@
+-- 10_create_session_set_members_table.up.sql
+
+-- Members of session sets, e.g. IDs of all sessions of a user. A row per
+-- member lets concurrent requests add and remove members without losing
+-- each other's changes.
+CREATE TABLE session_set_members (
+    key TEXT NOT NULL,
+    member TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (key, member)
+);
+
+CREATE INDEX session_set_members_expires_at_idx ON session_set_members(expires_at);
@@ -0,0 +1,3 @@
+-- 11_add_users_session_epoch.down.sql
+
+ALTER TABLE users DROP COLUMN session_epoch;
@@ -0,0 +1,5 @@
+-- 11_add_users_session_epoch.up.sql
+
+-- Sessions carry the epoch they were started in. Bumping it revokes all
+-- user's sessions, including ones kept in client-side cookies.
+ALTER TABLE users ADD COLUMN session_epoch BIGINT NOT NULL DEFAULT 0;
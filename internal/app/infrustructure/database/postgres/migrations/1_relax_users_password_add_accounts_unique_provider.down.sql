@@ -0,0 +1,5 @@
+-- 1_relax_users_password_add_accounts_unique_provider.down.sql
+
+DROP INDEX IF EXISTS accounts_user_id_provider_idx;
+
+ALTER TABLE users ADD CONSTRAINT users_password_key UNIQUE (password);
@@ -0,0 +1,7 @@
+-- 1_relax_users_password_add_accounts_unique_provider.up.sql
+
+-- OAuth users have no password, so the column can't be unique.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_password_key;
+
+-- A user may be linked to each OAuth provider at most once.
+CREATE UNIQUE INDEX accounts_user_id_provider_idx ON accounts (user_id, provider);
@@ -0,0 +1,3 @@
+-- 2_fix_tokens_expires_in.down.sql
+
+ALTER TABLE tokens RENAME COLUMN expires_in TO epires_in;
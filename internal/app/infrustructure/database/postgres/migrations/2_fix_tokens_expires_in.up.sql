@@ -0,0 +1,3 @@
+-- 2_fix_tokens_expires_in.up.sql
+
+ALTER TABLE tokens RENAME COLUMN epires_in TO expires_in;
@@ -0,0 +1,4 @@
+-- 3_add_tokens_attempts.down.sql
+
+DROP INDEX IF EXISTS tokens_user_email_type_idx;
+ALTER TABLE tokens DROP COLUMN attempts;
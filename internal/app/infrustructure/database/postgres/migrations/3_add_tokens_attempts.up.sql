@@ -0,0 +1,4 @@
+-- 3_add_tokens_attempts.up.sql
+
+ALTER TABLE tokens ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX tokens_user_email_type_idx ON tokens(user_email, type);
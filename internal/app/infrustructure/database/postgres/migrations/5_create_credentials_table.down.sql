@@ -0,0 +1,3 @@
+-- 5_create_credentials_table.down.sql
+
+DROP TABLE IF EXISTS credentials;
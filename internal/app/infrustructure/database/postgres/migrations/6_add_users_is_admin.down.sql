@@ -0,0 +1,3 @@
+-- 6_add_users_is_admin.down.sql
+
+ALTER TABLE users DROP COLUMN is_admin;
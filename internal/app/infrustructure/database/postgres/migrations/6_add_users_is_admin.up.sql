@@ -0,0 +1,5 @@
+-- 6_add_users_is_admin.up.sql
+
+-- Admins may manage other users' sessions. There is no endpoint granting the
+-- role, it's assigned directly in the database.
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- 7_create_sessions_table.down.sql
+
+DROP TABLE IF EXISTS sessions;
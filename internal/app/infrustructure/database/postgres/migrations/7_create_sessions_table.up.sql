@@ -0,0 +1,9 @@
+-- 7_create_sessions_table.up.sql
+
+CREATE TABLE sessions (
+    key TEXT PRIMARY KEY,
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX sessions_expires_at_idx ON sessions(expires_at);
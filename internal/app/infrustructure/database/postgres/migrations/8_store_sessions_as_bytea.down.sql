@@ -0,0 +1,5 @@
+-- 8_store_sessions_as_bytea.down.sql
+
+-- Entries written with other codecs than JSON can't be kept.
+DELETE FROM sessions WHERE get_byte(data, 0) <> 123;
+ALTER TABLE sessions ALTER COLUMN data TYPE JSONB USING convert_from(data, 'UTF8')::JSONB;
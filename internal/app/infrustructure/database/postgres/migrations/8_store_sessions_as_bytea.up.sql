@@ -0,0 +1,5 @@
+-- 8_store_sessions_as_bytea.up.sql
+
+-- Sessions are serialized by the application with a codec of choice, which
+-- isn't necessarily JSON.
+ALTER TABLE sessions ALTER COLUMN data TYPE BYTEA USING convert_to(data::TEXT, 'UTF8');
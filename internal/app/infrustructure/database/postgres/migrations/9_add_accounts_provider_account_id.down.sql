@@ -0,0 +1,5 @@
+-- 9_add_accounts_provider_account_id.down.sql
+
+DROP INDEX IF EXISTS accounts_provider_provider_account_id_idx;
+
+ALTER TABLE accounts DROP COLUMN provider_account_id;
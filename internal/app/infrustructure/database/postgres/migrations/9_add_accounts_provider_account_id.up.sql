@@ -0,0 +1,8 @@
+-- 9_add_accounts_provider_account_id.up.sql
+
+-- OAuth accounts are found by the ID the provider assigned to the user, not by
+-- email, which providers may not have verified. Accounts linked before keep
+-- NULL until the user signs in with them again.
+ALTER TABLE accounts ADD COLUMN provider_account_id TEXT;
+
+CREATE UNIQUE INDEX accounts_provider_provider_account_id_idx ON accounts (provider, provider_account_id);
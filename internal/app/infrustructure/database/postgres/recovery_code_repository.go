@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PostgresRecoveryCodeRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresRecoveryCodeRepository(db *pgxpool.Pool) interfaces.RecoveryCodeRepository {
+	return &PostgresRecoveryCodeRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRecoveryCodeRepository) ReplaceForUser(ctx context.Context, userID string, codes []entities.RecoveryCode) error {
+	return r.db.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("error deleting recovery codes: %w", err)
+		}
+
+		query := `INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+				  VALUES ($1, $2, $3, $4)`
+		for _, code := range codes {
+			if _, err := tx.Exec(ctx, query, code.ID, userID, code.CodeHash, code.CreatedAt); err != nil {
+				return fmt.Errorf("error saving recovery code: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *PostgresRecoveryCodeRepository) Use(ctx context.Context, userID string, codeHash string) (bool, error) {
+	query := "DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2"
+	tag, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PostgresRecoveryCodeRepository) CountForUser(ctx context.Context, userID string) (int, error) {
+	var count int
+
+	query := "SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1"
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+
+	return count, nil
+}
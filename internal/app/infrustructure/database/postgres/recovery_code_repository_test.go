@@ -0,0 +1,73 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRecoveryCodeRepository_ReplaceForUser_Use(t *testing.T) {
+	t.Run("Replace And Use Recovery Codes Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		userRepo := postgres.NewPostgresUserRepository(ptUtil.DB())
+		codeRepo := postgres.NewPostgresRecoveryCodeRepository(ptUtil.DB())
+		user := test.NewRandomUser()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		require.NoError(t, userRepo.Save(ctx, user), "Save user shouldn't return an error")
+
+		newCodes := func(hashes ...string) []entities.RecoveryCode {
+			codes := make([]entities.RecoveryCode, 0, len(hashes))
+			for _, hash := range hashes {
+				codes = append(codes, entities.RecoveryCode{
+					ID:        uuid.NewString(),
+					UserID:    user.ID,
+					CodeHash:  hash,
+					CreatedAt: time.Now().UTC(),
+				})
+			}
+			return codes
+		}
+
+		err := codeRepo.ReplaceForUser(ctx, user.ID, newCodes("a", "b"))
+		require.NoError(t, err, "ReplaceForUser shouldn't return an error")
+
+		count, err := codeRepo.CountForUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		used, err := codeRepo.Use(ctx, user.ID, "a")
+		require.NoError(t, err, "Use shouldn't return an error")
+		assert.True(t, used)
+
+		used, err = codeRepo.Use(ctx, user.ID, "a")
+		require.NoError(t, err, "Use shouldn't return an error")
+		assert.False(t, used, "Code should be used only once")
+
+		err = codeRepo.ReplaceForUser(ctx, user.ID, newCodes("c", "d", "e"))
+		require.NoError(t, err, "ReplaceForUser shouldn't return an error")
+
+		used, err = codeRepo.Use(ctx, user.ID, "b")
+		require.NoError(t, err)
+		assert.False(t, used, "Replaced codes shouldn't be usable")
+
+		count, err = codeRepo.CountForUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+}
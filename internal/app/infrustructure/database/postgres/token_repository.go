@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PostgresTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresTokenRepository(db *pgxpool.Pool) interfaces.TokenRepository {
+	return &PostgresTokenRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresTokenRepository) GetByToken(ctx context.Context, token string, tokenType entities.TokenType) (*entities.Token, error) {
+	var t entities.Token
+
+	query := `SELECT id, user_email, token, type, expires_in, attempts
+			  FROM tokens WHERE token = $1 AND type = $2`
+
+	err := r.db.QueryRow(ctx, query, token, tokenType).Scan(&t.ID, &t.UserEmail, &t.Token, &t.Type, &t.ExpiresIn, &t.Attempts)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("token not found: %w", pgx.ErrNoRows)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching token: %w", err)
+	}
+
+	return &t, nil
+}
+
+// Returns the latest token of the type issued for email.
+func (r *PostgresTokenRepository) GetByEmailAndType(ctx context.Context, email string, tokenType entities.TokenType) (*entities.Token, error) {
+	var t entities.Token
+
+	query := `SELECT id, user_email, token, type, expires_in, attempts
+			  FROM tokens WHERE user_email = $1 AND type = $2
+			  ORDER BY expires_in DESC LIMIT 1`
+
+	err := r.db.QueryRow(ctx, query, email, tokenType).Scan(&t.ID, &t.UserEmail, &t.Token, &t.Type, &t.ExpiresIn, &t.Attempts)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("token not found: %w", pgx.ErrNoRows)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching token: %w", err)
+	}
+
+	return &t, nil
+}
+
+func (r *PostgresTokenRepository) Save(ctx context.Context, token *entities.Token) error {
+	query := `INSERT INTO tokens (id, user_email, token, type, expires_in, attempts)
+			  VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.Exec(ctx, query, token.ID, token.UserEmail, token.Token, token.Type, token.ExpiresIn, token.Attempts)
+	return err
+}
+
+// Increments number of failed attempts to use the token and returns the new value.
+func (r *PostgresTokenRepository) IncrementAttempts(ctx context.Context, id string) (int, error) {
+	var attempts int
+
+	query := "UPDATE tokens SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts"
+	err := r.db.QueryRow(ctx, query, id).Scan(&attempts)
+	if err == pgx.ErrNoRows {
+		return 0, fmt.Errorf("token not found: %w", pgx.ErrNoRows)
+	} else if err != nil {
+		return 0, fmt.Errorf("error incrementing token attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (r *PostgresTokenRepository) Delete(ctx context.Context, id string) error {
+	query := "DELETE FROM tokens WHERE id = $1"
+	_, err := r.db.Exec(ctx, query, id)
+	return err
+}
+
+func (r *PostgresTokenRepository) DeleteByEmailAndType(ctx context.Context, email string, tokenType entities.TokenType) error {
+	query := "DELETE FROM tokens WHERE user_email = $1 AND type = $2"
+	_, err := r.db.Exec(ctx, query, email, tokenType)
+	return err
+}
+
+func (r *PostgresTokenRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := "DELETE FROM tokens WHERE expires_in < $1"
+	tag, err := r.db.Exec(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
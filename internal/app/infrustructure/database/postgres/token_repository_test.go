@@ -0,0 +1,179 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/database/postgres"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestToken(email string, tokenType entities.TokenType, expiresIn time.Time) *entities.Token {
+	return &entities.Token{
+		ID:        uuid.NewString(),
+		UserEmail: email,
+		Token:     uuid.NewString(),
+		Type:      tokenType,
+		ExpiresIn: expiresIn.UTC().Truncate(time.Microsecond),
+	}
+}
+
+func TestPostgresTokenRepository_Save_GetByToken_Delete(t *testing.T) {
+	t.Run("Save, Get And Delete Token Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresTokenRepository(ptUtil.DB())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token := newTestToken(test.NewRandomUser().Email, entities.Verification, time.Now().Add(time.Hour))
+		err := repo.Save(ctx, token)
+		require.NoError(t, err, "Save token shouldn't return an error")
+
+		fetched, err := repo.GetByToken(ctx, token.Token, entities.Verification)
+		require.NoError(t, err, "GetByToken shouldn't return an error")
+		assert.Equal(t, token.ID, fetched.ID)
+		assert.Equal(t, token.UserEmail, fetched.UserEmail)
+		assert.Equal(t, token.Type, fetched.Type)
+		assert.True(t, token.ExpiresIn.Equal(fetched.ExpiresIn), "Expiry should be stored as is")
+
+		_, err = repo.GetByToken(ctx, token.Token, entities.PasswordReset)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "Token of other type shouldn't be found")
+
+		err = repo.Delete(ctx, token.ID)
+		require.NoError(t, err, "Delete token shouldn't return an error")
+
+		_, err = repo.GetByToken(ctx, token.Token, entities.Verification)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "Deleted token shouldn't be found")
+	})
+}
+
+func TestPostgresTokenRepository_DeleteByEmailAndType(t *testing.T) {
+	t.Run("Delete Tokens By Email And Type Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresTokenRepository(ptUtil.DB())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		email := test.NewRandomUser().Email
+		expiresIn := time.Now().Add(time.Hour)
+		resetTokens := []*entities.Token{
+			newTestToken(email, entities.PasswordReset, expiresIn),
+			newTestToken(email, entities.PasswordReset, expiresIn),
+		}
+		verificationToken := newTestToken(email, entities.Verification, expiresIn)
+		otherUserToken := newTestToken(test.NewRandomUser().Email, entities.PasswordReset, expiresIn)
+
+		for _, token := range append(resetTokens, verificationToken, otherUserToken) {
+			require.NoError(t, repo.Save(ctx, token), "Save token shouldn't return an error")
+		}
+
+		err := repo.DeleteByEmailAndType(ctx, email, entities.PasswordReset)
+		require.NoError(t, err, "DeleteByEmailAndType shouldn't return an error")
+
+		for _, token := range resetTokens {
+			_, err = repo.GetByToken(ctx, token.Token, entities.PasswordReset)
+			assert.ErrorIs(t, err, pgx.ErrNoRows, "Tokens of the type should be deleted")
+		}
+
+		_, err = repo.GetByToken(ctx, verificationToken.Token, entities.Verification)
+		assert.NoError(t, err, "Tokens of other types should be kept")
+
+		_, err = repo.GetByToken(ctx, otherUserToken.Token, entities.PasswordReset)
+		assert.NoError(t, err, "Tokens of other users should be kept")
+	})
+}
+
+func TestPostgresTokenRepository_PurgeExpired(t *testing.T) {
+	t.Run("Purge Expired Tokens Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresTokenRepository(ptUtil.DB())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		email := test.NewRandomUser().Email
+		expired := newTestToken(email, entities.TwoFactor, time.Now().Add(-time.Minute))
+		valid := newTestToken(email, entities.Verification, time.Now().Add(time.Hour))
+		require.NoError(t, repo.Save(ctx, expired), "Save token shouldn't return an error")
+		require.NoError(t, repo.Save(ctx, valid), "Save token shouldn't return an error")
+
+		purged, err := repo.PurgeExpired(ctx, time.Now().UTC())
+		require.NoError(t, err, "PurgeExpired shouldn't return an error")
+		assert.Equal(t, int64(1), purged)
+
+		_, err = repo.GetByToken(ctx, expired.Token, entities.TwoFactor)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "Expired token should be purged")
+
+		_, err = repo.GetByToken(ctx, valid.Token, entities.Verification)
+		assert.NoError(t, err, "Valid token should be kept")
+	})
+}
+
+func TestPostgresTokenRepository_GetByEmailAndType_IncrementAttempts(t *testing.T) {
+	t.Run("Get Token By Email And Count Attempts Test", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping test in short mode...")
+		}
+		t.Parallel()
+
+		ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+		test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+		repo := postgres.NewPostgresTokenRepository(ptUtil.DB())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		email := test.NewRandomUser().Email
+		older := newTestToken(email, entities.TwoFactor, time.Now().Add(time.Minute))
+		latest := newTestToken(email, entities.TwoFactor, time.Now().Add(5*time.Minute))
+		require.NoError(t, repo.Save(ctx, older), "Save token shouldn't return an error")
+		require.NoError(t, repo.Save(ctx, latest), "Save token shouldn't return an error")
+
+		fetched, err := repo.GetByEmailAndType(ctx, email, entities.TwoFactor)
+		require.NoError(t, err, "GetByEmailAndType shouldn't return an error")
+		assert.Equal(t, latest.ID, fetched.ID, "Latest token should be returned")
+		assert.Equal(t, 0, fetched.Attempts)
+
+		_, err = repo.GetByEmailAndType(ctx, email, entities.PasswordReset)
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "Token of other type shouldn't be found")
+
+		for i := 1; i <= 2; i++ {
+			attempts, err := repo.IncrementAttempts(ctx, latest.ID)
+			require.NoError(t, err, "IncrementAttempts shouldn't return an error")
+			assert.Equal(t, i, attempts)
+		}
+
+		fetched, err = repo.GetByToken(ctx, latest.Token, entities.TwoFactor)
+		require.NoError(t, err, "GetByToken shouldn't return an error")
+		assert.Equal(t, 2, fetched.Attempts)
+
+		_, err = repo.IncrementAttempts(ctx, uuid.NewString())
+		assert.ErrorIs(t, err, pgx.ErrNoRows, "Missing token should be reported")
+	})
+}
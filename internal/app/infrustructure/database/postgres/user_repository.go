@@ -25,20 +25,22 @@ func (r *PostgresUserRepository) GetByID(ctx context.Context, id string) (*entit
 	var user entities.User
 
 	userQuery := `SELECT id, profile_picture, name, email, password,
-			      	is_email_verified, is_two_factor_enabled, method, created_at, updated_at
+			      	is_email_verified, is_two_factor_enabled, method, totp_secret,
+			      	is_totp_enabled, totp_last_step, is_admin, session_epoch, created_at, updated_at
 			  	  FROM users WHERE id = $1`
 
 	err := r.db.QueryRow(ctx, userQuery, id).Scan(&user.ID, &user.ProfilePicture, &user.Name,
 		&user.Email, &user.Password, &user.IsEmailVerified,
-		&user.IsTwoFactorEnabled, &user.Method, &user.CreatedAt,
-		&user.UpdatedAt)
+		&user.IsTwoFactorEnabled, &user.Method, &user.TotpSecret,
+		&user.IsTotpEnabled, &user.TotpLastStep, &user.IsAdmin, &user.SessionEpoch,
+		&user.CreatedAt, &user.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("user with ID %s not found: %w", id, pgx.ErrNoRows)
 	} else if err != nil {
 		return nil, fmt.Errorf("error fetching user by ID: %w", err)
 	}
 
-	accountsQuery := `SELECT id, user_id, type, provider, refresh_token, access_token, expires_at, created_at, updated_at
+	accountsQuery := `SELECT id, user_id, type, provider, COALESCE(provider_account_id, ''), refresh_token, access_token, expires_at, created_at, updated_at
 					  FROM accounts WHERE user_id = $1`
 
 	rows, err := r.db.Query(ctx, accountsQuery, id)
@@ -52,7 +54,7 @@ func (r *PostgresUserRepository) GetByID(ctx context.Context, id string) (*entit
 		var account entities.Account
 
 		if err := rows.Scan(&account.ID, &account.UserID, &account.Type, &account.Provider,
-			&account.RefreshToken, &account.AccessToken, &account.ExpiresAt,
+			&account.ProviderAccountID, &account.RefreshToken, &account.AccessToken, &account.ExpiresAt,
 			&account.CreatedAt, &account.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("error scanning account for user %s: %w", id, err)
 		}
@@ -71,13 +73,15 @@ func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (
 	var user entities.User
 
 	userQuery := `SELECT id, profile_picture, name, email, password,
-			      	is_email_verified, is_two_factor_enabled, method, created_at, updated_at
+			      	is_email_verified, is_two_factor_enabled, method, totp_secret,
+			      	is_totp_enabled, totp_last_step, is_admin, session_epoch, created_at, updated_at
 			  	  FROM users WHERE email = $1`
 
 	err := r.db.QueryRow(ctx, userQuery, email).Scan(&user.ID, &user.ProfilePicture, &user.Name,
 		&user.Email, &user.Password, &user.IsEmailVerified,
-		&user.IsTwoFactorEnabled, &user.Method, &user.CreatedAt,
-		&user.UpdatedAt)
+		&user.IsTwoFactorEnabled, &user.Method, &user.TotpSecret,
+		&user.IsTotpEnabled, &user.TotpLastStep, &user.IsAdmin, &user.SessionEpoch,
+		&user.CreatedAt, &user.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("user with email %s not found: %w", email, pgx.ErrNoRows)
 	} else if err != nil {
@@ -85,7 +89,7 @@ func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (
 
 	}
 
-	accountsQuery := `SELECT id, user_id, type, provider, refresh_token, access_token, expires_at, created_at, updated_at
+	accountsQuery := `SELECT id, user_id, type, provider, COALESCE(provider_account_id, ''), refresh_token, access_token, expires_at, created_at, updated_at
 					  FROM accounts WHERE user_id = $1`
 
 	rows, err := r.db.Query(ctx, accountsQuery, user.ID)
@@ -99,7 +103,7 @@ func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (
 		var account entities.Account
 
 		if err := rows.Scan(&account.ID, &account.UserID, &account.Type, &account.Provider,
-			&account.RefreshToken, &account.AccessToken, &account.ExpiresAt,
+			&account.ProviderAccountID, &account.RefreshToken, &account.AccessToken, &account.ExpiresAt,
 			&account.CreatedAt, &account.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("error scanning account for user with email %s: %w", email, err)
 		}
@@ -116,20 +120,22 @@ func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (
 
 func (r *PostgresUserRepository) Save(ctx context.Context, user *entities.User) error {
 	query := `INSERT INTO users (id, profile_picture, name, email, password,
-			    is_email_verified, is_two_factor_enabled, method, created_at, updated_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+			    is_email_verified, is_two_factor_enabled, method, totp_secret,
+			    is_totp_enabled, totp_last_step, is_admin, session_epoch, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
 	_, err := r.db.Exec(ctx, query, user.ID, user.ProfilePicture, user.Name, user.Email,
 		user.Password, user.IsEmailVerified, user.IsTwoFactorEnabled, user.Method,
+		user.TotpSecret, user.IsTotpEnabled, user.TotpLastStep, user.IsAdmin, user.SessionEpoch,
 		user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
 	for _, account := range user.Accounts {
-		accountQuery := `INSERT INTO accounts (id, user_id, type, provider, refresh_token, access_token, expires_at, created_at, updated_at)
-						 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+		accountQuery := `INSERT INTO accounts (id, user_id, type, provider, provider_account_id, refresh_token, access_token, expires_at, created_at, updated_at)
+						 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)`
 		_, err := r.db.Exec(ctx, accountQuery, account.ID, user.ID, account.Type, account.Provider,
-			account.RefreshToken, account.AccessToken, account.ExpiresAt,
+			account.ProviderAccountID, account.RefreshToken, account.AccessToken, account.ExpiresAt,
 			account.CreatedAt, account.UpdatedAt)
 		if err != nil {
 			return err
@@ -139,17 +145,39 @@ func (r *PostgresUserRepository) Save(ctx context.Context, user *entities.User)
 	return nil
 }
 
+// TOTP step and session epoch are left out, they only move forward through
+// AdvanceTotpStep and BumpSessionEpoch, so a stale copy of the user can't
+// move them back.
 func (r *PostgresUserRepository) Update(ctx context.Context, user *entities.User) error {
 	query := `UPDATE users SET profile_picture = $2, name = $3, email = $4,
 			 	password = $5, is_email_verified = $6, is_two_factor_enabled = $7,
-				method = $8, created_at = $9, updated_at = $10
+				method = $8, totp_secret = $9, is_totp_enabled = $10,
+				is_admin = $11, created_at = $12, updated_at = $13
 			  WHERE id = $1`
 	_, err := r.db.Exec(ctx, query, user.ID, user.ProfilePicture, user.Name, user.Email,
 		user.Password, user.IsEmailVerified, user.IsTwoFactorEnabled, user.Method,
-		user.CreatedAt, user.UpdatedAt)
+		user.TotpSecret, user.IsTotpEnabled, user.IsAdmin, user.CreatedAt, user.UpdatedAt)
 	return err
 }
 
+func (r *PostgresUserRepository) AdvanceTotpStep(ctx context.Context, id string, step int64) (bool, error) {
+	query := "UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2"
+	tag, err := r.db.Exec(ctx, query, id, step)
+	if err != nil {
+		return false, fmt.Errorf("error updating totp step: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PostgresUserRepository) BumpSessionEpoch(ctx context.Context, id string) (int64, error) {
+	query := "UPDATE users SET session_epoch = session_epoch + 1 WHERE id = $1 RETURNING session_epoch"
+	var epoch int64
+	if err := r.db.QueryRow(ctx, query, id).Scan(&epoch); err != nil {
+		return 0, fmt.Errorf("error updating session epoch: %w", err)
+	}
+	return epoch, nil
+}
+
 func (r *PostgresUserRepository) Delete(ctx context.Context, id string) error {
 	accountsQuery := "DELETE FROM accounts WHERE user_id = $1"
 	_, err := r.db.Exec(ctx, accountsQuery, id)
@@ -11,6 +11,7 @@ import (
 	"github.com/Mixturka/vm-hub/internal/pkg/test"
 	"github.com/Mixturka/vm-hub/pkg/putils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -114,6 +115,70 @@ func TestPostgresUserRepository_Save_Update(t *testing.T) {
 	})
 }
 
+func TestPostgresUserRepository_UpdateKeepsTotpStep(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	user := *test.NewRandomUser()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, repo.Save(ctx, &user))
+	stale := user
+
+	advanced, err := repo.AdvanceTotpStep(ctx, user.ID, 10)
+	require.NoError(t, err)
+	require.True(t, advanced)
+
+	stale.Name = "Andrew"
+	require.NoError(t, repo.Update(ctx, &stale))
+
+	fetchedUser, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), fetchedUser.TotpLastStep, "Stale copy shouldn't move step back")
+
+	advanced, err = repo.AdvanceTotpStep(ctx, user.ID, 10)
+	require.NoError(t, err)
+	assert.False(t, advanced, "Used step should be refused as replay")
+
+	advanced, err = repo.AdvanceTotpStep(ctx, user.ID, 11)
+	require.NoError(t, err)
+	assert.True(t, advanced)
+}
+
+func TestPostgresUserRepository_BumpSessionEpoch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	test.ApplyMigrations(ptUtil.DB().Config().ConnString(), absoluteMigrationsPath)
+	repo := postgres.NewPostgresUserRepository(ptUtil.DB())
+	user := *test.NewRandomUser()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, repo.Save(ctx, &user))
+	stale := user
+
+	epoch, err := repo.BumpSessionEpoch(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), epoch)
+
+	require.NoError(t, repo.Update(ctx, &stale))
+	fetchedUser, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), fetchedUser.SessionEpoch, "Stale copy shouldn't move epoch back")
+}
+
 func TestPostgresUserRepository_Save_Delete(t *testing.T) {
 	t.Run("Save And Delete User Test", func(t *testing.T) {
 		if testing.Short() {
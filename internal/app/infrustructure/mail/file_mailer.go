@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+)
+
+// FileMailer writes every mail to its own .eml file in a directory, so it can
+// be opened with any mail client. Intended for local development.
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(from string, dir string) interfaces.Mailer {
+	return &FileMailer{
+		from: from,
+		dir:  dir,
+	}
+}
+
+func (fm *FileMailer) Send(ctx context.Context, m *dtos.MailDto) error {
+	message, err := buildMessage(fm.from, m)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(fm.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	// Names sort in order mails were sent.
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	path := filepath.Join(fm.dir, name)
+
+	// Mails contain tokens, so they are readable by owner only.
+	if err := os.WriteFile(path, message, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Mail written", "to", m.To, "subject", m.Subject, "path", path)
+	return nil
+}
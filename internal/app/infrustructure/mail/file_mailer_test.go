@@ -0,0 +1,69 @@
+package mail_test
+
+import (
+	"context"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	vmmail "github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := vmmail.NewFileMailer("no-reply@example.com", dir)
+
+	require.NoError(t, mailer.Send(context.Background(), testMail))
+	require.NoError(t, mailer.Send(context.Background(), testMail))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	file, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer file.Close()
+
+	message, err := mail.ReadMessage(file)
+	require.NoError(t, err)
+	assert.Equal(t, "no-reply@example.com", message.Header.Get("From"))
+	assert.Equal(t, "user@example.com", message.Header.Get("To"))
+	assert.Equal(t, "Confirm your email", message.Header.Get("Subject"))
+	assert.NotEmpty(t, message.Header.Get("Message-Id"))
+}
+
+func TestMemoryMailer_Send(t *testing.T) {
+	t.Parallel()
+
+	mailer := vmmail.NewMemoryMailer("no-reply@example.com")
+
+	require.NoError(t, mailer.Send(context.Background(), testMail))
+	require.NoError(t, mailer.Send(context.Background(), &dtos.MailDto{
+		To:       []string{"other@example.com"},
+		Subject:  "Your login code",
+		TextBody: "123456",
+	}))
+	assert.Error(t, mailer.Send(context.Background(), &dtos.MailDto{Subject: "No recipients"}))
+
+	assert.Len(t, mailer.Sent(), 2)
+
+	last, ok := mailer.LastTo("user@example.com")
+	require.True(t, ok)
+	assert.Equal(t, "Confirm your email", last.Subject)
+
+	_, ok = mailer.LastTo("nobody@example.com")
+	assert.False(t, ok)
+
+	mailer.Reset()
+	assert.Empty(t, mailer.Sent())
+}
@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+)
+
+// LogMailer doesn't deliver mail, it only logs that mail was sent. Body isn't
+// logged, as it carries tokens and codes, and logs are usually kept and read
+// by more people than mailboxes. Use "file" driver to read mail locally.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) interfaces.Mailer {
+	return &LogMailer{
+		from: from,
+	}
+}
+
+func (lm *LogMailer) Send(ctx context.Context, mail *dtos.MailDto) error {
+	slog.InfoContext(ctx, "Mail sent", "from", lm.from, "to", strings.Join(mail.To, ", "),
+		"subject", mail.Subject)
+	return nil
+}
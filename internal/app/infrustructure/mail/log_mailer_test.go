@@ -0,0 +1,26 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	vmmail "github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Not parallel, as it swaps the default logger.
+func TestLogMailer_Send(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	require.NoError(t, vmmail.NewLogMailer("no-reply@example.com").Send(context.Background(), testMail))
+
+	assert.Contains(t, logs.String(), "user@example.com")
+	assert.Contains(t, logs.String(), testMail.Subject)
+	assert.NotContains(t, logs.String(), "follow the link", "Body carries secrets and shouldn't be logged")
+}
@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+)
+
+// MemoryMailer keeps sent mail in memory, so tests can inspect it.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	from string
+	sent []dtos.MailDto
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{
+		from: from,
+	}
+}
+
+// Validates the mail the same way other mailers do and records it.
+func (mm *MemoryMailer) Send(ctx context.Context, m *dtos.MailDto) error {
+	if _, err := buildMessage(mm.from, m); err != nil {
+		return err
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	sent := *m
+	sent.To = append([]string{}, m.To...)
+	mm.sent = append(mm.sent, sent)
+	return nil
+}
+
+// Returns copies of mails sent so far, oldest first.
+func (mm *MemoryMailer) Sent() []dtos.MailDto {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	return append([]dtos.MailDto{}, mm.sent...)
+}
+
+// Returns the most recent mail sent to address.
+func (mm *MemoryMailer) LastTo(address string) (dtos.MailDto, bool) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	for i := len(mm.sent) - 1; i >= 0; i-- {
+		for _, to := range mm.sent[i].To {
+			if to == address {
+				return mm.sent[i], true
+			}
+		}
+	}
+	return dtos.MailDto{}, false
+}
+
+func (mm *MemoryMailer) Reset() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.sent = nil
+}
@@ -0,0 +1,121 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+)
+
+// Used when context passed to Send has no deadline.
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPMailer delivers mail through SMTP server. Connection is upgraded with
+// STARTTLS whenever server supports it, credentials are sent only over TLS.
+type SMTPMailer struct {
+	from    string
+	options config.SMTPOptions
+}
+
+func NewSMTPMailer(from string, options config.SMTPOptions) interfaces.Mailer {
+	return &SMTPMailer{
+		from:    from,
+		options: options,
+	}
+}
+
+func (sm *SMTPMailer) Send(ctx context.Context, m *dtos.MailDto) error {
+	message, err := buildMessage(sm.from, m)
+	if err != nil {
+		return err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultSMTPTimeout)
+	}
+
+	address := net.JoinHostPort(sm.options.Host, strconv.Itoa(sm.options.Port))
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, sm.options.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if err := sm.deliver(client, m.To, message); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (sm *SMTPMailer) deliver(client *smtp.Client, to []string, message []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{
+			ServerName: sm.options.Host,
+			MinVersion: tls.VersionTLS12,
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	} else if sm.options.RequireTLS {
+		return errors.New("smtp server doesn't support STARTTLS")
+	}
+
+	if sm.options.Username != "" {
+		if _, isTLS := client.TLSConnectionState(); !isTLS {
+			return errors.New("refusing to authenticate over unencrypted connection")
+		}
+		auth := smtp.PlainAuth("", sm.options.Username, sm.options.Password, sm.options.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	sender, err := mail.ParseAddress(sm.from)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	for _, address := range to {
+		recipient, err := mail.ParseAddress(address)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,98 @@
+package mail_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/mail"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMail = &dtos.MailDto{
+	To:       []string{"user@example.com"},
+	Subject:  "Confirm your email",
+	TextBody: "Hi,\nfollow the link",
+	HTMLBody: "<p>Hi,</p><p>follow the link</p>",
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	t.Parallel()
+
+	server := test.NewFakeSMTPServer(t)
+	mailer := mail.NewSMTPMailer("vm-hub <no-reply@example.com>", config.SMTPOptions{
+		Host: server.Host(),
+		Port: server.Port(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, mailer.Send(ctx, testMail))
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "no-reply@example.com", messages[0].From)
+	assert.Equal(t, []string{"user@example.com"}, messages[0].To)
+	assert.Contains(t, messages[0].Data, "Subject: Confirm your email\r\n")
+	assert.Contains(t, messages[0].Data, "Content-Type: multipart/alternative;")
+	assert.Contains(t, messages[0].Data, "Content-Type: text/plain; charset=utf-8")
+	assert.Contains(t, messages[0].Data, "Content-Type: text/html; charset=utf-8")
+	assert.Contains(t, messages[0].Data, "Hi,\r\nfollow the link")
+	assert.True(t, strings.Index(messages[0].Data, "text/plain") < strings.Index(messages[0].Data, "text/html"),
+		"HTML alternative should go last")
+}
+
+func TestSMTPMailer_Send_RequireTLS(t *testing.T) {
+	t.Parallel()
+
+	server := test.NewFakeSMTPServer(t)
+	mailer := mail.NewSMTPMailer("no-reply@example.com", config.SMTPOptions{
+		Host:       server.Host(),
+		Port:       server.Port(),
+		RequireTLS: true,
+	})
+
+	err := mailer.Send(context.Background(), testMail)
+	assert.ErrorContains(t, err, "STARTTLS")
+	assert.Empty(t, server.Messages())
+}
+
+func TestSMTPMailer_Send_NoAuthWithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	server := test.NewFakeSMTPServer(t)
+	mailer := mail.NewSMTPMailer("no-reply@example.com", config.SMTPOptions{
+		Host:     server.Host(),
+		Port:     server.Port(),
+		Username: "user",
+		Password: "secret",
+	})
+
+	err := mailer.Send(context.Background(), testMail)
+	assert.ErrorContains(t, err, "unencrypted")
+	assert.Empty(t, server.Messages())
+}
+
+func TestSMTPMailer_Send_HeaderInjection(t *testing.T) {
+	t.Parallel()
+
+	server := test.NewFakeSMTPServer(t)
+	mailer := mail.NewSMTPMailer("no-reply@example.com", config.SMTPOptions{
+		Host: server.Host(),
+		Port: server.Port(),
+	})
+
+	err := mailer.Send(context.Background(), &dtos.MailDto{
+		To:       []string{"user@example.com\r\nBcc: victim@example.com"},
+		Subject:  "Hello",
+		TextBody: "Hello",
+	})
+	assert.Error(t, err)
+	assert.Empty(t, server.Messages())
+}
@@ -6,36 +6,54 @@ import (
 	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/application/services"
+	"github.com/Mixturka/vm-hub/internal/app/domain/entities"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+)
 
 func AuthMiddleware(userService *services.UserService, sessionManager *session.SessionManager, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		values, err := sessionManager.GetSession(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		sess, err := sessionManager.GetSession(w, r)
+		if err != nil || sess == nil || sess.UserID == "" {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
 			return
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		userID, ok := values["userID"]
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		user, err := userService.FindByID(ctx, sess.UserID)
+		if err != nil {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
 			return
 		}
-
-		user, err := userService.FindByID(ctx, userID.(string))
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// Session was revoked, e.g. by password change, while kept somewhere
+		// it couldn't be deleted from.
+		if !services.IsSessionCurrent(sess, user) {
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Unauthorized")
 			return
 		}
 
 		ctx = context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, sessionContextKey, sess)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Returns the user stored in the request context by AuthMiddleware.
+func UserFromContext(ctx context.Context) (*entities.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*entities.User)
+	return user, ok && user != nil
+}
+
+// Returns the session stored in the request context by AuthMiddleware.
+func SessionFromContext(ctx context.Context) (*session.Session, bool) {
+	sess, ok := ctx.Value(sessionContextKey).(*session.Session)
+	return sess, ok && sess != nil
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+)
+
+const (
+	// Header htmx and API clients send token in.
+	CSRFHeaderName = "X-CSRF-Token"
+	// Form field HTML forms send token in.
+	CSRFFieldName = "csrf_token"
+
+	csrfContextKey contextKey = "csrf"
+	// Key of session values holding synchronizer token.
+	csrfSessionKey = "csrfToken"
+)
+
+// Protects cookie-authenticated requests from cross-site forgery. Every
+// session gets a synchronizer token, which has to be sent back in
+// X-CSRF-Token header or csrf_token form field with every request of unsafe
+// method. Token is put into request context for templates, see
+// CSRFTokenFromContext.
+//
+// With double-submit enabled, clients without session get token in a signed
+// cookie instead and have to echo its value the same way. The cookie isn't
+// bound to any session, so it's never accepted once session exists.
+func CSRFMiddleware(sessionManager *session.SessionManager, options *config.SessionOptions, next http.Handler) http.Handler {
+	if !options.CSRF.Enabled {
+		return next
+	}
+	cookies := session.NewCookieCodec(append([]string{options.SessionSecret}, options.PreviousSessionSecrets...), nil)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if options.CSRF.ExemptBearer && isBearerRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sess, err := sessionManager.GetSession(w, r)
+		if err != nil {
+			respond.InternalError(w, r, "Failed to load session", err)
+			return
+		}
+
+		// Every token the request may be checked against, the first one is
+		// handed out to templates.
+		var accepted []string
+		if sess != nil && sess.Values[csrfSessionKey] != "" {
+			accepted = append(accepted, sess.Values[csrfSessionKey])
+		}
+		if sess == nil && options.CSRF.DoubleSubmit {
+			if token := csrfCookieToken(r, cookies, options); token != "" {
+				accepted = append(accepted, token)
+			}
+		}
+
+		if !isSafeMethod(r.Method) {
+			// Without session and double-submit cookie, request has no
+			// credentials that could be abused.
+			if sess == nil && !options.CSRF.DoubleSubmit {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !matchesCSRFToken(submittedCSRFToken(r), accepted) {
+				respond.Error(w, r, http.StatusForbidden, respond.CodeForbidden, "Invalid CSRF token")
+				return
+			}
+		}
+
+		token := ""
+		if len(accepted) > 0 {
+			token = accepted[0]
+		}
+		if sess != nil && sess.Values[csrfSessionKey] == "" {
+			if token, err = issueSessionCSRFToken(w, r, sessionManager, sess); err != nil {
+				slog.Warn("Failed to issue CSRF token", "error", err)
+			}
+		} else if token == "" && options.CSRF.DoubleSubmit {
+			if token, err = issueCSRFCookie(w, cookies, options); err != nil {
+				slog.Warn("Failed to issue CSRF cookie", "error", err)
+			}
+		}
+
+		// API clients don't render pages, so they pick the token up from any
+		// safe request, e.g. GET /csrf right after login.
+		if token != "" && isSafeMethod(r.Method) {
+			w.Header().Set(CSRFHeaderName, token)
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Returns the token CSRFMiddleware expects back from the client as JSON, for
+// clients that don't render pages. Token of a session is issued on its first
+// request, so it's available right after login.
+func CSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, map[string]string{"csrf_token": CSRFTokenFromContext(r.Context())})
+}
+
+// Returns the token CSRFMiddleware expects back from the client, to be
+// rendered into forms and hx-headers. Empty if protection is disabled.
+func CSRFTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(csrfContextKey).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBearerRequest(r *http.Request) bool {
+	scheme, _, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	return ok && strings.EqualFold(scheme, "Bearer")
+}
+
+// Form field is only read from form bodies, JSON bodies are left untouched.
+func submittedCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeaderName); token != "" {
+		return token
+	}
+	return r.PostFormValue(CSRFFieldName)
+}
+
+func matchesCSRFToken(submitted string, accepted []string) bool {
+	if submitted == "" {
+		return false
+	}
+	for _, token := range accepted {
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func issueSessionCSRFToken(w http.ResponseWriter, r *http.Request, sessionManager *session.SessionManager,
+	sess *session.Session) (string, error) {
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	if sess.Values == nil {
+		sess.Values = make(map[string]string)
+	}
+	sess.Values[csrfSessionKey] = token
+	if err := sessionManager.UpdateSession(w, r, sess); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Token of double-submit cookie is the cookie value itself, as clients see it.
+// Cookie has to be signed by us, so it can't be planted e.g. from a subdomain.
+func csrfCookieToken(r *http.Request, cookies *session.CookieCodec, options *config.SessionOptions) string {
+	cookie, err := r.Cookie(options.CSRF.CookieName)
+	if err != nil {
+		return ""
+	}
+	if _, err := cookies.Decode(options.CSRF.CookieName, cookie.Value); err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Cookie is readable by scripts, API clients have to copy it into the header.
+func issueCSRFCookie(w http.ResponseWriter, cookies *session.CookieCodec, options *config.SessionOptions) (string, error) {
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	value, err := cookies.Encode(options.CSRF.CookieName, token)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     options.CSRF.CookieName,
+		Value:    value,
+		Path:     "/",
+		Secure:   options.SessionSecure,
+		Domain:   options.SessionDomain,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return value, nil
+}
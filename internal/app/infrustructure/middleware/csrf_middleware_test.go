@@ -0,0 +1,241 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+func newCSRFTestHandler(csrf config.CSRFOptions) (http.Handler, *session.SessionManager) {
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+		CSRF:          csrf,
+	}
+	sm := session.NewSessionManager(session.NewMemoryStore(context.Background(), 0), options)
+
+	handler := middleware.CSRFMiddleware(sm, options, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(middleware.CSRFTokenFromContext(r.Context())))
+	}))
+	return handler, sm
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRFMiddleware_DoubleSubmit(t *testing.T) {
+	t.Parallel()
+
+	handler, _ := newCSRFTestHandler(config.CSRFOptions{Enabled: true, DoubleSubmit: true, CookieName: "csrf_token"})
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, "csrf_token", cookie.Name)
+	assert.False(t, cookie.HttpOnly, "API clients have to read the cookie")
+	assert.Equal(t, cookie.Value, w.Body.String(), "Token should be passed to handlers")
+
+	tests := []struct {
+		name     string
+		cookie   string
+		header   string
+		form     string
+		expected int
+	}{
+		{name: "no token", cookie: cookie.Value, expected: http.StatusForbidden},
+		{name: "no cookie", header: cookie.Value, expected: http.StatusForbidden},
+		{name: "header", cookie: cookie.Value, header: cookie.Value, expected: http.StatusOK},
+		{name: "form field", cookie: cookie.Value, form: cookie.Value, expected: http.StatusOK},
+		{name: "mismatch", cookie: cookie.Value, header: "other", expected: http.StatusForbidden},
+		{name: "unsigned cookie", cookie: "planted", header: "planted", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(url.Values{"csrf_token": {tt.form}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(middleware.CSRFHeaderName, tt.header)
+			}
+
+			w := serve(handler, r)
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusForbidden {
+				var envelope dtos.ErrorDto
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+				assert.Equal(t, respond.CodeForbidden, envelope.Code)
+			}
+		})
+	}
+}
+
+func TestCSRFMiddleware_SessionToken(t *testing.T) {
+	t.Parallel()
+
+	handler, sm := newCSRFTestHandler(config.CSRFOptions{Enabled: true, CookieName: "csrf_token"})
+
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, httptest.NewRequest(http.MethodPost, "/auth/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	sessionCookie := w.Result().Cookies()[0]
+
+	withSession := func(method string) *http.Request {
+		r := httptest.NewRequest(method, "/users/sessions", nil)
+		r.AddCookie(sessionCookie)
+		return r
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(handler, withSession(http.MethodDelete)).Code,
+		"Session without token should refuse unsafe requests")
+
+	w = serve(handler, withSession(http.MethodGet))
+	require.Equal(t, http.StatusOK, w.Code)
+	token := w.Body.String()
+	require.NotEmpty(t, token)
+
+	w = serve(handler, withSession(http.MethodGet))
+	assert.Equal(t, token, w.Body.String(), "Token should be kept for the whole session")
+
+	r := withSession(http.MethodDelete)
+	r.Header.Set(middleware.CSRFHeaderName, token)
+	assert.Equal(t, http.StatusOK, serve(handler, r).Code)
+
+	r = withSession(http.MethodDelete)
+	r.Header.Set(middleware.CSRFHeaderName, token+"x")
+	assert.Equal(t, http.StatusForbidden, serve(handler, r).Code)
+}
+
+func TestCSRFMiddleware_APIClientGetsSessionToken(t *testing.T) {
+	t.Parallel()
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+		CSRF:          config.CSRFOptions{Enabled: true, DoubleSubmit: true, CookieName: "csrf_token"},
+	}
+	sm := session.NewSessionManager(session.NewMemoryStore(context.Background(), 0), options)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/login", func(w http.ResponseWriter, r *http.Request) {
+		_, err := sm.CreateSession(w, r, &session.Session{UserID: uuid.NewString()})
+		require.NoError(t, err)
+	})
+	mux.HandleFunc("GET /csrf", middleware.CSRFTokenHandler)
+	mux.HandleFunc("POST /vms", func(w http.ResponseWriter, r *http.Request) {})
+	handler := middleware.CSRFMiddleware(sm, options, mux)
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/csrf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	csrfCookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	r.AddCookie(csrfCookie)
+	r.Header.Set(middleware.CSRFHeaderName, csrfCookie.Value)
+	w = serve(handler, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	sessionCookie := w.Result().Cookies()[0]
+	require.Equal(t, "session_id", sessionCookie.Name)
+
+	r = httptest.NewRequest(http.MethodGet, "/csrf", nil)
+	r.AddCookie(sessionCookie)
+	w = serve(handler, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	token := body["csrf_token"]
+	require.NotEmpty(t, token)
+	assert.Equal(t, token, w.Header().Get(middleware.CSRFHeaderName), "Token should also be sent in the header")
+	assert.NotEqual(t, csrfCookie.Value, token, "Session should get its own token")
+
+	r = httptest.NewRequest(http.MethodPost, "/vms", nil)
+	r.AddCookie(sessionCookie)
+	r.Header.Set(middleware.CSRFHeaderName, token)
+	assert.Equal(t, http.StatusOK, serve(handler, r).Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/vms", nil)
+	r.AddCookie(sessionCookie)
+	assert.Equal(t, http.StatusForbidden, serve(handler, r).Code)
+}
+
+func TestCSRFMiddleware_SessionIgnoresDoubleSubmitCookie(t *testing.T) {
+	t.Parallel()
+
+	handler, sm := newCSRFTestHandler(config.CSRFOptions{Enabled: true, DoubleSubmit: true, CookieName: "csrf_token"})
+
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	csrfCookie := w.Result().Cookies()[0]
+
+	w = httptest.NewRecorder()
+	_, err := sm.CreateSession(w, httptest.NewRequest(http.MethodPost, "/auth/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	sessionCookie := w.Result().Cookies()[0]
+
+	withSession := func(method string, token string) *http.Request {
+		r := httptest.NewRequest(method, "/users/sessions", nil)
+		r.AddCookie(sessionCookie)
+		r.AddCookie(csrfCookie)
+		if token != "" {
+			r.Header.Set(middleware.CSRFHeaderName, token)
+		}
+		return r
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(handler, withSession(http.MethodDelete, csrfCookie.Value)).Code,
+		"Cookie token shouldn't be accepted for session without token")
+
+	w = serve(handler, withSession(http.MethodGet, ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	token := w.Body.String()
+	require.NotEqual(t, csrfCookie.Value, token, "Session should get its own token")
+
+	assert.Equal(t, http.StatusForbidden, serve(handler, withSession(http.MethodDelete, csrfCookie.Value)).Code,
+		"Cookie token shouldn't be accepted for session with its own token")
+	assert.Equal(t, http.StatusOK, serve(handler, withSession(http.MethodDelete, token)).Code)
+}
+
+func TestCSRFMiddleware_Exemptions(t *testing.T) {
+	t.Parallel()
+
+	handler, _ := newCSRFTestHandler(config.CSRFOptions{Enabled: true, DoubleSubmit: true, ExemptBearer: true, CookieName: "csrf_token"})
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, http.StatusOK, serve(handler, r).Code, "Bearer requests should be exempt")
+
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Equal(t, http.StatusForbidden, serve(handler, r).Code, "Only bearer requests should be exempt")
+
+	handler, _ = newCSRFTestHandler(config.CSRFOptions{Enabled: true, DoubleSubmit: true, CookieName: "csrf_token"})
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, http.StatusForbidden, serve(handler, r).Code, "Bearer requests shouldn't be exempt unless enabled")
+
+	handler, _ = newCSRFTestHandler(config.CSRFOptions{Enabled: false})
+	assert.Equal(t, http.StatusOK, serve(handler, httptest.NewRequest(http.MethodPost, "/", nil)).Code)
+}
@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
 )
 
 type RecaptchaResponse struct {
@@ -17,41 +20,42 @@ func RecaptchaMiddleware(cfg *config.GRecapOptions, next http.Handler) http.Hand
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		recaptchaToken := r.Header.Get("recaptcha")
 		if recaptchaToken == "" {
-			http.Error(w, "Missing reCAPTCHA token", http.StatusBadRequest)
+			respond.Error(w, r, http.StatusBadRequest, respond.CodeBadRequest, "Missing reCAPTCHA token")
 			return
 		}
 
 		secretKey := cfg.SecretKey
 		if secretKey == "" {
-			http.Error(w, "Server misconfiguration: Missing reCAPTCHA secret key", http.StatusInternalServerError)
+			respond.InternalError(w, r, "Failed to verify reCAPTCHA", errors.New("reCAPTCHA secret key is not set"))
 			return
 		}
 
-		recaptchaURL := "https://www.google.com/recaptcha/api/siteverify"
-		response, err := http.PostForm(recaptchaURL, map[string][]string{
+		response, err := http.PostForm(cfg.URL, map[string][]string{
 			"secret":   {secretKey},
 			"response": {recaptchaToken},
 		})
 		if err != nil {
-			http.Error(w, "Failed to verify reCAPTCHA", http.StatusInternalServerError)
+			respond.InternalError(w, r, "Failed to verify reCAPTCHA", err)
 			return
 		}
 		defer response.Body.Close()
 
 		body, err := io.ReadAll(response.Body)
 		if err != nil {
-			http.Error(w, "Failed to read reCAPTCHA verification response", http.StatusInternalServerError)
+			respond.InternalError(w, r, "Failed to verify reCAPTCHA",
+				fmt.Errorf("failed to read reCAPTCHA verification response: %w", err))
 			return
 		}
 
 		var recaptchaResponse RecaptchaResponse
 		if err := json.Unmarshal(body, &recaptchaResponse); err != nil {
-			http.Error(w, "Failed to parse reCAPTCHA verification response", http.StatusInternalServerError)
+			respond.InternalError(w, r, "Failed to verify reCAPTCHA",
+				fmt.Errorf("failed to parse reCAPTCHA verification response: %w", err))
 			return
 		}
 
 		if !recaptchaResponse.Success {
-			http.Error(w, "Invalid  reCAPTCHA token", http.StatusUnauthorized)
+			respond.Error(w, r, http.StatusUnauthorized, respond.CodeUnauthorized, "Invalid reCAPTCHA token")
 			return
 		}
 
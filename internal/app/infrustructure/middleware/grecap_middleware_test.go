@@ -0,0 +1,71 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecaptchaMiddleware_Errors(t *testing.T) {
+	t.Parallel()
+
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(middleware.RecaptchaResponse{Success: r.PostFormValue("response") == "valid"})
+	}))
+	t.Cleanup(verifier.Close)
+
+	newHandler := func(secretKey string) http.Handler {
+		return chimiddleware.RequestID(middleware.RecaptchaMiddleware(&config.GRecapOptions{SecretKey: secretKey, URL: verifier.URL},
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})))
+	}
+	withToken := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		if token != "" {
+			r.Header.Set("recaptcha", token)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		secretKey string
+		token     string
+		status    int
+		code      string
+		message   string
+	}{
+		{name: "missing token", secretKey: "secret", status: http.StatusBadRequest, code: respond.CodeBadRequest,
+			message: "Missing reCAPTCHA token"},
+		{name: "invalid token", secretKey: "secret", token: "invalid", status: http.StatusUnauthorized,
+			code: respond.CodeUnauthorized, message: "Invalid reCAPTCHA token"},
+		{name: "missing secret", token: "valid", status: http.StatusInternalServerError, code: respond.CodeInternal,
+			message: "Failed to verify reCAPTCHA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(newHandler(tt.secretKey), withToken(tt.token))
+			require.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var envelope dtos.ErrorDto
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+			assert.Equal(t, tt.code, envelope.Code)
+			assert.Equal(t, tt.message, envelope.Message)
+			assert.NotEmpty(t, envelope.RequestID)
+		})
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(newHandler("secret"), withToken("valid")).Code)
+}
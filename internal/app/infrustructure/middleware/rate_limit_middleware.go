@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	"github.com/Mixturka/vm-hub/pkg/putils"
+)
+
+// Header automation clients send their API key in. Authorization header with
+// Bearer scheme is accepted as well.
+const APIKeyHeaderName = "X-API-Key"
+
+// Limits requests to routes it's mounted on according to policy and reports
+// the limit in RateLimit-* headers. Denied requests get 429 with Retry-After.
+// If store fails, requests are let through rather than failing the API.
+func RateLimitMiddleware(store ratelimit.Store, policy ratelimit.Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "rate_limit:" + policy.Name + ":" + policy.Key(r)
+		result, err := store.Take(r.Context(), key, policy, time.Now())
+		if err != nil {
+			slog.Warn("Failed to apply rate limit", "policy", policy.Name, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", policy.String())
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			respond.Error(w, r, http.StatusTooManyRequests, respond.CodeTooManyRequests, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Counts requests by client IP.
+func RateLimitByIP(r *http.Request) string {
+	return "ip:" + putils.ClientIP(r)
+}
+
+// Counts requests by user signed in with session. Has to run after
+// AuthMiddleware, falls back to IP otherwise.
+func RateLimitByUser(r *http.Request) string {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return "user:" + user.ID
+	}
+	return RateLimitByIP(r)
+}
+
+// Returns ID of API key if it has been issued.
+type APIKeyLookup func(ctx context.Context, apiKey string) (string, bool)
+
+// Counts requests by API key sent in X-API-Key or Authorization header,
+// requests without a key are counted by IP. With lookup only keys it knows
+// get a limit of their own, so made up keys can't be used to dodge the limit.
+// Without it every key is counted apart, so it has to be mounted behind
+// authentication that rejects unknown keys. Keys are hashed, stores never see
+// them.
+func RateLimitByAPIKey(lookup APIKeyLookup) ratelimit.KeyFunc {
+	return func(r *http.Request) string {
+		apiKey := requestAPIKey(r)
+		if apiKey == "" {
+			return RateLimitByIP(r)
+		}
+
+		if lookup == nil {
+			sum := sha256.Sum256([]byte(apiKey))
+			return "api_key:" + hex.EncodeToString(sum[:16])
+		}
+		id, ok := lookup(r.Context(), apiKey)
+		if !ok {
+			return RateLimitByIP(r)
+		}
+		return "api_key:" + id
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if apiKey := r.Header.Get(APIKeyHeaderName); apiKey != "" {
+		return apiKey
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,138 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/respond"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Policy, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store is down")
+}
+
+func newRateLimitTestHandler(store ratelimit.Store, key ratelimit.KeyFunc) http.Handler {
+	policy := ratelimit.Policy{
+		Name:      "test",
+		Algorithm: ratelimit.SlidingWindow,
+		Limit:     2,
+		Window:    time.Hour,
+		Key:       key,
+	}
+	return middleware.RateLimitMiddleware(store, policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func requestFrom(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	return r
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := newRateLimitTestHandler(ratelimit.NewMemoryStore(context.Background(), 0), middleware.RateLimitByIP)
+
+	for i := 1; i <= 2; i++ {
+		w := serve(handler, requestFrom("203.0.113.7"))
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "2;w=3600", w.Header().Get("RateLimit-Policy"))
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, []string{"1", "0"}[i-1], w.Header().Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	}
+
+	r := requestFrom("203.0.113.7")
+	r.Header.Set(chimiddleware.RequestIDHeader, "test-request")
+	w := serve(chimiddleware.RequestID(handler), r)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.NotEqual(t, "0", w.Header().Get("Retry-After"))
+
+	var envelope dtos.ErrorDto
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	assert.Equal(t, respond.CodeTooManyRequests, envelope.Code)
+	assert.Equal(t, "test-request", envelope.RequestID)
+
+	w = serve(handler, requestFrom("198.51.100.1"))
+	assert.Equal(t, http.StatusNoContent, w.Code, "Other clients shouldn't be limited")
+}
+
+func TestRateLimitMiddleware_APIKey(t *testing.T) {
+	t.Parallel()
+
+	issued := map[string]string{"first": "key-1", "second": "key-2"}
+	lookup := func(_ context.Context, apiKey string) (string, bool) {
+		id, ok := issued[apiKey]
+		return id, ok
+	}
+	handler := newRateLimitTestHandler(ratelimit.NewMemoryStore(context.Background(), 0), middleware.RateLimitByAPIKey(lookup))
+	withKey := func(ip string, key string) *http.Request {
+		r := requestFrom(ip)
+		r.Header.Set(middleware.APIKeyHeaderName, key)
+		return r
+	}
+
+	serve(handler, withKey("203.0.113.7", "first"))
+	serve(handler, withKey("203.0.113.7", "first"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, withKey("203.0.113.7", "first")).Code)
+	assert.Equal(t, http.StatusNoContent, serve(handler, withKey("203.0.113.7", "second")).Code,
+		"Keys sharing an IP should be limited separately")
+	assert.Equal(t, http.StatusNoContent, serve(handler, requestFrom("203.0.113.7")).Code,
+		"Requests without a key should be limited by IP")
+
+	serve(handler, withKey("198.51.100.1", "made-up-1"))
+	serve(handler, withKey("198.51.100.1", "made-up-2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, withKey("198.51.100.1", "made-up-3")).Code,
+		"Unknown keys shouldn't get a limit of their own")
+}
+
+func TestRateLimitByAPIKey_Headers(t *testing.T) {
+	t.Parallel()
+
+	key := middleware.RateLimitByAPIKey(nil)
+
+	r := requestFrom("203.0.113.7")
+	assert.Equal(t, "ip:203.0.113.7", key(r), "Requests without a key should be counted by IP")
+
+	r.Header.Set(middleware.APIKeyHeaderName, "secret")
+	fromHeader := key(r)
+	assert.True(t, strings.HasPrefix(fromHeader, "api_key:"))
+	assert.NotContains(t, fromHeader, "secret", "Key shouldn't be stored as is")
+
+	r = requestFrom("198.51.100.1")
+	r.Header.Set("Authorization", "Bearer secret")
+	assert.Equal(t, fromHeader, key(r), "Bearer token should count as the same key")
+
+	r = requestFrom("198.51.100.1")
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Equal(t, "ip:198.51.100.1", key(r))
+}
+
+func TestRateLimitMiddleware_StoreError(t *testing.T) {
+	t.Parallel()
+
+	handler := newRateLimitTestHandler(failingStore{}, middleware.RateLimitByIP)
+
+	w := serve(handler, requestFrom("203.0.113.7"))
+	assert.Equal(t, http.StatusNoContent, w.Code, "Requests should be let through when store fails")
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
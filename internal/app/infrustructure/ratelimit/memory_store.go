@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	// Token bucket state.
+	tokens    float64
+	updatedAt time.Time
+	// Sliding window state.
+	window   int64
+	current  int
+	previous int
+
+	expiresAt time.Time
+}
+
+// Keeps limits in process memory, so they aren't shared between instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// Starts a janitor evicting idle entries every janitorInterval until ctx is done.
+func NewMemoryStore(ctx context.Context, janitorInterval time.Duration) *MemoryStore {
+	ms := &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+
+	if janitorInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(janitorInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					ms.purgeExpired(time.Now())
+				}
+			}
+		}()
+	}
+
+	return ms
+}
+
+func (ms *MemoryStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, ok := ms.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{tokens: float64(policy.Capacity()), updatedAt: now}
+		ms.entries[key] = entry
+	}
+
+	if policy.Algorithm == SlidingWindow {
+		return ms.takeFromWindow(entry, policy, now), nil
+	}
+	return ms.takeToken(entry, policy, now), nil
+}
+
+func (ms *MemoryStore) takeToken(entry *memoryEntry, policy Policy, now time.Time) Result {
+	rate := policy.refillRate()
+	capacity := float64(policy.Capacity())
+
+	elapsed := math.Max(0, now.Sub(entry.updatedAt).Seconds())
+	entry.tokens = math.Min(capacity, entry.tokens+elapsed*rate)
+	entry.updatedAt = now
+
+	allowed := entry.tokens >= 1
+	if allowed {
+		entry.tokens--
+	}
+	// Full bucket is the same as no entry.
+	entry.expiresAt = now.Add(seconds((capacity - entry.tokens) / rate))
+
+	return tokenBucketResult(policy, allowed, entry.tokens)
+}
+
+func (ms *MemoryStore) takeFromWindow(entry *memoryEntry, policy Policy, now time.Time) Result {
+	window, elapsed := windowOf(policy, now)
+	switch entry.window {
+	case window:
+	case window - 1:
+		entry.previous, entry.current = entry.current, 0
+	default:
+		entry.previous, entry.current = 0, 0
+	}
+	entry.window = window
+
+	left := policy.Window - elapsed
+	weighted := float64(entry.previous)*left.Seconds()/policy.Window.Seconds() + float64(entry.current)
+	allowed := weighted+1 <= float64(policy.Limit)
+	if allowed {
+		entry.current++
+	}
+	// Counts of the current window matter until the next one is over.
+	entry.expiresAt = now.Add(left + policy.Window)
+
+	return slidingWindowResult(policy, allowed, entry.current, entry.previous, elapsed)
+}
+
+func (ms *MemoryStore) purgeExpired(now time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for key, entry := range ms.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(ms.entries, key)
+		}
+	}
+}
+
+// Returns index of fixed window now falls into and time elapsed since it started.
+func windowOf(policy Policy, now time.Time) (int64, time.Duration) {
+	ms := now.UnixMilli()
+	size := policy.Window.Milliseconds()
+	return ms / size, time.Duration(ms%size) * time.Millisecond
+}
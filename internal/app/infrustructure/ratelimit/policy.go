@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+type Algorithm int
+
+const (
+	// Allows bursts of up to Burst requests, refilled at Limit per Window.
+	TokenBucket Algorithm = iota
+	// Allows Limit requests within any Window, approximated from counts of
+	// the current and the previous fixed window.
+	SlidingWindow
+)
+
+// Returns key requests are counted by, e.g. client IP.
+type KeyFunc func(r *http.Request) string
+
+// Limit applied to a group of routes. Name has to be unique, so routes with
+// different policies don't share allowance.
+type Policy struct {
+	Name      string
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+	// Token bucket capacity, Limit if not set.
+	Burst int
+	Key   KeyFunc
+}
+
+// Most requests allowed at once.
+func (p Policy) Capacity() int {
+	if p.Algorithm == TokenBucket && p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// Value of RateLimit-Policy header.
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(p.Window.Seconds()))
+}
+
+// Tokens added to the bucket per second.
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Time until allowance is fully restored.
+	Reset time.Duration
+	// Time until next request is allowed, set only when request is denied.
+	RetryAfter time.Duration
+}
+
+// Keeps state of limits. Take is atomic, so concurrent requests, also of
+// different instances sharing a store, can't exceed the limit.
+type Store interface {
+	// Takes one request from allowance of key under policy.
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+// Builds result of token bucket holding tokens after the request was handled.
+func tokenBucketResult(policy Policy, allowed bool, tokens float64) Result {
+	rate := policy.refillRate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Capacity(),
+		Remaining: int(tokens),
+		Reset:     seconds((float64(policy.Capacity()) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+// Builds result of sliding window from request counts of the current and the
+// previous window after the request was handled. elapsed is time since the
+// current window started.
+func slidingWindowResult(policy Policy, allowed bool, current, previous int, elapsed time.Duration) Result {
+	window := policy.Window.Seconds()
+	left := window - elapsed.Seconds()
+	weighted := float64(previous)*left/window + float64(current)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: max(0, int(math.Floor(float64(policy.Limit)-weighted))),
+		Reset:     seconds(left),
+	}
+	if allowed {
+		return result
+	}
+
+	if current >= policy.Limit {
+		// Current window is used up, in the next one its requests weigh less
+		// as it goes.
+		result.RetryAfter = seconds(left + window*(1-float64(policy.Limit-1)/float64(current)))
+	} else {
+		// Previous window weighs less as the current one goes.
+		result.RetryAfter = seconds(left - window*float64(policy.Limit-current-1)/float64(previous))
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(0, s) * float64(time.Second))
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Refills bucket for time passed since the last request and takes a token.
+// Tokens are returned as string, Lua numbers are truncated to integers in
+// replies.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(state[1])
+if tokens == nil then
+	tokens = capacity
+else
+	tokens = math.min(capacity, tokens + math.max(0, now - tonumber(state[2])) * rate)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1)
+return {allowed, tostring(tokens)}
+`)
+
+// Weighs count of the previous window by the part of it still inside the
+// sliding window and counts the request in the current one if allowed.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+
+local allowed = 0
+if previous * (window - elapsed) / window + current + 1 <= limit then
+	current = redis.call("INCR", KEYS[1])
+	redis.call("PEXPIRE", KEYS[1], window * 2)
+	allowed = 1
+end
+return {allowed, current, previous}
+`)
+
+// Keeps limits in Redis, so they are shared between instances.
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func (rs *RedisStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	if policy.Algorithm == SlidingWindow {
+		return rs.takeFromWindow(ctx, key, policy, now)
+	}
+	return rs.takeToken(ctx, key, policy, now)
+}
+
+func (rs *RedisStore) takeToken(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	// Rate is per millisecond, as is time passed to the script.
+	rate := policy.refillRate() / 1000
+	reply, err := tokenBucketScript.Run(ctx, rs.client, []string{key},
+		policy.Capacity(), strconv.FormatFloat(rate, 'g', -1, 64), now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take token: %w", err)
+	}
+	if len(reply) != 2 {
+		return Result{}, fmt.Errorf("unexpected token bucket reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensStr, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected token bucket reply %v", reply)
+	}
+
+	return tokenBucketResult(policy, allowed == 1, math.Max(0, tokens)), nil
+}
+
+func (rs *RedisStore) takeFromWindow(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	window, elapsed := windowOf(policy, now)
+	keys := []string{
+		fmt.Sprintf("%s:%d", key, window),
+		fmt.Sprintf("%s:%d", key, window-1),
+	}
+	reply, err := slidingWindowScript.Run(ctx, rs.client, keys,
+		policy.Limit, policy.Window.Milliseconds(), elapsed.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to count request: %w", err)
+	}
+	if len(reply) != 3 {
+		return Result{}, fmt.Errorf("unexpected sliding window reply %v", reply)
+	}
+
+	return slidingWindowResult(policy, reply[0] == 1, int(reply[1]), int(reply[2]), elapsed), nil
+}
@@ -0,0 +1,101 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Start of a minute, so sliding windows start with it.
+var start = time.Unix(1_700_000_040, 0)
+
+// Behaviour every Store has to share.
+func testStore(t *testing.T, store ratelimit.Store) {
+	ctx := context.Background()
+
+	t.Run("Token bucket", func(t *testing.T) {
+		key := uuid.NewString()
+		policy := ratelimit.Policy{Algorithm: ratelimit.TokenBucket, Limit: 60, Window: time.Minute, Burst: 3}
+
+		for i := 1; i <= 3; i++ {
+			result, err := store.Take(ctx, key, policy, start)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed, "Burst should be allowed, request %d", i)
+			assert.Equal(t, 3, result.Limit)
+			assert.Equal(t, 3-i, result.Remaining)
+		}
+
+		result, err := store.Take(ctx, key, policy, start)
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Zero(t, result.Remaining)
+		assert.InDelta(t, time.Second.Seconds(), result.RetryAfter.Seconds(), 0.01)
+		assert.InDelta(t, 3*time.Second.Seconds(), result.Reset.Seconds(), 0.01)
+
+		result, err = store.Take(ctx, key, policy, start.Add(time.Second))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "Token should be refilled")
+
+		result, err = store.Take(ctx, key, policy, start.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Remaining, "Bucket shouldn't hold more than Burst")
+
+		result, err = store.Take(ctx, uuid.NewString(), policy, start)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "Keys should be limited separately")
+	})
+
+	t.Run("Sliding window", func(t *testing.T) {
+		key := uuid.NewString()
+		policy := ratelimit.Policy{Algorithm: ratelimit.SlidingWindow, Limit: 4, Window: time.Minute}
+
+		for i := 1; i <= 4; i++ {
+			result, err := store.Take(ctx, key, policy, start)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed, "Request %d should be allowed", i)
+			assert.Equal(t, 4-i, result.Remaining)
+		}
+
+		result, err := store.Take(ctx, key, policy, start.Add(30*time.Second))
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 4, result.Limit)
+		assert.InDelta(t, (30 * time.Second).Seconds(), result.Reset.Seconds(), 0.01)
+		// Requests of this window weigh 3 of 4 after a quarter of the next one.
+		assert.InDelta(t, (45 * time.Second).Seconds(), result.RetryAfter.Seconds(), 0.01)
+
+		result, err = store.Take(ctx, key, policy, start.Add(time.Minute+10*time.Second))
+		require.NoError(t, err)
+		assert.False(t, result.Allowed, "Previous window should still weigh in")
+
+		result, err = store.Take(ctx, key, policy, start.Add(time.Minute+15*time.Second))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Zero(t, result.Remaining)
+
+		result, err = store.Take(ctx, key, policy, start.Add(3*time.Minute))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Remaining, "Old windows shouldn't count")
+	})
+}
+
+func TestStore_Memory(t *testing.T) {
+	t.Parallel()
+
+	testStore(t, ratelimit.NewMemoryStore(context.Background(), 0))
+}
+
+func TestStore_Redis(t *testing.T) {
+	t.Parallel()
+
+	util := test.NewRedisTestUtil(t)
+	testStore(t, ratelimit.NewRedisStore(util.Client()))
+}
@@ -0,0 +1,61 @@
+// Package respond writes JSON responses shared by controllers and
+// middlewares, so every error carries the same envelope.
+package respond
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// Codes of error responses.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidPayload     = "invalid_payload"
+	CodeValidationFailed   = "validation_failed"
+	CodeWeakPassword       = "weak_password"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeEmailNotVerified   = "email_not_verified"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeNotImplemented     = "not_implemented"
+	CodeInternal           = "internal_error"
+)
+
+func JSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+// Responds with error envelope carrying ID of the request, so reports can be
+// matched with logs.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	FieldErrors(w, r, status, code, message, nil)
+}
+
+func FieldErrors(w http.ResponseWriter, r *http.Request, status int, code, message string, errs []dtos.FieldError) {
+	JSON(w, status, dtos.ErrorDto{
+		Code:      code,
+		Message:   message,
+		Errors:    errs,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+	})
+}
+
+// Logs err and responds with generic message, as err may carry details
+// clients shouldn't see.
+func InternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	slog.Error(message, "error", err, "request_id", chimiddleware.GetReqID(r.Context()))
+	Error(w, r, http.StatusInternalServerError, CodeInternal, message)
+}
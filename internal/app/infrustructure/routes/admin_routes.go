@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/go-chi/chi/v5"
+)
+
+func RegisterAdminRoutes(r chi.Router, sessionController *controllers.SessionController, mw Middlewares) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(mw.Auth)
+		r.Use(mw.Admin)
+
+		r.Route("/users/{userID}/sessions", func(r chi.Router) {
+			r.Get("/", sessionController.ListForUser)
+			r.Delete("/", sessionController.RevokeAllForUser)
+			r.Delete("/{id}", sessionController.RevokeForUser)
+		})
+	})
+}
@@ -1,2 +1,52 @@
 package routes
 
+import (
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/go-chi/chi/v5"
+)
+
+func RegisterAuthRoutes(r chi.Router, authController *controllers.AuthController,
+	oauthController *controllers.OAuthController, passkeyController *controllers.PasskeyController, mw Middlewares) {
+	// Unauthenticated endpoints sending mail, checking passwords or calling
+	// OAuth providers.
+	credentialsLimit := mw.RateLimit(ratelimit.Policy{
+		Name:      "auth",
+		Algorithm: ratelimit.SlidingWindow,
+		Limit:     10,
+		Window:    time.Minute,
+		Key:       middleware.RateLimitByIP,
+	})
+
+	r.Route("/auth", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(credentialsLimit)
+			r.Use(mw.Recaptcha)
+			r.Post("/register", authController.Register)
+			r.Post("/login", authController.Login)
+			r.Post("/verify/resend", authController.ResendVerification)
+			r.Post("/password/forgot", authController.ForgotPassword)
+		})
+		r.Post("/logout", authController.Logout)
+		r.Get("/verify", authController.VerifyEmail)
+		r.With(credentialsLimit).Post("/login/complete", authController.CompleteLogin)
+		r.Get("/password/reset", authController.ResetPasswordPage)
+		r.With(credentialsLimit).Post("/password/reset", authController.ResetPassword)
+		r.With(mw.Auth).Post("/password/change", authController.ChangePassword)
+
+		r.Route("/passkey/login", func(r chi.Router) {
+			r.Use(credentialsLimit)
+			r.Post("/begin", passkeyController.BeginLogin)
+			r.Post("/finish", passkeyController.FinishLogin)
+		})
+
+		r.Route("/oauth", func(r chi.Router) {
+			r.Use(credentialsLimit)
+			r.Get("/connect/{provider}", oauthController.Connect)
+			r.Get("/callback/{provider}", oauthController.Callback)
+		})
+	})
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+)
+
+// Middlewares holds chi-compatible middlewares shared between route groups.
+type Middlewares struct {
+	Auth      func(http.Handler) http.Handler
+	Recaptcha func(http.Handler) http.Handler
+	Admin     func(http.Handler) http.Handler
+	// Builds middleware limiting requests according to policy.
+	RateLimit func(policy ratelimit.Policy) func(http.Handler) http.Handler
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/controllers"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/ratelimit"
+	"github.com/go-chi/chi/v5"
+)
+
+func RegisterUserRoutes(r chi.Router, userController *controllers.UserController,
+	totpController *controllers.TotpController, passkeyController *controllers.PasskeyController,
+	sessionController *controllers.SessionController, mw Middlewares) {
+	r.Route("/users", func(r chi.Router) {
+		r.Use(mw.Auth)
+		r.Use(mw.RateLimit(ratelimit.Policy{
+			Name:      "users",
+			Algorithm: ratelimit.TokenBucket,
+			Limit:     120,
+			Window:    time.Minute,
+			Burst:     30,
+			Key:       middleware.RateLimitByUser,
+		}))
+		r.Get("/profile", userController.FindProfile)
+		r.Put("/two-factor", userController.SetTwoFactor)
+
+		r.Route("/two-factor/totp", func(r chi.Router) {
+			r.Post("/", totpController.BeginEnrollment)
+			r.Post("/confirm", totpController.ConfirmEnrollment)
+			r.Post("/recovery-codes", totpController.RegenerateRecoveryCodes)
+			r.Post("/disable", totpController.Disable)
+		})
+
+		r.Route("/passkeys/register", func(r chi.Router) {
+			r.Post("/begin", passkeyController.BeginRegistration)
+			r.Post("/finish", passkeyController.FinishRegistration)
+		})
+
+		r.Route("/sessions", func(r chi.Router) {
+			r.Get("/", sessionController.List)
+			r.Delete("/", sessionController.RevokeOthers)
+			r.Delete("/{id}", sessionController.Revoke)
+		})
+	})
+}
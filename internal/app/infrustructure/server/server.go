@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/middleware"
 	"github.com/Mixturka/vm-hub/web/templates"
 
 	"github.com/a-h/templ"
@@ -50,10 +51,16 @@ func (s *Server) Shutdown() {
 	}
 }
 
-func SetupRouter() chi.Router {
+// Middlewares are applied to every route, including ones registered later.
+func SetupRouter(middlewares ...func(http.Handler) http.Handler) chi.Router {
 	r := chi.NewRouter()
-	r.Handle("/styles/*", http.StripPrefix("/styles/", http.FileServer(http.Dir("views/styles"))))
-	r.Get("/", templ.Handler(templates.Index()).ServeHTTP)
+	r.Use(middlewares...)
+	r.Handle("/styles/*", http.StripPrefix("/styles/", http.FileServer(http.Dir("web/styles"))))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		csrfToken := middleware.CSRFTokenFromContext(r.Context())
+		templ.Handler(templates.Index(csrfToken)).ServeHTTP(w, r)
+	})
+	r.Get("/csrf", middleware.CSRFTokenHandler)
 
 	return r
 }
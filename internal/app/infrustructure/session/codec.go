@@ -0,0 +1,100 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Serializes data SessionManager keeps in storage.
+type Codec interface {
+	// Byte stored in front of encoded data, so data written with any known
+	// codec can be read back after switching to another one.
+	Tag() byte
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Tag() byte { return 'j' }
+
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// More compact than JSON, but only readable by Go.
+type GobCodec struct{}
+
+func (GobCodec) Tag() byte { return 'g' }
+
+func (GobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Returns codec configured with SESSION_CODEC.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case "", "json":
+		return JSONCodec{}, nil
+	case "gob":
+		return GobCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown session codec %q", name)
+	}
+}
+
+var knownCodecs = []Codec{JSONCodec{}, GobCodec{}}
+
+// Before sessions were typed, entries were stored as untagged JSON objects.
+const legacyJSONTag = '{'
+
+// Implemented by stored types that used to be plain maps.
+type legacyEntry interface {
+	fromLegacy(values map[string]interface{})
+}
+
+func encode(codec Codec, v interface{}) ([]byte, error) {
+	data, err := codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{codec.Tag()}, data...), nil
+}
+
+// Decodes data written by encode with any known codec, or a legacy map.
+func decode(data []byte, v legacyEntry) error {
+	if len(data) == 0 {
+		return errors.New("empty session data")
+	}
+
+	if data[0] == legacyJSONTag {
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+		v.fromLegacy(values)
+		return nil
+	}
+
+	for _, codec := range knownCodecs {
+		if codec.Tag() == data[0] {
+			return codec.Decode(data[1:], v)
+		}
+	}
+	return fmt.Errorf("unknown session codec tag %q", data[0])
+}
@@ -0,0 +1,162 @@
+package session_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCodecTestManager(store *session.MemoryStore, codec string) *session.SessionManager {
+	return session.NewSessionManager(store, &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+		Codec:         codec,
+	})
+}
+
+// Returns request carrying session cookie for sessionID.
+func requestWithSession(t *testing.T, sessionID string) *http.Request {
+	value, err := session.NewCookieCodec([]string{testSessionSecret}, nil).Encode("session_id", sessionID)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session_id", Value: value})
+	return r
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []string{"json", "gob"} {
+		t.Run(codec, func(t *testing.T) {
+			t.Parallel()
+
+			store := session.NewMemoryStore(context.Background(), 0)
+			sm := newCodecTestManager(store, codec)
+
+			r := httptest.NewRequest("POST", "/login", nil)
+			r.Header.Set("User-Agent", "browser")
+			created := &session.Session{
+				UserID:    uuid.NewString(),
+				AuthLevel: session.AuthLevelMultiFactor,
+				Values:    map[string]string{"theme": "dark"},
+			}
+			sessionID, err := sm.CreateSession(httptest.NewRecorder(), r, created)
+			require.NoError(t, err)
+
+			sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+			require.NoError(t, err)
+			require.NotNil(t, sess)
+			assert.Equal(t, sessionID, sess.ID)
+			assert.Equal(t, created.UserID, sess.UserID)
+			assert.Equal(t, session.AuthLevelMultiFactor, sess.AuthLevel)
+			assert.Equal(t, "browser", sess.UserAgent)
+			assert.Equal(t, "dark", sess.Values["theme"])
+			assert.WithinDuration(t, created.CreatedAt, sess.CreatedAt, time.Second)
+			assert.WithinDuration(t, created.ExpiresAt, sess.ExpiresAt, time.Second)
+		})
+	}
+}
+
+func TestCodecs_SwitchKeepsSessions(t *testing.T) {
+	t.Parallel()
+
+	store := session.NewMemoryStore(context.Background(), 0)
+	userID := uuid.NewString()
+
+	sessionID, err := newCodecTestManager(store, "gob").CreateSession(httptest.NewRecorder(),
+		httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: userID})
+	require.NoError(t, err)
+
+	sm := newCodecTestManager(store, "json")
+	sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+	require.NoError(t, err)
+	require.NotNil(t, sess, "Sessions written with previous codec should stay readable")
+	assert.Equal(t, userID, sess.UserID)
+
+	sessions, err := sm.ListUserSessions(context.Background(), userID, nil)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestCodecs_LegacyEntry(t *testing.T) {
+	t.Parallel()
+
+	store := session.NewMemoryStore(context.Background(), 0)
+	sm := newCodecTestManager(store, "json")
+	ctx := context.Background()
+	userID := uuid.NewString()
+	sessionID := uuid.NewString()
+	createdAt := time.Now().Add(-time.Hour).Unix()
+
+	legacy := `{"userID":"` + userID + `","createdAt":` + strconv.FormatInt(createdAt, 10) +
+		`,"ip":"203.0.113.7","userAgent":"browser","theme":"dark","number":42}`
+	require.NoError(t, store.Set(ctx, sessionID, []byte(legacy), 3600))
+	require.NoError(t, store.Set(ctx, "user_sessions:"+userID, []byte(`{"`+sessionID+`":true}`), 3600))
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+	require.NoError(t, err)
+	require.NotNil(t, sess, "Sessions stored as plain maps should stay readable")
+	assert.Equal(t, userID, sess.UserID)
+	assert.Equal(t, session.AuthLevelSingleFactor, sess.AuthLevel)
+	assert.Equal(t, createdAt, sess.CreatedAt.Unix())
+	assert.Equal(t, "203.0.113.7", sess.IP)
+	assert.Equal(t, map[string]string{"theme": "dark"}, sess.Values)
+
+	sessions, err := sm.ListUserSessions(ctx, userID, nil)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "browser", sessions[0].UserAgent)
+}
+
+func TestCodecs_UnknownData(t *testing.T) {
+	t.Parallel()
+
+	store := session.NewMemoryStore(context.Background(), 0)
+	sm := newCodecTestManager(store, "json")
+	sessionID := uuid.NewString()
+	require.NoError(t, store.Set(context.Background(), sessionID, []byte("x-garbage"), 3600))
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+	assert.Error(t, err)
+	assert.Nil(t, sess)
+
+	_, err = session.NewCodec("xml")
+	assert.Error(t, err)
+}
+
+func TestUpdateSession_Flashes(t *testing.T) {
+	t.Parallel()
+
+	store := session.NewMemoryStore(context.Background(), 0)
+	sm := newCodecTestManager(store, "gob")
+
+	sessionID, err := sm.CreateSession(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil),
+		&session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+
+	r := requestWithSession(t, sessionID)
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	sess.AddFlash("Password changed")
+	require.NoError(t, sm.UpdateSession(httptest.NewRecorder(), r, sess))
+
+	sess, err = sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Password changed"}, sess.PopFlashes())
+	require.NoError(t, sm.UpdateSession(httptest.NewRecorder(), r, sess))
+
+	sess, err = sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	assert.Empty(t, sess.PopFlashes(), "Flashes should be shown once")
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/pkg/security"
+)
+
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// Signs and optionally encrypts cookie values, so clients can neither forge
+// nor read them. Value is bound to cookie name, so it can't be moved to
+// another cookie. The first key of each kind is used for new cookies, the
+// rest are only accepted, which allows rotating keys without logging
+// everybody out.
+type CookieCodec struct {
+	signingKeys    [][]byte
+	encryptionKeys [][]byte
+}
+
+// Without encryption secrets values are only signed. Encryption keys are
+// derived from secrets, so secrets of any length may be used.
+func NewCookieCodec(signingSecrets, encryptionSecrets []string) *CookieCodec {
+	codec := &CookieCodec{}
+	for _, secret := range signingSecrets {
+		codec.signingKeys = append(codec.signingKeys, []byte(secret))
+	}
+	for _, secret := range encryptionSecrets {
+		key := sha256.Sum256([]byte(secret))
+		codec.encryptionKeys = append(codec.encryptionKeys, key[:])
+	}
+	return codec
+}
+
+// Cookies are signed with SessionSecret and, if CookiesSecret is set, encrypted
+// as well. Previous secrets are still accepted while rotating them.
+func newCookieCodec(options *config.SessionOptions) *CookieCodec {
+	signingSecrets := append([]string{options.SessionSecret}, options.PreviousSessionSecrets...)
+	var encryptionSecrets []string
+	if options.CookiesSecret != "" {
+		encryptionSecrets = append([]string{options.CookiesSecret}, options.PreviousCookiesSecrets...)
+	}
+	return NewCookieCodec(signingSecrets, encryptionSecrets)
+}
+
+// Returns value of cookie name in form of payload.signature.
+func (c *CookieCodec) Encode(name, value string) (string, error) {
+	if len(c.signingKeys) == 0 {
+		return "", errors.New("no cookie signing key configured")
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	if len(c.encryptionKeys) > 0 {
+		encrypted, err := security.Encrypt(c.encryptionKeys[0], value)
+		if err != nil {
+			return "", err
+		}
+		payload = encrypted
+	}
+
+	return payload + "." + c.sign(c.signingKeys[0], name, payload), nil
+}
+
+// Returns value Encode was called with, or ErrInvalidCookie if cookie was
+// tampered with or made with a key that is no longer known.
+func (c *CookieCodec) Decode(name, encoded string) (string, error) {
+	dot := strings.LastIndexByte(encoded, '.')
+	if dot < 0 {
+		return "", ErrInvalidCookie
+	}
+	payload, signature := encoded[:dot], encoded[dot+1:]
+
+	valid := false
+	for _, key := range c.signingKeys {
+		if hmac.Equal([]byte(signature), []byte(c.sign(key, name, payload))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrInvalidCookie
+	}
+
+	if len(c.encryptionKeys) == 0 {
+		value, err := base64.RawURLEncoding.DecodeString(payload)
+		if err != nil {
+			return "", ErrInvalidCookie
+		}
+		return string(value), nil
+	}
+
+	for _, key := range c.encryptionKeys {
+		if value, err := security.Decrypt(key, payload); err == nil {
+			return value, nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func (c *CookieCodec) sign(key []byte, name, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
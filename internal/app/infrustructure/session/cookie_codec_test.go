@@ -0,0 +1,87 @@
+package session_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieCodec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		encryptionSecrets []string
+	}{
+		{name: "signed"},
+		{name: "signed and encrypted", encryptionSecrets: []string{"encryption-secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := session.NewCookieCodec([]string{testSessionSecret}, tt.encryptionSecrets)
+
+			encoded, err := codec.Encode("session_id", "value")
+			require.NoError(t, err)
+
+			decoded, err := codec.Decode("session_id", encoded)
+			require.NoError(t, err)
+			assert.Equal(t, "value", decoded)
+
+			_, err = codec.Decode("other_cookie", encoded)
+			assert.ErrorIs(t, err, session.ErrInvalidCookie, "Value shouldn't be valid for another cookie")
+
+			tampered := []byte(encoded)
+			tampered[0] ^= 1
+			_, err = codec.Decode("session_id", string(tampered))
+			assert.ErrorIs(t, err, session.ErrInvalidCookie)
+
+			_, err = codec.Decode("session_id", "value")
+			assert.ErrorIs(t, err, session.ErrInvalidCookie)
+		})
+	}
+}
+
+func TestCookieCodec_Encrypts(t *testing.T) {
+	t.Parallel()
+
+	codec := session.NewCookieCodec([]string{testSessionSecret}, []string{"encryption-secret"})
+
+	first, err := codec.Encode("session_id", "value")
+	require.NoError(t, err)
+	second, err := codec.Encode("session_id", "value")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second, "Each encryption should use a fresh nonce")
+
+	// Signature is valid, but payload isn't readable without encryption key.
+	decoded, _ := session.NewCookieCodec([]string{testSessionSecret}, nil).Decode("session_id", first)
+	assert.NotEqual(t, "value", decoded)
+	assert.NotContains(t, first, base64.RawURLEncoding.EncodeToString([]byte("value")))
+}
+
+func TestCookieCodec_KeyRotation(t *testing.T) {
+	t.Parallel()
+
+	old := session.NewCookieCodec([]string{"old-signing-secret"}, []string{"old-encryption-secret"})
+	encoded, err := old.Encode("session_id", "value")
+	require.NoError(t, err)
+
+	rotated := session.NewCookieCodec([]string{"new-signing-secret", "old-signing-secret"},
+		[]string{"new-encryption-secret", "old-encryption-secret"})
+	decoded, err := rotated.Decode("session_id", encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "value", decoded, "Cookies made with previous keys should be accepted")
+
+	reencoded, err := rotated.Encode("session_id", "value")
+	require.NoError(t, err)
+	_, err = old.Decode("session_id", reencoded)
+	assert.ErrorIs(t, err, session.ErrInvalidCookie, "New cookies should be made with the first key")
+
+	retired := session.NewCookieCodec([]string{"new-signing-secret"}, []string{"new-encryption-secret"})
+	_, err = retired.Decode("session_id", encoded)
+	assert.ErrorIs(t, err, session.ErrInvalidCookie, "Cookies made with dropped keys should be rejected")
+}
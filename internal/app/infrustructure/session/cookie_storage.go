@@ -0,0 +1,324 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+)
+
+var (
+	ErrCookieStoreTooLarge  = errors.New("session data doesn't fit into cookies")
+	ErrCookieStoreNoRequest = errors.New("cookie session storage can only be written while handling a request")
+)
+
+const (
+	// Browsers accept cookies of about 4KB including name and attributes.
+	cookieStoreChunkSize = 3800
+	// Chunks allowed per client, browsers limit number of cookies per domain.
+	cookieStoreMaxChunks = 5
+)
+
+type httpExchangeKey struct{}
+
+type httpExchange struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+// Attaches request being handled to ctx, so CookieStore can read and write
+// its cookies. Other storages ignore it.
+func withHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	return context.WithValue(ctx, httpExchangeKey{}, &httpExchange{w: w, r: r})
+}
+
+type cookieStoreEntry struct {
+	Data      []byte `json:"d"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// Keeps all entries of a client in signed and encrypted cookies instead of
+// server-side storage. Data larger than a cookie is split into several
+// cookies named <name>_0, <name>_1, and so on.
+//
+// There is no server-side state, so only entries of the client whose request
+// is being handled are reachable: sessions can't be listed or revoked from
+// elsewhere and only end on logout or expiry. Attempts to do so give
+// ErrSessionRevocationUnsupported.
+type CookieStore struct {
+	name    string
+	codec   *CookieCodec
+	options *config.SessionOptions
+}
+
+// Data is signed with SessionSecret and encrypted with CookiesSecret, previous
+// secrets are accepted while rotating them.
+func NewCookieStore(options *config.SessionOptions) *CookieStore {
+	return &CookieStore{
+		name:    options.SessionName + "_store",
+		codec:   newCookieCodec(options),
+		options: options,
+	}
+}
+
+// Returns data stored under key by the client of request attached to ctx.
+// Without a request there is nothing to read from, so nil is returned.
+func (cs *CookieStore) Get(ctx context.Context, key string) ([]byte, error) {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.r == nil {
+		return nil, nil
+	}
+
+	entry, ok := cs.load(exchange)[key]
+	if !ok {
+		return nil, nil
+	}
+	return entry.Data, nil
+}
+
+func (cs *CookieStore) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.w == nil || exchange.r == nil {
+		return ErrCookieStoreNoRequest
+	}
+
+	entries := cs.load(exchange)
+	entries[key] = cookieStoreEntry{
+		Data:      data,
+		ExpiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second).Unix(),
+	}
+	return cs.save(exchange, entries)
+}
+
+// Without a request the key could only be held by some other client, which
+// can't be reached, so ErrSessionRevocationUnsupported is returned.
+func (cs *CookieStore) Delete(ctx context.Context, key string) error {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.w == nil || exchange.r == nil {
+		return ErrSessionRevocationUnsupported
+	}
+
+	entries := cs.load(exchange)
+	if _, ok := entries[key]; !ok {
+		return nil
+	}
+	delete(entries, key)
+	return cs.save(exchange, entries)
+}
+
+// Sets are kept as entries holding a JSON list of members, every add
+// extends entry's TTL.
+func (cs *CookieStore) AddToSet(ctx context.Context, key string, member string, ttlSeconds int) error {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.w == nil || exchange.r == nil {
+		return ErrCookieStoreNoRequest
+	}
+
+	entries := cs.load(exchange)
+	members := decodeCookieStoreSet(entries[key])
+	if !slices.Contains(members, member) {
+		members = append(members, member)
+	}
+	return cs.saveSet(exchange, entries, key, members, time.Now().Add(time.Duration(ttlSeconds)*time.Second).Unix())
+}
+
+// Without a request ErrSessionRevocationUnsupported is returned, as for Delete.
+func (cs *CookieStore) RemoveFromSet(ctx context.Context, key string, member string) error {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.w == nil || exchange.r == nil {
+		return ErrSessionRevocationUnsupported
+	}
+
+	entries := cs.load(exchange)
+	entry, ok := entries[key]
+	if !ok {
+		return nil
+	}
+	members := decodeCookieStoreSet(entry)
+	index := slices.Index(members, member)
+	if index < 0 {
+		return nil
+	}
+	return cs.saveSet(exchange, entries, key, slices.Delete(members, index, index+1), entry.ExpiresAt)
+}
+
+// Without a request the set is held by some other client, so
+// ErrSessionRevocationUnsupported is returned rather than an empty set.
+func (cs *CookieStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	exchange, ok := ctx.Value(httpExchangeKey{}).(*httpExchange)
+	if !ok || exchange.r == nil {
+		return nil, ErrSessionRevocationUnsupported
+	}
+
+	return decodeCookieStoreSet(cs.load(exchange)[key]), nil
+}
+
+func (cs *CookieStore) saveSet(exchange *httpExchange, entries map[string]cookieStoreEntry, key string, members []string, expiresAt int64) error {
+	if len(members) == 0 {
+		delete(entries, key)
+		return cs.save(exchange, entries)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return errors.New("failed to marshal json session set")
+	}
+	entries[key] = cookieStoreEntry{Data: data, ExpiresAt: expiresAt}
+	return cs.save(exchange, entries)
+}
+
+// Entries that aren't sets are treated as empty ones.
+func decodeCookieStoreSet(entry cookieStoreEntry) []string {
+	members := []string{}
+	if len(entry.Data) > 0 {
+		if err := json.Unmarshal(entry.Data, &members); err != nil {
+			return []string{}
+		}
+	}
+	return members
+}
+
+// Returns unexpired entries of the client. Cookies already set on the response
+// take precedence over the ones request came with, so writes made earlier
+// while handling the request are seen. Invalid data is treated as empty.
+func (cs *CookieStore) load(exchange *httpExchange) map[string]cookieStoreEntry {
+	chunks := cs.responseChunks(exchange.w)
+	if chunks == nil {
+		chunks = cs.requestChunks(exchange.r)
+	}
+
+	entries := make(map[string]cookieStoreEntry)
+	if len(chunks) == 0 {
+		return entries
+	}
+
+	data, err := cs.codec.Decode(cs.name, strings.Join(chunks, ""))
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return make(map[string]cookieStoreEntry)
+	}
+
+	now := time.Now().Unix()
+	for key, entry := range entries {
+		if entry.ExpiresAt <= now {
+			delete(entries, key)
+		}
+	}
+	return entries
+}
+
+// Replaces cookies set on the response with ones holding entries. Cookie
+// lives as long as the longest living entry.
+func (cs *CookieStore) save(exchange *httpExchange, entries map[string]cookieStoreEntry) error {
+	var chunks []string
+	maxAge := 0
+	if len(entries) > 0 {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return errors.New("failed to marshal json session data")
+		}
+		encoded, err := cs.codec.Encode(cs.name, string(data))
+		if err != nil {
+			return err
+		}
+
+		for len(encoded) > 0 {
+			size := min(cookieStoreChunkSize, len(encoded))
+			chunks = append(chunks, encoded[:size])
+			encoded = encoded[size:]
+		}
+		if len(chunks) > cookieStoreMaxChunks {
+			return ErrCookieStoreTooLarge
+		}
+
+		now := time.Now().Unix()
+		for _, entry := range entries {
+			maxAge = max(maxAge, int(entry.ExpiresAt-now))
+		}
+	}
+
+	cs.clearResponseChunks(exchange.w)
+	for i, chunk := range chunks {
+		cs.setChunk(exchange.w, i, chunk, maxAge)
+	}
+	// Chunks client holds beyond the new ones would be joined to them.
+	for i := len(chunks); i < len(cs.requestChunks(exchange.r)); i++ {
+		cs.setChunk(exchange.w, i, "", -1)
+	}
+
+	return nil
+}
+
+func (cs *CookieStore) chunkName(i int) string {
+	return fmt.Sprintf("%s_%d", cs.name, i)
+}
+
+func (cs *CookieStore) setChunk(w http.ResponseWriter, i int, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cs.chunkName(i),
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   cs.options.SessionSecure,
+		MaxAge:   maxAge,
+		Domain:   cs.options.SessionDomain,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (cs *CookieStore) requestChunks(r *http.Request) []string {
+	var chunks []string
+	for i := 0; ; i++ {
+		cookie, err := r.Cookie(cs.chunkName(i))
+		if err != nil || cookie.Value == "" {
+			return chunks
+		}
+		chunks = append(chunks, cookie.Value)
+	}
+}
+
+// Returns chunks set on the response so far, or nil if none were set.
+func (cs *CookieStore) responseChunks(w http.ResponseWriter) []string {
+	if w == nil {
+		return nil
+	}
+
+	set := make(map[string]string)
+	for _, line := range w.Header().Values("Set-Cookie") {
+		cookie, err := http.ParseSetCookie(line)
+		if err != nil || !strings.HasPrefix(cookie.Name, cs.name+"_") {
+			continue
+		}
+		if cookie.MaxAge < 0 {
+			cookie.Value = ""
+		}
+		set[cookie.Name] = cookie.Value
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	chunks := []string{}
+	for i := 0; set[cs.chunkName(i)] != ""; i++ {
+		chunks = append(chunks, set[cs.chunkName(i)])
+	}
+	return chunks
+}
+
+func (cs *CookieStore) clearResponseChunks(w http.ResponseWriter) {
+	lines := w.Header().Values("Set-Cookie")
+	w.Header().Del("Set-Cookie")
+	for _, line := range lines {
+		if !strings.HasPrefix(line, cs.name+"_") {
+			w.Header().Add("Set-Cookie", line)
+		}
+	}
+}
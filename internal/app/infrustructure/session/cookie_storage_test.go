@@ -0,0 +1,230 @@
+package session_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCookieStoreManager() *session.SessionManager {
+	options := &config.SessionOptions{
+		Storage:       "cookie",
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		CookiesSecret: "cookies-secret",
+		MaxAge:        3600,
+	}
+	return session.NewSessionManager(session.NewCookieStore(options), options)
+}
+
+// Returns request carrying cookies the browser would hold after receiving
+// response to previous request.
+func nextRequest(previous *http.Request, w *httptest.ResponseRecorder) *http.Request {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range previous.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(cookies, cookie.Name)
+			continue
+		}
+		cookies[cookie.Name] = cookie
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return r
+}
+
+func TestCookieStore_Session(t *testing.T) {
+	t.Parallel()
+
+	sm := newCookieStoreManager()
+	userID := uuid.NewString()
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, r, &session.Session{UserID: userID})
+	require.NoError(t, err)
+
+	for _, cookie := range w.Result().Cookies() {
+		assert.NotContains(t, cookie.Value, userID, "Session data should be encrypted")
+	}
+
+	r = nextRequest(r, w)
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.Equal(t, userID, sess.UserID)
+
+	w = httptest.NewRecorder()
+	_, err = sm.RotateSession(w, r)
+	require.NoError(t, err)
+
+	rotated := nextRequest(r, w)
+	sess, err = sm.GetSession(httptest.NewRecorder(), rotated)
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.Equal(t, userID, sess.UserID)
+
+	sess, err = sm.GetSession(httptest.NewRecorder(), nextRequest(rotated, httptest.NewRecorder()))
+	require.NoError(t, err)
+	assert.NotNil(t, sess)
+
+	w = httptest.NewRecorder()
+	require.NoError(t, sm.DestroySession(w, rotated))
+
+	sess, err = sm.GetSession(httptest.NewRecorder(), nextRequest(rotated, w))
+	require.NoError(t, err)
+	assert.Nil(t, sess)
+}
+
+func TestCookieStore_TransientSession(t *testing.T) {
+	t.Parallel()
+
+	sm := newCookieStoreManager()
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, r, &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	r = nextRequest(r, w)
+
+	w = httptest.NewRecorder()
+	require.NoError(t, sm.CreateTransientSession(w, r, "flow", map[string]string{"state": "value"}, 300))
+	r = nextRequest(r, w)
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	assert.NotNil(t, sess, "Session should survive writing transient session")
+
+	w = httptest.NewRecorder()
+	popped, err := sm.PopTransientSession(w, r, "flow")
+	require.NoError(t, err)
+	assert.Equal(t, "value", popped["state"])
+
+	popped, err = sm.PopTransientSession(httptest.NewRecorder(), nextRequest(r, w), "flow")
+	require.NoError(t, err)
+	assert.Nil(t, popped)
+}
+
+func TestCookieStore_Chunking(t *testing.T) {
+	t.Parallel()
+
+	sm := newCookieStoreManager()
+	large := strings.Repeat("a", 6000)
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, r, &session.Session{Values: map[string]string{"large": large}})
+	require.NoError(t, err)
+
+	chunks := 0
+	for _, cookie := range w.Result().Cookies() {
+		if strings.HasPrefix(cookie.Name, "session_id_store_") {
+			chunks++
+			assert.Less(t, len(cookie.String()), 4096)
+		}
+	}
+	assert.Greater(t, chunks, 1, "Large data should be split across cookies")
+
+	r = nextRequest(r, w)
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.Equal(t, large, sess.Values["large"])
+
+	// Logging in again leaves less data, stale chunks have to be removed.
+	w = httptest.NewRecorder()
+	_, err = sm.CreateSession(w, r, &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+
+	sess, err = sm.GetSession(httptest.NewRecorder(), nextRequest(r, w))
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.NotContains(t, sess.Values, "large")
+}
+
+func TestCookieStore_Limits(t *testing.T) {
+	t.Parallel()
+
+	options := &config.SessionOptions{SessionName: "session_id", SessionSecret: testSessionSecret, CookiesSecret: "cookies-secret"}
+	store := session.NewCookieStore(options)
+
+	err := store.Set(context.Background(), "key", []byte("value"), 60)
+	assert.ErrorIs(t, err, session.ErrCookieStoreNoRequest)
+
+	data, err := store.Get(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	sm := session.NewSessionManager(store, options)
+	_, err = sm.CreateSession(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil), &session.Session{
+		Values: map[string]string{"large": strings.Repeat("a", 20000)},
+	})
+	assert.Error(t, err, "Data not fitting into cookies should be refused")
+}
+
+func TestCookieStore_Tampered(t *testing.T) {
+	t.Parallel()
+
+	sm := newCookieStoreManager()
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, r, &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+
+	tampered := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range nextRequest(r, w).Cookies() {
+		if strings.HasPrefix(cookie.Name, "session_id_store_") {
+			value := []byte(cookie.Value)
+			value[0] ^= 1
+			cookie.Value = string(value)
+		}
+		tampered.AddCookie(cookie)
+	}
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), tampered)
+	require.NoError(t, err)
+	assert.Nil(t, sess)
+}
+
+func TestCookieStore_RevocationUnsupported(t *testing.T) {
+	t.Parallel()
+
+	sm := newCookieStoreManager()
+	userID := uuid.NewString()
+	ctx := context.Background()
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, r, &session.Session{UserID: userID})
+	require.NoError(t, err)
+
+	assert.False(t, sm.CanRevokeSessions())
+
+	err = sm.DestroyUserSessions(ctx, userID)
+	assert.ErrorIs(t, err, session.ErrSessionRevocationUnsupported, "Revocation shouldn't silently do nothing")
+
+	err = sm.DestroyOtherUserSessions(ctx, userID, nextRequest(r, w))
+	assert.ErrorIs(t, err, session.ErrSessionRevocationUnsupported)
+
+	_, err = sm.ListUserSessions(ctx, userID, nil)
+	assert.ErrorIs(t, err, session.ErrSessionRevocationUnsupported)
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), nextRequest(r, w))
+	require.NoError(t, err)
+	assert.NotNil(t, sess, "Own session should still be usable")
+}
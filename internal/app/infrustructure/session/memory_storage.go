@@ -0,0 +1,163 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// Keeps sessions in process memory, so they are lost on restart and aren't
+// shared between instances. Meant for single node deployments and tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	// Expiry of each member of each set.
+	sets map[string]map[string]time.Time
+}
+
+// Starts a janitor evicting expired entries every janitorInterval until ctx
+// is done. Expired entries are never returned, janitor only frees memory.
+func NewMemoryStore(ctx context.Context, janitorInterval time.Duration) *MemoryStore {
+	ms := &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		sets:    make(map[string]map[string]time.Time),
+	}
+
+	if janitorInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(janitorInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					ms.PurgeExpired()
+				}
+			}
+		}()
+	}
+
+	return ms
+}
+
+// Returned data is a copy, so callers can't change stored one.
+func (ms *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	entry, ok := ms.entries[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+
+	return append([]byte(nil), entry.data...), nil
+}
+
+func (ms *MemoryStore) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.entries[key] = memoryEntry{
+		data:      append([]byte(nil), data...),
+		expiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second),
+	}
+	return nil
+}
+
+func (ms *MemoryStore) Delete(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.entries, key)
+	delete(ms.sets, key)
+	return nil
+}
+
+func (ms *MemoryStore) AddToSet(ctx context.Context, key string, member string, ttlSeconds int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	members, ok := ms.sets[key]
+	if !ok {
+		members = make(map[string]time.Time)
+		ms.sets[key] = members
+	}
+	members[member] = time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+	return nil
+}
+
+func (ms *MemoryStore) RemoveFromSet(ctx context.Context, key string, member string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	members, ok := ms.sets[key]
+	if !ok {
+		return nil
+	}
+	delete(members, member)
+	if len(members) == 0 {
+		delete(ms.sets, key)
+	}
+	return nil
+}
+
+func (ms *MemoryStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]string, 0, len(ms.sets[key]))
+	for member, expiresAt := range ms.sets[key] {
+		if now.Before(expiresAt) {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+// Evicts expired entries and returns number of evicted ones.
+func (ms *MemoryStore) PurgeExpired() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	purged := 0
+	for key, entry := range ms.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(ms.entries, key)
+			purged++
+		}
+	}
+	for key, members := range ms.sets {
+		for member, expiresAt := range members {
+			if !now.Before(expiresAt) {
+				delete(members, member)
+				purged++
+			}
+		}
+		if len(members) == 0 {
+			delete(ms.sets, key)
+		}
+	}
+	return purged
+}
+
+// Returns number of stored entries and set members, including expired ones
+// not evicted yet.
+func (ms *MemoryStore) Len() int {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	count := len(ms.entries)
+	for _, members := range ms.sets {
+		count += len(members)
+	}
+	return count
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Keeps sessions in sessions table and set members in session_set_members
+// table. Expired rows are never returned, but stay until PurgeExpired is
+// called.
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		db: db,
+	}
+}
+
+func (ps *PostgresStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+
+	query := "SELECT data FROM sessions WHERE key = $1 AND expires_at > $2"
+	err := ps.db.QueryRow(ctx, query, key, time.Now().UTC()).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching session: %w", err)
+	}
+
+	return data, nil
+}
+
+func (ps *PostgresStore) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
+	query := `INSERT INTO sessions (key, data, expires_at) VALUES ($1, $2, $3)
+			  ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at`
+	expiresAt := time.Now().UTC().Add(time.Duration(ttlSeconds) * time.Second)
+	if _, err := ps.db.Exec(ctx, query, key, data, expiresAt); err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+
+	return nil
+}
+
+func (ps *PostgresStore) Delete(ctx context.Context, key string) error {
+	if _, err := ps.db.Exec(ctx, "DELETE FROM sessions WHERE key = $1", key); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	if _, err := ps.db.Exec(ctx, "DELETE FROM session_set_members WHERE key = $1", key); err != nil {
+		return fmt.Errorf("error deleting session set: %w", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) AddToSet(ctx context.Context, key string, member string, ttlSeconds int) error {
+	query := `INSERT INTO session_set_members (key, member, expires_at) VALUES ($1, $2, $3)
+			  ON CONFLICT (key, member) DO UPDATE SET expires_at = EXCLUDED.expires_at`
+	expiresAt := time.Now().UTC().Add(time.Duration(ttlSeconds) * time.Second)
+	if _, err := ps.db.Exec(ctx, query, key, member, expiresAt); err != nil {
+		return fmt.Errorf("error adding session set member: %w", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) RemoveFromSet(ctx context.Context, key string, member string) error {
+	query := "DELETE FROM session_set_members WHERE key = $1 AND member = $2"
+	if _, err := ps.db.Exec(ctx, query, key, member); err != nil {
+		return fmt.Errorf("error removing session set member: %w", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	query := "SELECT member FROM session_set_members WHERE key = $1 AND expires_at > $2"
+	rows, err := ps.db.Query(ctx, query, key, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching session set: %w", err)
+	}
+	defer rows.Close()
+
+	members := []string{}
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, fmt.Errorf("error scanning session set member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching session set: %w", err)
+	}
+
+	return members, nil
+}
+
+// Deletes sessions and set members expired by now and returns number of
+// deleted ones.
+func (ps *PostgresStore) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := ps.db.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired sessions: %w", err)
+	}
+	setTag, err := ps.db.Exec(ctx, "DELETE FROM session_set_members WHERE expires_at <= $1", now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired session set members: %w", err)
+	}
+	return tag.RowsAffected() + setTag.RowsAffected(), nil
+}
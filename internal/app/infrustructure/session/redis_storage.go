@@ -2,8 +2,6 @@ package session
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -19,31 +17,39 @@ func NewRedisStore(client redis.Cmdable) *RedisStore {
 	}
 }
 
-func (rs *RedisStore) Get(ctx context.Context, key string) (map[string]interface{}, error) {
-	data, err := rs.client.Get(ctx, key).Result()
+func (rs *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := rs.client.Get(ctx, key).Bytes()
 	if err == redis.Nil {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
 
-	var values map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &values); err != nil {
-		return nil, errors.New("failed to unmarshal json session data")
-	}
-
-	return values, nil
+	return data, nil
 }
 
-func (rs *RedisStore) Set(ctx context.Context, key string, value map[string]interface{}, ttlSeconds int) error {
-	data, err := json.Marshal(value)
-	if err != nil {
-		return errors.New("failed to marshal json session data")
-	}
-
+func (rs *RedisStore) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
 	return rs.client.Set(ctx, key, data, time.Duration(ttlSeconds)*time.Second).Err()
 }
 
 func (rs *RedisStore) Delete(ctx context.Context, key string) error {
 	return rs.client.Del(ctx, key).Err()
 }
+
+// Redis expires whole sets, not members, so every add extends set's TTL.
+func (rs *RedisStore) AddToSet(ctx context.Context, key string, member string, ttlSeconds int) error {
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, member)
+		pipe.Expire(ctx, key, time.Duration(ttlSeconds)*time.Second)
+		return nil
+	})
+	return err
+}
+
+func (rs *RedisStore) RemoveFromSet(ctx context.Context, key string, member string) error {
+	return rs.client.SRem(ctx, key, member).Err()
+}
+
+func (rs *RedisStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return rs.client.SMembers(ctx, key).Result()
+}
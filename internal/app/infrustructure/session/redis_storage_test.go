@@ -2,7 +2,6 @@ package session_test
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"testing"
 	"time"
@@ -25,17 +24,16 @@ func TestRedisStore_Get_Success(t *testing.T) {
 	mockClient := mock.NewMockCmdable(ctrl)
 	ctx := context.Background()
 	key := "test_session"
-	expectedValues := map[string]interface{}{"key": "value"}
+	expectedData := []byte(`j{"key":"value"}`)
 
-	data, _ := json.Marshal(expectedValues)
-	mockClient.EXPECT().Get(ctx, key).Return(redis.NewStringResult(string(data), nil))
+	mockClient.EXPECT().Get(ctx, key).Return(redis.NewStringResult(string(expectedData), nil))
 
 	store := session.NewRedisStore(mockClient)
 
-	values, err := store.Get(ctx, key)
+	data, err := store.Get(ctx, key)
 
 	assert.NoError(t, err)
-	assert.Equal(t, expectedValues, values)
+	assert.Equal(t, expectedData, data)
 }
 
 func TestRedisStore_Get_NotFound(t *testing.T) {
@@ -85,37 +83,17 @@ func TestRedisStore_Set_Success(t *testing.T) {
 	ctx := context.Background()
 	key := "test_session"
 	ttlSeconds := 60
-	values := map[string]interface{}{"key": "value"}
+	data := []byte(`j{"key":"value"}`)
 
-	data, _ := json.Marshal(values)
 	mockClient.EXPECT().Set(ctx, key, data, time.Duration(ttlSeconds)*time.Second).Return(redis.NewStatusResult("", nil))
 
 	store := session.NewRedisStore(mockClient)
 
-	err := store.Set(ctx, key, values, ttlSeconds)
+	err := store.Set(ctx, key, data, ttlSeconds)
 
 	assert.NoError(t, err)
 }
 
-func TestRedisStore_Set_MarshalError(t *testing.T) {
-	t.Parallel()
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockClient := mock.NewMockCmdable(ctrl)
-	ctx := context.Background()
-	key := "test_session"
-	ttlSeconds := 60
-	values := map[string]interface{}{"key": make(chan int)}
-
-	store := session.NewRedisStore(mockClient)
-
-	err := store.Set(ctx, key, values, ttlSeconds)
-
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to marshal json session data")
-}
-
 func TestRedisStore_Set_RedisError(t *testing.T) {
 	t.Parallel()
 	ctrl := gomock.NewController(t)
@@ -125,14 +103,13 @@ func TestRedisStore_Set_RedisError(t *testing.T) {
 	ctx := context.Background()
 	key := "test_session"
 	ttlSeconds := 60
-	values := map[string]interface{}{"key": "value"}
+	data := []byte(`j{"key":"value"}`)
 
-	data, _ := json.Marshal(values)
 	mockClient.EXPECT().Set(ctx, key, data, time.Duration(ttlSeconds)*time.Second).Return(redis.NewStatusResult("", errors.New("redis error")))
 
 	store := session.NewRedisStore(mockClient)
 
-	err := store.Set(ctx, key, values, ttlSeconds)
+	err := store.Set(ctx, key, data, ttlSeconds)
 
 	assert.Error(t, err)
 }
@@ -187,10 +164,7 @@ func TestRedisStore(t *testing.T) {
 		rs := session.NewRedisStore(client)
 
 		key := "test-key"
-		value := map[string]interface{}{
-			"field1": "value1",
-			"field2": float64(42),
-		}
+		value := []byte(`j{"field1":"value1","field2":42}`)
 
 		err := rs.Set(ctx, key, value, 60)
 		require.NoError(t, err)
@@ -222,9 +196,7 @@ func TestRedisStore(t *testing.T) {
 		rs := session.NewRedisStore(client)
 
 		key := "key-to-delete"
-		value := map[string]interface{}{
-			"field": "to-delete",
-		}
+		value := []byte("to-delete")
 
 		err := rs.Set(ctx, key, value, 60)
 		require.NoError(t, err)
@@ -245,9 +217,7 @@ func TestRedisStore(t *testing.T) {
 		rs := session.NewRedisStore(client)
 
 		key := "expiring-key"
-		value := map[string]interface{}{
-			"field": "expires",
-		}
+		value := []byte("expires")
 
 		err := rs.Set(ctx, key, value, 2)
 		require.NoError(t, err)
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"time"
+)
+
+// How strongly the user proved identity when session was started.
+type AuthLevel int
+
+const (
+	// Session isn't authenticated, e.g. transient session of a login flow.
+	AuthLevelNone AuthLevel = iota
+	// Password or a third party provider.
+	AuthLevelSingleFactor
+	// Password with second factor, or a passkey.
+	AuthLevelMultiFactor
+)
+
+type Session struct {
+	// ID is the storage key and is filled in on load, it isn't a part of
+	// stored data.
+	ID         string
+	UserID     string
+	AuthLevel  AuthLevel
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+	IP         string
+	UserAgent  string
+	// Messages shown to the user once on the next page.
+	Flashes []string
+	// Arbitrary data of features built on top of sessions.
+	Values map[string]string
+}
+
+func (s *Session) AddFlash(message string) {
+	s.Flashes = append(s.Flashes, message)
+}
+
+// Returns flash messages and removes them from session. Session has to be
+// saved for them to be gone for good.
+func (s *Session) PopFlashes() []string {
+	flashes := s.Flashes
+	s.Flashes = nil
+	return flashes
+}
+
+// Reads session stored as a plain map before sessions were typed. Extras of
+// other types than string were never stored, so they are dropped.
+func (s *Session) fromLegacy(values map[string]interface{}) {
+	s.UserID, _ = values["userID"].(string)
+	if s.UserID != "" {
+		s.AuthLevel = AuthLevelSingleFactor
+	}
+	s.CreatedAt, _ = timeValue(values, "createdAt")
+	s.ExpiresAt, _ = timeValue(values, "expiresAt")
+	s.IP, _ = values["ip"].(string)
+	s.UserAgent, _ = values["userAgent"].(string)
+
+	for key, value := range values {
+		switch key {
+		case "userID", "createdAt", "expiresAt", "ip", "userAgent":
+			continue
+		}
+		if str, ok := value.(string); ok {
+			if s.Values == nil {
+				s.Values = make(map[string]string)
+			}
+			s.Values[key] = str
+		}
+	}
+}
+
+// Time of the last request made with a session. Kept apart from the session,
+// so recording activity can't bring back a session destroyed meanwhile.
+type sessionActivity struct {
+	LastSeenAt time.Time
+}
+
+func (a *sessionActivity) fromLegacy(values map[string]interface{}) {
+	a.LastSeenAt, _ = timeValue(values, "lastSeenAt")
+}
+
+// IDs of all sessions started by a user, as stored by earlier versions
+// before the index was kept in a storage set.
+type userSessionIndex struct {
+	SessionIDs map[string]bool
+}
+
+func (i *userSessionIndex) fromLegacy(values map[string]interface{}) {
+	i.SessionIDs = make(map[string]bool, len(values))
+	for sessionID := range values {
+		i.SessionIDs[sessionID] = true
+	}
+}
+
+// Reads unix time stored in legacy values. Numbers come back from JSON as float64.
+func timeValue(values map[string]interface{}, key string) (time.Time, bool) {
+	switch v := values[key].(type) {
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case float64:
+		return time.Unix(int64(v), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
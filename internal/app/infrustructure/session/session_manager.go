@@ -2,79 +2,682 @@ package session
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"log/slog"
 	"net/http"
+	"sort"
+	"time"
 
+	"github.com/Mixturka/vm-hub/internal/app/application/dtos"
 	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
 	"github.com/Mixturka/vm-hub/internal/app/config"
+	"github.com/Mixturka/vm-hub/pkg/putils"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// Storage keeps sessions on the client, so sessions other than the one
+	// request is made with can't be listed or revoked.
+	ErrSessionRevocationUnsupported = errors.New("sessions can't be revoked with client-side session storage")
+)
+
+const (
+	// Prefix of storage sets holding IDs of all sessions started by a user.
+	userSessionSetPrefix = "user_session_set:"
+	// Prefix of storage keys holding IDs of user's sessions as a single
+	// entry, as written by earlier versions.
+	userSessionsPrefix = "user_sessions:"
+	// Prefix of storage keys holding time of the last request made with a
+	// session.
+	sessionActivityPrefix = "session_activity:"
+)
+
+// Longer user agents are cut, the value is only shown to the user.
+const maxUserAgentLength = 256
+
+// Last seen time is only shown in the list of user's sessions, so it's
+// stored at most once per interval rather than on every request.
+const activityWriteInterval = time.Minute
+
+type requestSessionKey struct{}
+
+// Session of the request being handled, set up by Middleware. Handlers run on
+// a single goroutine per request, so it isn't guarded.
+type requestSession struct {
+	loaded bool
+	sess   *Session
+}
+
+func requestSessionFromContext(ctx context.Context) *requestSession {
+	cached, _ := ctx.Value(requestSessionKey{}).(*requestSession)
+	return cached
+}
+
+// Remembers sess as the session of the request. No-op outside Middleware.
+func (rs *requestSession) set(sess *Session) {
+	if rs == nil {
+		return
+	}
+	rs.loaded = true
+	rs.sess = sess
+}
+
 type SessionManager struct {
 	storage interfaces.SessionStorage
 	options *config.SessionOptions
+	cookies *CookieCodec
+	codec   Codec
 }
 
+// Data is written with codec configured by SESSION_CODEC, but data of any
+// known codec is read, so codec can be switched without logging users out.
 func NewSessionManager(storage interfaces.SessionStorage, options *config.SessionOptions) *SessionManager {
+	codec, err := NewCodec(options.Codec)
+	if err != nil {
+		slog.Warn("Falling back to json session codec", "error", err)
+		codec = JSONCodec{}
+	}
+
 	return &SessionManager{
 		storage: storage,
 		options: options,
+		cookies: newCookieCodec(options),
+		codec:   codec,
+	}
+}
+
+// Starts a new session. Its ID, creation and expiry time, client's IP and user
+// agent are filled in, the latter are shown in the list of user's sessions.
+// Session the request was made with, if any, is destroyed, so ID known before
+// login (e.g. planted by an attacker) never becomes authenticated.
+func (sm *SessionManager) CreateSession(w http.ResponseWriter, r *http.Request, sess *Session) (string, error) {
+	ctx := withHTTP(context.Background(), w, r)
+	if previousID := sm.cookieValue(r, sm.options.SessionName); previousID != "" {
+		if err := sm.discardSession(ctx, previousID); err != nil {
+			return "", err
+		}
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+	sess.ID = uuid.NewString()
+	sess.CreatedAt = now
+	sess.ExpiresAt = now.Add(time.Duration(sm.options.MaxAge) * time.Second)
+	sess.LastSeenAt = now
+	sess.IP = putils.ClientIP(r)
+	sess.UserAgent = userAgent
+
+	if err := sm.save(ctx, sess.ID, sess, sm.options.MaxAge); err != nil {
+		return "", errors.New("failed to save session")
+	}
+
+	if sess.UserID != "" {
+		if err := sm.addUserSession(ctx, sess.UserID, sess.ID); err != nil {
+			return "", err
+		}
+	}
+
+	if err := sm.setSessionCookie(w, sess.ID, sm.options.MaxAge); err != nil {
+		return "", err
+	}
+	requestSessionFromContext(r.Context()).set(sess)
+	return sess.ID, nil
+}
+
+// Returns the session request is made with or nil if there is no such session.
+// Cookies with invalid signature are treated as missing without touching
+// storage. With sliding expiration enabled, session close to expiry is
+// extended. Behind Middleware session is loaded once per request and the same
+// one is returned to every caller.
+func (sm *SessionManager) GetSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	cached := requestSessionFromContext(r.Context())
+	if cached != nil && cached.loaded {
+		return cached.sess, nil
+	}
+
+	sess, err := sm.loadSession(w, r)
+	if err != nil {
+		return nil, err
+	}
+	cached.set(sess)
+	return sess, nil
+}
+
+func (sm *SessionManager) loadSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	sessionID := sm.cookieValue(r, sm.options.SessionName)
+	if sessionID == "" {
+		return nil, nil
+	}
+
+	ctx := withHTTP(context.Background(), w, r)
+	sess, err := sm.getSession(ctx, sessionID)
+	if err != nil || sess == nil {
+		return nil, err
+	}
+
+	if sm.options.SlidingExpiration {
+		sm.slideExpiry(ctx, w, sess)
 	}
+	sm.recordActivity(ctx, sess)
+	return sess, nil
+}
+
+// Keeps the session loaded by GetSession in request context, so middlewares
+// and handlers of one request don't each hit storage for it.
+func (sm *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestSessionKey{}, &requestSession{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
-func (sm *SessionManager) CreateSession(w http.ResponseWriter, values map[string]interface{}) (string, error) {
-	sessionID := uuid.NewString()
-	err := sm.storage.Set(context.Background(), sessionID, values, sm.options.MaxAge)
+// Stores changes made to session returned by GetSession, e.g. added flash
+// messages. Session expiry is kept.
+func (sm *SessionManager) UpdateSession(w http.ResponseWriter, r *http.Request, sess *Session) error {
+	ttl := sm.remainingTTL(sess)
+	if ttl <= 0 {
+		return ErrSessionNotFound
+	}
+
+	if err := sm.save(withHTTP(context.Background(), w, r), sess.ID, sess, ttl); err != nil {
+		return errors.New("failed to save session")
+	}
+	return nil
+}
+
+// Issues new ID for the session request is made with, keeping its data and
+// expiry, and destroys the old one. Used when session gains or changes
+// privileges, e.g. after password change.
+func (sm *SessionManager) RotateSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	ctx := withHTTP(context.Background(), w, r)
+	oldID := sm.cookieValue(r, sm.options.SessionName)
+	if oldID == "" {
+		return "", ErrSessionNotFound
+	}
+
+	sess, err := sm.getSession(ctx, oldID)
 	if err != nil {
+		return "", err
+	}
+	if sess == nil {
+		return "", ErrSessionNotFound
+	}
+
+	ttl := sm.remainingTTL(sess)
+	if ttl <= 0 {
+		return "", ErrSessionNotFound
+	}
+
+	sess.ID = uuid.NewString()
+	if err := sm.save(ctx, sess.ID, sess, ttl); err != nil {
 		return "", errors.New("failed to save session")
 	}
+	if sess.UserID != "" {
+		if err := sm.addUserSession(ctx, sess.UserID, sess.ID); err != nil {
+			return "", err
+		}
+	}
+	if err := sm.discardSession(ctx, oldID); err != nil {
+		return "", err
+	}
+
+	if err := sm.setSessionCookie(w, sess.ID, ttl); err != nil {
+		return "", err
+	}
+	requestSessionFromContext(r.Context()).set(sess)
+	return sess.ID, nil
+}
+
+// Extends session by MaxAge once less than RefreshThreshold of it is left,
+// up to MaxLifetime since it was created. Sessions created before expiry was
+// tracked are left as they are. Failure is logged only, session is still valid.
+func (sm *SessionManager) slideExpiry(ctx context.Context, w http.ResponseWriter, sess *Session) {
+	if sess.CreatedAt.IsZero() || sess.ExpiresAt.IsZero() ||
+		time.Until(sess.ExpiresAt) >= time.Duration(sm.options.RefreshThreshold)*time.Second {
+		return
+	}
+
+	newExpiresAt := time.Now().Add(time.Duration(sm.options.MaxAge) * time.Second)
+	if deadline := sess.CreatedAt.Add(time.Duration(sm.options.MaxLifetime) * time.Second); newExpiresAt.After(deadline) {
+		newExpiresAt = deadline
+	}
+	ttl := int(time.Until(newExpiresAt).Seconds())
+	if !newExpiresAt.After(sess.ExpiresAt) || ttl <= 0 {
+		return
+	}
+
+	previousExpiresAt := sess.ExpiresAt
+	sess.ExpiresAt = newExpiresAt
+	if err := sm.save(ctx, sess.ID, sess, ttl); err != nil {
+		slog.Warn("Failed to extend session", "error", err)
+		sess.ExpiresAt = previousExpiresAt
+		return
+	}
+	if err := sm.setSessionCookie(w, sess.ID, ttl); err != nil {
+		slog.Warn("Failed to extend session cookie", "error", err)
+	}
+}
+
+// Stores time of the request for session listing, unless the stored one is
+// younger than activityWriteInterval. It's kept apart from the session, so it
+// can't bring back a session destroyed meanwhile. Failure only makes the
+// listing less accurate, so it's logged and otherwise ignored.
+func (sm *SessionManager) recordActivity(ctx context.Context, sess *Session) {
+	ttl := sm.remainingTTL(sess)
+	if sess.ExpiresAt.IsZero() || ttl <= 0 {
+		return
+	}
+
+	var stored sessionActivity
+	found, err := sm.load(ctx, sessionActivityPrefix+sess.ID, &stored)
+	if err != nil {
+		slog.Warn("Failed to get session activity", "error", err)
+	}
+	if found && stored.LastSeenAt.After(sess.LastSeenAt) {
+		sess.LastSeenAt = stored.LastSeenAt
+	}
+	if time.Since(sess.LastSeenAt) < activityWriteInterval {
+		return
+	}
+
+	sess.LastSeenAt = time.Now()
+	activity := &sessionActivity{LastSeenAt: sess.LastSeenAt}
+	if err := sm.save(ctx, sessionActivityPrefix+sess.ID, activity, ttl); err != nil {
+		slog.Warn("Failed to record session activity", "error", err)
+	}
+}
+
+func (sm *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) error {
+	sessionID := sm.cookieValue(r, sm.options.SessionName)
+	if sessionID == "" {
+		return nil
+	}
+
+	if err := sm.discardSession(withHTTP(context.Background(), w, r), sessionID); err != nil {
+		return err
+	}
+	requestSessionFromContext(r.Context()).set(nil)
+
+	return sm.setSessionCookie(w, "", -1)
+}
+
+// Destroys every session of the user, e.g. after password was changed.
+func (sm *SessionManager) DestroyUserSessions(ctx context.Context, userID string) error {
+	sessionIDs, err := sm.getUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := sm.deleteSession(ctx, sessionID); err != nil {
+			return err
+		}
+		if err := sm.removeUserSession(ctx, userID, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Destroys every session of the user except the one request is made with,
+// i.e. logs the user out of other devices.
+func (sm *SessionManager) DestroyOtherUserSessions(ctx context.Context, userID string, r *http.Request) error {
+	currentID := sm.cookieValue(r, sm.options.SessionName)
+
+	sessionIDs, err := sm.getUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if sessionID == currentID {
+			continue
+		}
+		if err := sm.deleteSession(ctx, sessionID); err != nil {
+			return err
+		}
+		if err := sm.removeUserSession(ctx, userID, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Destroys user's session with the given public ID as returned by ListUserSessions.
+func (sm *SessionManager) DestroyUserSession(ctx context.Context, userID string, id string) error {
+	sessionIDs, err := sm.getUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if publicSessionID(sessionID) != id {
+			continue
+		}
+		if err := sm.deleteSession(ctx, sessionID); err != nil {
+			return err
+		}
+		return sm.removeUserSession(ctx, userID, sessionID)
+	}
+
+	return ErrSessionNotFound
+}
+
+// Returns active sessions of the user, most recently used first. If r is
+// given, the session it's made with is marked as current. Entries of expired
+// sessions are dropped from the index on the way.
+func (sm *SessionManager) ListUserSessions(ctx context.Context, userID string, r *http.Request) ([]dtos.SessionDto, error) {
+	currentID := ""
+	if r != nil {
+		currentID = sm.cookieValue(r, sm.options.SessionName)
+	}
+
+	sessionIDs, err := sm.getUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []dtos.SessionDto{}
+	for _, sessionID := range sessionIDs {
+		sess, err := sm.getSession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if sess == nil {
+			if err := sm.removeUserSession(ctx, userID, sessionID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		lastSeenAt := sess.CreatedAt
+		var activity sessionActivity
+		found, err := sm.load(ctx, sessionActivityPrefix+sessionID, &activity)
+		if err != nil {
+			return nil, errors.New("failed to get session activity")
+		}
+		if found && !activity.LastSeenAt.IsZero() {
+			lastSeenAt = activity.LastSeenAt
+		}
+
+		sessions = append(sessions, dtos.SessionDto{
+			ID:         publicSessionID(sessionID),
+			CreatedAt:  sess.CreatedAt.UTC(),
+			LastSeenAt: lastSeenAt.UTC(),
+			IP:         sess.IP,
+			UserAgent:  sess.UserAgent,
+			Current:    sessionID == currentID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// Returns session stored under sessionID or nil if there is no such session.
+func (sm *SessionManager) getSession(ctx context.Context, sessionID string) (*Session, error) {
+	sess := &Session{}
+	found, err := sm.load(ctx, sessionID, sess)
+	if err != nil {
+		return nil, errors.New("failed to get session")
+	}
+	if !found {
+		return nil, nil
+	}
+
+	sess.ID = sessionID
+	return sess, nil
+}
+
+// Returns IDs of user's sessions. Index written by earlier versions as a
+// single entry is moved into the set on the way.
+func (sm *SessionManager) getUserSessions(ctx context.Context, userID string) ([]string, error) {
+	legacy := &userSessionIndex{}
+	found, err := sm.load(ctx, userSessionsPrefix+userID, legacy)
+	if err != nil {
+		return nil, errors.New("failed to get user sessions")
+	}
+	if found {
+		for sessionID := range legacy.SessionIDs {
+			if err := sm.addUserSession(ctx, userID, sessionID); err != nil {
+				return nil, err
+			}
+		}
+		if err := sm.storage.Delete(ctx, userSessionsPrefix+userID); err != nil {
+			return nil, storageError(err, "failed to delete user sessions")
+		}
+	}
+
+	sessionIDs, err := sm.storage.SetMembers(ctx, userSessionSetPrefix+userID)
+	if err != nil {
+		return nil, storageError(err, "failed to get user sessions")
+	}
+	return sessionIDs, nil
+}
+
+// Decodes data stored under key into v. Returns false if there is no such key.
+func (sm *SessionManager) load(ctx context.Context, key string, v legacyEntry) (bool, error) {
+	data, err := sm.storage.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+
+	if err := decode(data, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (sm *SessionManager) save(ctx context.Context, key string, v interface{}, ttlSeconds int) error {
+	data, err := encode(sm.codec, v)
+	if err != nil {
+		return err
+	}
+	return sm.storage.Set(ctx, key, data, ttlSeconds)
+}
+
+// Seconds left until session expires. Sessions created before expiry was
+// tracked are given MaxAge.
+func (sm *SessionManager) remainingTTL(sess *Session) int {
+	if sess.ExpiresAt.IsZero() {
+		return sm.options.MaxAge
+	}
+	return int(time.Until(sess.ExpiresAt).Seconds())
+}
+
+// Deletes session and removes it from its user's index.
+func (sm *SessionManager) discardSession(ctx context.Context, sessionID string) error {
+	sess, err := sm.getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := sm.deleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if sess != nil && sess.UserID != "" {
+		return sm.removeUserSession(ctx, sess.UserID, sessionID)
+	}
+	return nil
+}
+
+// Sets session cookie holding signed session ID. Empty ID clears the cookie.
+func (sm *SessionManager) setSessionCookie(w http.ResponseWriter, sessionID string, maxAge int) error {
+	value := ""
+	if sessionID != "" {
+		var err error
+		value, err = sm.cookies.Encode(sm.options.SessionName, sessionID)
+		if err != nil {
+			return errors.New("failed to sign session cookie")
+		}
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     sm.options.SessionName,
-		Value:    sessionID,
+		Value:    value,
 		Path:     "/",
 		HttpOnly: sm.options.SessionHttpOnly,
 		Secure:   sm.options.SessionSecure,
-		MaxAge:   sm.options.MaxAge,
+		MaxAge:   maxAge,
 		Domain:   sm.options.SessionDomain,
 	})
+	return nil
+}
 
-	return sessionID, nil
+func (sm *SessionManager) deleteSession(ctx context.Context, sessionID string) error {
+	if err := sm.storage.Delete(ctx, sessionID); err != nil {
+		return storageError(err, "failed to delete session")
+	}
+	if err := sm.storage.Delete(ctx, sessionActivityPrefix+sessionID); err != nil {
+		return storageError(err, "failed to delete session activity")
+	}
+	return nil
 }
 
-func (sm *SessionManager) GetSession(r *http.Request) (map[string]interface{}, error) {
-	cookie, err := r.Cookie(sm.options.SessionName)
-	if err != nil {
-		if errors.Is(err, http.ErrNoCookie) {
-			return nil, nil
-		}
-		return nil, err
+// Replaces storage error with message, as it may carry storage details.
+// ErrSessionRevocationUnsupported is kept, callers have to tell it apart.
+func storageError(err error, message string) error {
+	if errors.Is(err, ErrSessionRevocationUnsupported) {
+		return err
+	}
+	return errors.New(message)
+}
+
+// Reports whether sessions can be listed and revoked apart from the request
+// they are used with. Storages keeping sessions on the client can't do that,
+// ErrSessionRevocationUnsupported is returned instead.
+func (sm *SessionManager) CanRevokeSessions() bool {
+	_, onClient := sm.storage.(*CookieStore)
+	return !onClient
+}
+
+// Entry lives as long as the session can, entries of expired sessions are
+// simply left behind until then. Storage adds it atomically, so concurrent
+// logins of the same user don't drop each other from the index.
+func (sm *SessionManager) addUserSession(ctx context.Context, userID, sessionID string) error {
+	if err := sm.storage.AddToSet(ctx, userSessionSetPrefix+userID, sessionID, sm.indexTTL()); err != nil {
+		return errors.New("failed to save user sessions")
 	}
+	return nil
+}
 
-	return sm.storage.Get(context.Background(), cookie.Value)
+// Sliding sessions may outlive MaxAge, so their index is kept for as long
+// as a session may last at all.
+func (sm *SessionManager) indexTTL() int {
+	if sm.options.SlidingExpiration && sm.options.MaxLifetime > sm.options.MaxAge {
+		return sm.options.MaxLifetime
+	}
+	return sm.options.MaxAge
 }
 
-func (sm *SessionManager) DestroySession(w http.ResponseWriter, r *http.Request) error {
-	cookie, err := r.Cookie(sm.options.SessionName)
+func (sm *SessionManager) removeUserSession(ctx context.Context, userID, sessionID string) error {
+	if err := sm.storage.RemoveFromSet(ctx, userSessionSetPrefix+userID, sessionID); err != nil {
+		return storageError(err, "failed to save user sessions")
+	}
+	return nil
+}
+
+// Stores values under a separate short-lived cookie. Used for state that has to
+// survive a redirect round trip before the user is authenticated.
+func (sm *SessionManager) CreateTransientSession(w http.ResponseWriter, r *http.Request, name string,
+	values map[string]string, ttlSeconds int) error {
+	id := uuid.NewString()
+	value, err := sm.cookies.Encode(name, id)
 	if err != nil {
-		return nil
+		return errors.New("failed to sign transient session cookie")
 	}
 
-	err = sm.storage.Delete(context.Background(), cookie.Value)
+	sess := &Session{
+		ExpiresAt: time.Now().Add(time.Duration(ttlSeconds) * time.Second),
+		Values:    values,
+	}
+	err = sm.save(withHTTP(context.Background(), w, r), id, sess, ttlSeconds)
 	if err != nil {
-		return errors.New("failed to delete session")
+		return errors.New("failed to save transient session")
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     sm.options.SessionName,
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   sm.options.SessionSecure,
+		MaxAge:   ttlSeconds,
+		Domain:   sm.options.SessionDomain,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// Returns values of transient session and destroys it, so it can be used only once.
+// Returns nil values if there is no such session or it has expired.
+func (sm *SessionManager) PopTransientSession(w http.ResponseWriter, r *http.Request, name string) (map[string]string, error) {
+	if _, err := r.Cookie(name); err != nil {
+		return nil, nil
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
 		Value:    "",
 		Path:     "/",
 		Domain:   sm.options.SessionDomain,
-		HttpOnly: sm.options.SessionHttpOnly,
+		HttpOnly: true,
 		Secure:   sm.options.SessionSecure,
 		MaxAge:   -1,
 	})
 
-	return nil
+	id := sm.cookieValue(r, name)
+	if id == "" {
+		return nil, nil
+	}
+
+	ctx := withHTTP(context.Background(), w, r)
+	sess, err := sm.getSession(ctx, id)
+	if err != nil || sess == nil {
+		return nil, err
+	}
+
+	if err := sm.storage.Delete(ctx, id); err != nil {
+		return nil, errors.New("failed to delete transient session")
+	}
+
+	return sess.Values, nil
+}
+
+// Returns ID held by cookie name of the request, or empty string if there is
+// no such cookie or it doesn't carry a valid signature.
+func (sm *SessionManager) cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	value, err := sm.cookies.Decode(name, cookie.Value)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// Session ID is a bearer credential, so it's never shown. Sessions are
+// referred to by a hash of it instead.
+func publicSessionID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
 }
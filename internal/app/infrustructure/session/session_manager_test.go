@@ -1,18 +1,29 @@
 package session_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Mixturka/vm-hub/internal/app/config"
 	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
 	"github.com/Mixturka/vm-hub/internal/pkg/test/mock"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
 func TestCreateSessionSuccess(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -22,6 +33,7 @@ func TestCreateSessionSuccess(t *testing.T) {
 
 	options := &config.SessionOptions{
 		SessionName:     "session_id",
+		SessionSecret:   testSessionSecret,
 		SessionHttpOnly: true,
 		SessionSecure:   false,
 		SessionDomain:   "localhost",
@@ -30,16 +42,20 @@ func TestCreateSessionSuccess(t *testing.T) {
 
 	sm := session.NewSessionManager(mockStorage, options)
 	w := httptest.NewRecorder()
-	values := map[string]interface{}{"key": "value"}
+	sess := &session.Session{Values: map[string]string{"key": "value"}}
 
-	sessionID, err := sm.CreateSession(w, values)
+	sessionID, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), sess)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, sessionID)
 
 	cookie := w.Result().Cookies()[0]
 	assert.Equal(t, options.SessionName, cookie.Name)
-	assert.Equal(t, sessionID, cookie.Value)
+	assert.NotEqual(t, sessionID, cookie.Value, "Session ID should be signed")
+
+	value, err := session.NewCookieCodec([]string{testSessionSecret}, nil).Decode(cookie.Name, cookie.Value)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionID, value)
 }
 
 func TestCreateSessionFailure(t *testing.T) {
@@ -51,6 +67,7 @@ func TestCreateSessionFailure(t *testing.T) {
 
 	options := &config.SessionOptions{
 		SessionName:     "session_id",
+		SessionSecret:   testSessionSecret,
 		SessionHttpOnly: true,
 		SessionSecure:   false,
 		SessionDomain:   "localhost",
@@ -59,9 +76,9 @@ func TestCreateSessionFailure(t *testing.T) {
 
 	sm := session.NewSessionManager(mockStorage, options)
 	w := httptest.NewRecorder()
-	values := map[string]interface{}{"key": "value"}
+	sess := &session.Session{Values: map[string]string{"key": "value"}}
 
-	sessionID, err := sm.CreateSession(w, values)
+	sessionID, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), sess)
 
 	assert.Error(t, err)
 	assert.Empty(t, sessionID)
@@ -77,6 +94,7 @@ func TestSessionExpiry(t *testing.T) {
 
 	options := &config.SessionOptions{
 		SessionName:     "session_id",
+		SessionSecret:   testSessionSecret,
 		SessionHttpOnly: true,
 		SessionSecure:   false,
 		SessionDomain:   "localhost",
@@ -85,14 +103,507 @@ func TestSessionExpiry(t *testing.T) {
 
 	sm := session.NewSessionManager(mockStorage, options)
 
+	value, err := session.NewCookieCodec([]string{testSessionSecret}, nil).Encode(options.SessionName, "expired_session_id")
+	require.NoError(t, err)
+
 	r := httptest.NewRequest("GET", "/", nil)
 	r.AddCookie(&http.Cookie{
 		Name:  options.SessionName,
-		Value: "expired_session_id",
+		Value: value,
+	})
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+
+	assert.NoError(t, err)
+	assert.Nil(t, sess)
+}
+
+func TestGetSessionRejectsTamperedCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Storage mustn't be queried for cookies that aren't signed by us.
+	mockStorage := mock.NewMockSessionStorage(ctrl)
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	}
+	sm := session.NewSessionManager(mockStorage, options)
+
+	forged, err := session.NewCookieCodec([]string{"another-secret-of-at-least-32-chars"}, nil).Encode(options.SessionName, "session")
+	require.NoError(t, err)
+
+	for _, value := range []string{"session", forged, forged + "x"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: options.SessionName, Value: value})
+
+		sess, err := sm.GetSession(httptest.NewRecorder(), r)
+		assert.NoError(t, err)
+		assert.Nil(t, sess)
+	}
+}
+
+func TestTransientSessionIsSingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	values := map[string]string{"state": "value"}
+	var stored []byte
+	mockStorage := mock.NewMockSessionStorage(ctrl)
+	mockStorage.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any(), 600).
+		DoAndReturn(func(_ context.Context, _ string, data []byte, _ int) error {
+			stored = data
+			return nil
+		})
+	mockStorage.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, string) ([]byte, error) {
+		return stored, nil
 	})
+	mockStorage.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		SessionDomain: "localhost",
+		MaxAge:        3600,
+	}
+
+	sm := session.NewSessionManager(mockStorage, options)
+	w := httptest.NewRecorder()
+
+	err := sm.CreateTransientSession(w, httptest.NewRequest("GET", "/", nil), "flow", values, 600)
+	assert.NoError(t, err)
 
-	values, err := sm.GetSession(r)
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, "flow", cookie.Name)
+	assert.Equal(t, 600, cookie.MaxAge)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+
+	popped, err := sm.PopTransientSession(w, r, "flow")
+	assert.NoError(t, err)
+	assert.Equal(t, values, popped)
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge, "Transient cookie should be cleared")
+}
+
+func TestDestroyUserSessions(t *testing.T) {
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	}
+	sm := session.NewSessionManager(rs, options)
+
+	userID := uuid.NewString()
+	var cookies []*http.Cookie
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		_, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: userID})
+		require.NoError(t, err)
+		cookies = append(cookies, w.Result().Cookies()[0])
+	}
+
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	otherCookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	require.NoError(t, sm.DestroySession(httptest.NewRecorder(), r))
+
+	require.NoError(t, sm.DestroyUserSessions(context.Background(), userID))
+
+	for _, cookie := range cookies {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		sess, err := sm.GetSession(httptest.NewRecorder(), r)
+		assert.NoError(t, err)
+		assert.Nil(t, sess, "All user's sessions should be destroyed")
+	}
 
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(otherCookie)
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
 	assert.NoError(t, err)
-	assert.Nil(t, values)
+	assert.NotNil(t, sess, "Sessions of other users should be kept")
+}
+
+func TestConcurrentLoginsAreAllIndexed(t *testing.T) {
+	t.Parallel()
+
+	sm := newCodecTestManager(session.NewMemoryStore(context.Background(), 0), "json")
+	userID := uuid.NewString()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sm.CreateSession(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil),
+				&session.Session{UserID: userID})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	sessions, err := sm.ListUserSessions(context.Background(), userID, nil)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 20, "Concurrent logins shouldn't drop each other from the index")
+}
+
+func TestListAndDestroyUserSessions(t *testing.T) {
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	}
+	sm := session.NewSessionManager(rs, options)
+
+	userID := uuid.NewString()
+	var cookies []*http.Cookie
+	for _, userAgent := range []string{"laptop", "phone", "tablet"} {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = "203.0.113.7:51234"
+		r.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		_, err := sm.CreateSession(w, r, &session.Session{UserID: userID})
+		require.NoError(t, err)
+		cookies = append(cookies, w.Result().Cookies()[0])
+	}
+
+	current := httptest.NewRequest("GET", "/users/sessions", nil)
+	current.AddCookie(cookies[0])
+	_, err := sm.GetSession(httptest.NewRecorder(), current)
+	require.NoError(t, err)
+
+	sessions, err := sm.ListUserSessions(context.Background(), userID, current)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+
+	var currentID, phoneID string
+	for _, s := range sessions {
+		assert.Equal(t, "203.0.113.7", s.IP)
+		assert.False(t, s.CreatedAt.IsZero())
+		assert.False(t, s.LastSeenAt.Before(s.CreatedAt))
+		for _, cookie := range cookies {
+			assert.NotEqual(t, cookie.Value, s.ID, "Session ID shouldn't be exposed")
+		}
+		if s.Current {
+			currentID = s.ID
+			assert.Equal(t, "laptop", s.UserAgent)
+		}
+		if s.UserAgent == "phone" {
+			phoneID = s.ID
+		}
+	}
+	require.NotEmpty(t, currentID, "Current session should be marked")
+
+	require.NoError(t, sm.DestroyUserSession(context.Background(), userID, phoneID))
+	assert.ErrorIs(t, sm.DestroyUserSession(context.Background(), userID, phoneID), session.ErrSessionNotFound)
+	assert.ErrorIs(t, sm.DestroyUserSession(context.Background(), uuid.NewString(), currentID), session.ErrSessionNotFound,
+		"Sessions of other users can't be destroyed")
+
+	sessions, err = sm.ListUserSessions(context.Background(), userID, nil)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, sm.DestroyOtherUserSessions(context.Background(), userID, current))
+
+	sessions, err = sm.ListUserSessions(context.Background(), userID, current)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, currentID, sessions[0].ID)
+
+	for i, cookie := range cookies {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		sess, err := sm.GetSession(httptest.NewRecorder(), r)
+		assert.NoError(t, err)
+		if i == 0 {
+			assert.NotNil(t, sess, "Current session should be kept")
+		} else {
+			assert.Nil(t, sess, "Other sessions should be destroyed")
+		}
+	}
+}
+
+func TestRotateSession(t *testing.T) {
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	options := &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	}
+	sm := session.NewSessionManager(rs, options)
+
+	userID := uuid.NewString()
+	w := httptest.NewRecorder()
+	oldID, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: userID})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/auth/password/change", nil)
+	r.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	newID, err := sm.RotateSession(w, r)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldID, newID)
+
+	cookie := w.Result().Cookies()[0]
+	value, err := session.NewCookieCodec([]string{testSessionSecret}, nil).Decode(cookie.Name, cookie.Value)
+	require.NoError(t, err)
+	assert.Equal(t, newID, value)
+	assert.Greater(t, cookie.MaxAge, 0)
+	assert.LessOrEqual(t, cookie.MaxAge, options.MaxAge)
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Nil(t, sess, "Old session ID should be invalidated")
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	sess, err = sm.GetSession(httptest.NewRecorder(), r)
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.Equal(t, userID, sess.UserID)
+
+	sessions, err := sm.ListUserSessions(context.Background(), userID, r)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.True(t, sessions[0].Current)
+
+	_, err = sm.RotateSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+}
+
+func TestCreateSessionDiscardsPreviousSession(t *testing.T) {
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	sm := session.NewSessionManager(rs, &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	})
+
+	w := httptest.NewRecorder()
+	_, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	oldCookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.AddCookie(oldCookie)
+	_, err = sm.CreateSession(httptest.NewRecorder(), r, &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+
+	sess, err := sm.GetSession(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Nil(t, sess, "Session carried by login request should be destroyed")
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	util := test.NewRedisTestUtil(t)
+	rs := session.NewRedisStore(util.Client())
+
+	w := httptest.NewRecorder()
+	_, err := session.NewSessionManager(rs, &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        60,
+	}).CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	cookie := w.Result().Cookies()[0]
+
+	// Cases run against the same session, each one sees expiry left by previous.
+	tests := []struct {
+		name        string
+		options     *config.SessionOptions
+		expectedMin int
+		expectedMax int
+	}{
+		{
+			name: "not sliding",
+			options: &config.SessionOptions{
+				SessionName:   "session_id",
+				SessionSecret: testSessionSecret,
+				MaxAge:        3600,
+				MaxLifetime:   7200,
+			},
+		},
+		{
+			name: "capped by max lifetime",
+			options: &config.SessionOptions{
+				SessionName:       "session_id",
+				SessionSecret:     testSessionSecret,
+				MaxAge:            3600,
+				SlidingExpiration: true,
+				RefreshThreshold:  3600,
+				MaxLifetime:       1800,
+			},
+			expectedMin: 1790,
+			expectedMax: 1800,
+		},
+		{
+			name: "refreshed past threshold",
+			options: &config.SessionOptions{
+				SessionName:       "session_id",
+				SessionSecret:     testSessionSecret,
+				MaxAge:            3600,
+				SlidingExpiration: true,
+				RefreshThreshold:  3600,
+				MaxLifetime:       7200,
+			},
+			expectedMin: 3590,
+			expectedMax: 3600,
+		},
+		{
+			name: "not refreshed before threshold",
+			options: &config.SessionOptions{
+				SessionName:       "session_id",
+				SessionSecret:     testSessionSecret,
+				MaxAge:            3600,
+				SlidingExpiration: true,
+				RefreshThreshold:  10,
+				MaxLifetime:       7200,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := session.NewSessionManager(rs, tt.options)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(cookie)
+			w := httptest.NewRecorder()
+			sess, err := sm.GetSession(w, r)
+			require.NoError(t, err)
+			require.NotNil(t, sess)
+
+			cookies := w.Result().Cookies()
+			if tt.expectedMax == 0 {
+				assert.Empty(t, cookies, "Session shouldn't be extended")
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.Equal(t, cookie.Value, cookies[0].Value)
+			assert.GreaterOrEqual(t, cookies[0].MaxAge, tt.expectedMin)
+			assert.LessOrEqual(t, cookies[0].MaxAge, tt.expectedMax)
+		})
+	}
+}
+
+// Counts writes of session activity made through the wrapped store.
+type activityCountingStore struct {
+	*session.MemoryStore
+	writes atomic.Int32
+}
+
+func (s *activityCountingStore) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
+	if strings.HasPrefix(key, "session_activity:") {
+		s.writes.Add(1)
+	}
+	return s.MemoryStore.Set(ctx, key, data, ttlSeconds)
+}
+
+func TestRecordActivityIsThrottled(t *testing.T) {
+	t.Parallel()
+
+	store := &activityCountingStore{MemoryStore: session.NewMemoryStore(context.Background(), 0)}
+	sm := session.NewSessionManager(store, &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	})
+
+	w := httptest.NewRecorder()
+	sessionID, err := sm.CreateSession(w, httptest.NewRequest("POST", "/login", nil), &session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+		require.NoError(t, err)
+		require.NotNil(t, sess)
+	}
+	assert.Zero(t, store.writes.Load(), "Activity of a session just started shouldn't be written")
+
+	staleID := uuid.NewString()
+	createdAt := time.Now().Add(-time.Hour)
+	stale := `{"userID":"` + uuid.NewString() + `","createdAt":` + strconv.FormatInt(createdAt.Unix(), 10) +
+		`,"expiresAt":` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `}`
+	require.NoError(t, store.MemoryStore.Set(context.Background(), staleID, []byte(stale), 3600))
+
+	for i := 0; i < 3; i++ {
+		sess, err := sm.GetSession(httptest.NewRecorder(), requestWithSession(t, staleID))
+		require.NoError(t, err)
+		require.NotNil(t, sess)
+		assert.WithinDuration(t, time.Now(), sess.LastSeenAt, time.Minute)
+	}
+	assert.Equal(t, int32(1), store.writes.Load(), "Activity should be written once per interval")
+}
+
+// Counts reads of the session made through the wrapped store.
+type sessionReadCountingStore struct {
+	*session.MemoryStore
+	sessionID string
+	reads     atomic.Int32
+}
+
+func (s *sessionReadCountingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if key == s.sessionID {
+		s.reads.Add(1)
+	}
+	return s.MemoryStore.Get(ctx, key)
+}
+
+func TestMiddlewareLoadsSessionOnce(t *testing.T) {
+	t.Parallel()
+
+	store := &sessionReadCountingStore{MemoryStore: session.NewMemoryStore(context.Background(), 0)}
+	sm := session.NewSessionManager(store, &config.SessionOptions{
+		SessionName:   "session_id",
+		SessionSecret: testSessionSecret,
+		MaxAge:        3600,
+	})
+
+	sessionID, err := sm.CreateSession(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil),
+		&session.Session{UserID: uuid.NewString()})
+	require.NoError(t, err)
+	store.sessionID = sessionID
+
+	var loaded []*session.Session
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			sess, err := sm.GetSession(w, r)
+			require.NoError(t, err)
+			loaded = append(loaded, sess)
+		}
+
+		require.NoError(t, sm.DestroySession(w, r))
+		sess, err := sm.GetSession(w, r)
+		require.NoError(t, err)
+		assert.Nil(t, sess, "Destroyed session shouldn't be returned later in the request")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), requestWithSession(t, sessionID))
+
+	require.Len(t, loaded, 3)
+	require.NotNil(t, loaded[0])
+	assert.Same(t, loaded[0], loaded[2], "Every caller should get the same session")
+	// One read by GetSession, one by DestroySession looking up the user index.
+	assert.Equal(t, int32(2), store.reads.Load(), "Session should be loaded once per request")
+
+	_, err = sm.GetSession(httptest.NewRecorder(), requestWithSession(t, sessionID))
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), store.reads.Load(), "Requests without middleware should still load session")
 }
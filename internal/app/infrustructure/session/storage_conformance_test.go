@@ -0,0 +1,234 @@
+package session_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/internal/app/application/interfaces"
+	"github.com/Mixturka/vm-hub/internal/app/infrustructure/session"
+	"github.com/Mixturka/vm-hub/internal/pkg/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Behaviour every server-side SessionStorage has to share, so they can be
+// swapped without SessionManager noticing.
+func testSessionStorage(t *testing.T, store interfaces.SessionStorage) {
+	ctx := context.Background()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		key := uuid.NewString()
+		data := []byte{'j', 0, 1, 2, 0xff}
+
+		require.NoError(t, store.Set(ctx, key, data, 60))
+
+		result, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, data, result, "Data should come back byte for byte")
+	})
+
+	t.Run("Get missing key", func(t *testing.T) {
+		result, err := store.Get(ctx, uuid.NewString())
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Set overwrites", func(t *testing.T) {
+		key := uuid.NewString()
+		require.NoError(t, store.Set(ctx, key, []byte("old"), 1))
+		require.NoError(t, store.Set(ctx, key, []byte("new"), 60))
+
+		time.Sleep(1500 * time.Millisecond)
+
+		result, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), result, "TTL should be replaced as well")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		key := uuid.NewString()
+		other := uuid.NewString()
+		require.NoError(t, store.Set(ctx, key, []byte("value"), 60))
+		require.NoError(t, store.Set(ctx, other, []byte("value"), 60))
+
+		require.NoError(t, store.Delete(ctx, key))
+		require.NoError(t, store.Delete(ctx, key), "Deleting missing key shouldn't fail")
+
+		result, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Nil(t, result)
+
+		result, err = store.Get(ctx, other)
+		require.NoError(t, err)
+		assert.NotNil(t, result, "Other keys should be kept")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		key := uuid.NewString()
+		require.NoError(t, store.Set(ctx, key, []byte("expires"), 1))
+
+		result, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+
+		time.Sleep(1500 * time.Millisecond)
+
+		result, err = store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Concurrent access", func(t *testing.T) {
+		key := uuid.NewString()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, store.Set(ctx, key, []byte{byte(i)}, 60))
+				_, err := store.Get(ctx, key)
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		result, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Len(t, result, 1)
+	})
+
+	t.Run("Sets", func(t *testing.T) {
+		key := uuid.NewString()
+		require.NoError(t, store.AddToSet(ctx, key, "a", 60))
+		require.NoError(t, store.AddToSet(ctx, key, "b", 60))
+		require.NoError(t, store.AddToSet(ctx, key, "a", 60), "Adding existing member shouldn't fail")
+
+		members, err := store.SetMembers(ctx, key)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+		require.NoError(t, store.RemoveFromSet(ctx, key, "a"))
+		require.NoError(t, store.RemoveFromSet(ctx, key, "missing"), "Removing missing member shouldn't fail")
+
+		members, err = store.SetMembers(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, members)
+
+		require.NoError(t, store.Delete(ctx, key))
+
+		members, err = store.SetMembers(ctx, key)
+		require.NoError(t, err)
+		assert.Empty(t, members, "Delete should remove sets as well")
+	})
+
+	t.Run("Missing set", func(t *testing.T) {
+		members, err := store.SetMembers(ctx, uuid.NewString())
+		require.NoError(t, err)
+		assert.Empty(t, members)
+	})
+
+	t.Run("Concurrent set changes", func(t *testing.T) {
+		key := uuid.NewString()
+		require.NoError(t, store.AddToSet(ctx, key, "removed", 60))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, store.AddToSet(ctx, key, strconv.Itoa(i), 60))
+			}(i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.RemoveFromSet(ctx, key, "removed"))
+		}()
+		wg.Wait()
+
+		members, err := store.SetMembers(ctx, key)
+		require.NoError(t, err)
+		assert.Len(t, members, 20, "No concurrent change should be lost")
+		assert.NotContains(t, members, "removed")
+	})
+}
+
+func TestStorageConformance_Memory(t *testing.T) {
+	t.Parallel()
+
+	testSessionStorage(t, session.NewMemoryStore(context.Background(), 0))
+}
+
+func TestStorageConformance_Redis(t *testing.T) {
+	t.Parallel()
+
+	util := test.NewRedisTestUtil(t)
+	testSessionStorage(t, session.NewRedisStore(util.Client()))
+}
+
+func TestStorageConformance_Postgres(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	ptUtil.ApplyMigrations()
+	testSessionStorage(t, session.NewPostgresStore(ptUtil.DB()))
+}
+
+func TestMemoryStore_Janitor(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := session.NewMemoryStore(ctx, 100*time.Millisecond)
+	require.NoError(t, store.Set(ctx, "expiring", []byte("value"), 1))
+	require.NoError(t, store.Set(ctx, "kept", []byte("value"), 60))
+
+	assert.Eventually(t, func() bool {
+		return store.Len() == 1
+	}, 3*time.Second, 100*time.Millisecond, "Janitor should evict expired entries")
+
+	result, err := store.Get(ctx, "kept")
+	require.NoError(t, err)
+	assert.NotNil(t, result)
+}
+
+func TestPostgresStore_PurgeExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode...")
+	}
+	t.Parallel()
+
+	ptUtil := test.NewPostgresTestUtilWithIsolatedSchema(t)
+	ptUtil.ApplyMigrations()
+	store := session.NewPostgresStore(ptUtil.DB())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, store.Set(ctx, "expiring", []byte("value"), 1))
+	require.NoError(t, store.Set(ctx, "kept", []byte("value"), 60))
+
+	purged, err := store.PurgeExpired(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	require.NoError(t, store.Set(ctx, "expiring", []byte("value"), 1))
+	require.NoError(t, store.Set(ctx, "kept", []byte("value"), 60))
+
+	purged, err = store.PurgeExpired(ctx, time.Now().Add(2*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	result, err := store.Get(ctx, "kept")
+	require.NoError(t, err)
+	assert.NotNil(t, result)
+}
@@ -18,6 +18,11 @@ func AssertUsersEqual(t *testing.T, expected, actual *entities.User) {
 	assert.Equal(t, expected.IsEmailVerified, actual.IsEmailVerified)
 	assert.Equal(t, expected.IsTwoFactorEnabled, actual.IsTwoFactorEnabled)
 	assert.Equal(t, expected.Method, actual.Method)
+	assert.Equal(t, expected.TotpSecret, actual.TotpSecret)
+	assert.Equal(t, expected.IsTotpEnabled, actual.IsTotpEnabled)
+	assert.Equal(t, expected.TotpLastStep, actual.TotpLastStep)
+	assert.Equal(t, expected.IsAdmin, actual.IsAdmin)
+	assert.Equal(t, expected.SessionEpoch, actual.SessionEpoch)
 
 	assert.True(t, actual.CreatedAt.Sub(expected.CreatedAt) < time.Millisecond, "CreatedAt should match within a millisecond")
 	assert.True(t, actual.UpdatedAt.Sub(expected.UpdatedAt) < time.Millisecond, "UpdatedAt should match within a millisecond")
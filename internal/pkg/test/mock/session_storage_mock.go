@@ -34,6 +34,20 @@ func (m *MockSessionStorage) EXPECT() *MockSessionStorageMockRecorder {
 	return m.recorder
 }
 
+// AddToSet mocks base method.
+func (m *MockSessionStorage) AddToSet(ctx context.Context, key, member string, ttlSeconds int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddToSet", ctx, key, member, ttlSeconds)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddToSet indicates an expected call of AddToSet.
+func (mr *MockSessionStorageMockRecorder) AddToSet(ctx, key, member, ttlSeconds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToSet", reflect.TypeOf((*MockSessionStorage)(nil).AddToSet), ctx, key, member, ttlSeconds)
+}
+
 // Delete mocks base method.
 func (m *MockSessionStorage) Delete(ctx context.Context, key string) error {
 	m.ctrl.T.Helper()
@@ -49,10 +63,10 @@ func (mr *MockSessionStorageMockRecorder) Delete(ctx, key interface{}) *gomock.C
 }
 
 // Get mocks base method.
-func (m *MockSessionStorage) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+func (m *MockSessionStorage) Get(ctx context.Context, key string) ([]byte, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Get", ctx, key)
-	ret0, _ := ret[0].(map[string]interface{})
+	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -63,16 +77,45 @@ func (mr *MockSessionStorageMockRecorder) Get(ctx, key interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSessionStorage)(nil).Get), ctx, key)
 }
 
+// RemoveFromSet mocks base method.
+func (m *MockSessionStorage) RemoveFromSet(ctx context.Context, key, member string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveFromSet", ctx, key, member)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveFromSet indicates an expected call of RemoveFromSet.
+func (mr *MockSessionStorageMockRecorder) RemoveFromSet(ctx, key, member interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFromSet", reflect.TypeOf((*MockSessionStorage)(nil).RemoveFromSet), ctx, key, member)
+}
+
 // Set mocks base method.
-func (m *MockSessionStorage) Set(ctx context.Context, key string, value map[string]interface{}, ttlSeconds int) error {
+func (m *MockSessionStorage) Set(ctx context.Context, key string, data []byte, ttlSeconds int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Set", ctx, key, value, ttlSeconds)
+	ret := m.ctrl.Call(m, "Set", ctx, key, data, ttlSeconds)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Set indicates an expected call of Set.
-func (mr *MockSessionStorageMockRecorder) Set(ctx, key, value, ttlSeconds interface{}) *gomock.Call {
+func (mr *MockSessionStorageMockRecorder) Set(ctx, key, data, ttlSeconds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockSessionStorage)(nil).Set), ctx, key, data, ttlSeconds)
+}
+
+// SetMembers mocks base method.
+func (m *MockSessionStorage) SetMembers(ctx context.Context, key string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMembers", ctx, key)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetMembers indicates an expected call of SetMembers.
+func (mr *MockSessionStorageMockRecorder) SetMembers(ctx, key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockSessionStorage)(nil).Set), ctx, key, value, ttlSeconds)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMembers", reflect.TypeOf((*MockSessionStorage)(nil).SetMembers), ctx, key)
 }
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	FakeOAuthCode        = "fake-authorization-code"
+	FakeOAuthAccessToken = "fake-access-token"
+)
+
+// FakeOAuthProvider is an httptest stand-in for provider's token and profile endpoints.
+type FakeOAuthProvider struct {
+	server  *httptest.Server
+	profile map[string]interface{}
+
+	mu           sync.Mutex
+	tokenRequest url.Values
+}
+
+func NewFakeOAuthProvider(t TestingT, profile map[string]interface{}) *FakeOAuthProvider {
+	fp := &FakeOAuthProvider{profile: profile}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", fp.handleToken)
+	mux.HandleFunc("/userinfo", fp.handleUserInfo)
+
+	fp.server = httptest.NewServer(mux)
+	t.Cleanup(fp.server.Close)
+
+	return fp
+}
+
+func (fp *FakeOAuthProvider) AuthorizeURL() string {
+	return fp.server.URL + "/authorize"
+}
+
+func (fp *FakeOAuthProvider) AccessURL() string {
+	return fp.server.URL + "/token"
+}
+
+func (fp *FakeOAuthProvider) ProfileURL() string {
+	return fp.server.URL + "/userinfo"
+}
+
+// Returns form values of the last token exchange request.
+func (fp *FakeOAuthProvider) TokenRequest() url.Values {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	return fp.tokenRequest
+}
+
+func (fp *FakeOAuthProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fp.mu.Lock()
+	fp.tokenRequest = r.PostForm
+	fp.mu.Unlock()
+
+	if r.PostForm.Get("code") != FakeOAuthCode {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  FakeOAuthAccessToken,
+		"refresh_token": "fake-refresh-token",
+		"expires_in":    3600,
+		"token_type":    "Bearer",
+	})
+}
+
+func (fp *FakeOAuthProvider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	// Providers differ in authorization scheme ("Bearer", "OAuth"), only token matters.
+	if !strings.HasSuffix(r.Header.Get("Authorization"), " "+FakeOAuthAccessToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fp.profile)
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const FakeOIDCSubject = "fake-oidc-subject"
+
+// FakeOIDCIssuer is an in-process OpenID Connect issuer serving discovery,
+// JWKS, token and userinfo endpoints. ID tokens are signed with RS256.
+type FakeOIDCIssuer struct {
+	t        TestingT
+	server   *httptest.Server
+	clientID string
+	key      *rsa.PrivateKey
+	keyID    string
+
+	mu         sync.Mutex
+	claims     map[string]interface{}
+	userInfo   map[string]interface{}
+	signingKey *rsa.PrivateKey
+}
+
+func NewFakeOIDCIssuer(t TestingT, clientID string) *FakeOIDCIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	fi := &FakeOIDCIssuer{
+		t:          t,
+		clientID:   clientID,
+		key:        key,
+		keyID:      "fake-key",
+		claims:     map[string]interface{}{},
+		userInfo:   map[string]interface{}{"sub": FakeOIDCSubject},
+		signingKey: key,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", fi.handleDiscovery)
+	mux.HandleFunc("/jwks", fi.handleJWKS)
+	mux.HandleFunc("/token", fi.handleToken)
+	mux.HandleFunc("/userinfo", fi.handleUserInfo)
+
+	fi.server = httptest.NewServer(mux)
+	t.Cleanup(fi.server.Close)
+
+	return fi
+}
+
+func (fi *FakeOIDCIssuer) URL() string {
+	return fi.server.URL
+}
+
+// Sets claims of issued ID tokens, they override default iss, aud, sub, iat and exp.
+func (fi *FakeOIDCIssuer) SetIDTokenClaims(claims map[string]interface{}) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.claims = claims
+}
+
+func (fi *FakeOIDCIssuer) SetUserInfo(userInfo map[string]interface{}) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.userInfo = userInfo
+}
+
+// Makes issuer sign ID tokens with a key which is not published in JWKS.
+func (fi *FakeOIDCIssuer) SignWithUnknownKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(fi.t, err)
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.signingKey = key
+}
+
+func (fi *FakeOIDCIssuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                fi.server.URL,
+		"authorization_endpoint":                fi.server.URL + "/authorize",
+		"token_endpoint":                        fi.server.URL + "/token",
+		"userinfo_endpoint":                     fi.server.URL + "/userinfo",
+		"jwks_uri":                              fi.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (fi *FakeOIDCIssuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]interface{}{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": fi.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(fi.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(fi.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (fi *FakeOIDCIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != FakeOAuthCode {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": FakeOAuthAccessToken,
+		"id_token":     fi.idToken(),
+		"expires_in":   3600,
+		"token_type":   "Bearer",
+	})
+}
+
+func (fi *FakeOIDCIssuer) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+FakeOAuthAccessToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fi.userInfo)
+}
+
+func (fi *FakeOIDCIssuer) idToken() string {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": fi.server.URL,
+		"aud": fi.clientID,
+		"sub": FakeOIDCSubject,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for claim, value := range fi.claims {
+		claims[claim] = value
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": fi.keyID})
+	require.NoError(fi.t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(fi.t, err)
+
+	signingInput := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString(header),
+		base64.RawURLEncoding.EncodeToString(payload),
+	}, ".")
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, fi.signingKey, crypto.SHA256, digest[:])
+	require.NoError(fi.t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,13 @@
+package test
+
+import "github.com/Mixturka/vm-hub/pkg/security"
+
+// Returns argon2id hasher with the lowest parameters, so tests hashing
+// passwords stay fast.
+func NewPasswordHasher() security.PasswordHasher {
+	return security.NewArgon2idHasher(security.Argon2idParams{
+		Memory:      8,
+		Iterations:  1,
+		Parallelism: 1,
+	})
+}
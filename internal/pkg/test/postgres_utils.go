@@ -23,10 +23,11 @@ import (
 )
 
 type PostgresTestUtil struct {
-	t       TestingT
-	db      *pgxpool.Pool
-	connStr string
-	poolMu  sync.Mutex
+	t              TestingT
+	db             *pgxpool.Pool
+	connStr        string
+	migrationsPath string
+	poolMu         sync.Mutex
 }
 
 func NewPostgresTestUtilWithIsolatedSchema(t TestingT) *PostgresTestUtil {
@@ -54,8 +55,9 @@ func newPostgresTestUtil(t TestingT) *PostgresTestUtil {
 
 	ApplyMigrations(connStr, absoluteMigrationsPath)
 	return &PostgresTestUtil{
-		t:       t,
-		connStr: connStr,
+		t:              t,
+		connStr:        connStr,
+		migrationsPath: absoluteMigrationsPath,
 	}
 }
 
@@ -101,11 +103,18 @@ func (p *PostgresTestUtil) createSchema(t TestingT) *PostgresTestUtil {
 
 	pgurl := setSearchPath(t, p.connStr, schemaName)
 	return &PostgresTestUtil{
-		t:       p.t,
-		connStr: pgurl.String(),
+		t:              p.t,
+		connStr:        pgurl.String(),
+		migrationsPath: p.migrationsPath,
 	}
 }
 
+// Applies migrations to the schema of the util, for packages that don't
+// locate migrations themselves.
+func (p *PostgresTestUtil) ApplyMigrations() {
+	ApplyMigrations(p.DB().Config().ConnString(), p.migrationsPath)
+}
+
 func MustGetEnv(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SMTPMessage is mail received by FakeSMTPServer.
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// FakeSMTPServer is a minimal plaintext SMTP server accepting any mail. It
+// doesn't support STARTTLS or authentication.
+type FakeSMTPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+}
+
+func NewFakeSMTPServer(t TestingT) *FakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	fs := &FakeSMTPServer{
+		listener: listener,
+	}
+	go fs.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return fs
+}
+
+func (fs *FakeSMTPServer) Host() string {
+	return fs.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (fs *FakeSMTPServer) Port() int {
+	return fs.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (fs *FakeSMTPServer) Messages() []SMTPMessage {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]SMTPMessage{}, fs.messages...)
+}
+
+func (fs *FakeSMTPServer) serve() {
+	for {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *FakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) {
+		text.PrintfLine("%s %s", strconv.Itoa(code), message)
+	}
+
+	reply(220, "fake smtp ready")
+	var current SMTPMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			reply(250, "fake smtp")
+		case "MAIL":
+			current = SMTPMessage{From: extractSMTPAddress(line)}
+			reply(250, "ok")
+		case "RCPT":
+			current.To = append(current.To, extractSMTPAddress(line))
+			reply(250, "ok")
+		case "DATA":
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := readSMTPData(text.R)
+			if err != nil {
+				return
+			}
+			current.Data = data
+			fs.mu.Lock()
+			fs.messages = append(fs.messages, current)
+			fs.mu.Unlock()
+			reply(250, "ok")
+		case "RSET", "NOOP":
+			reply(250, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func readSMTPData(r *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return data.String(), nil
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// Extracts address from "MAIL FROM:<address>" or "RCPT TO:<address>".
+func extractSMTPAddress(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start == -1 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
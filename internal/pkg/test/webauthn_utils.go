@@ -0,0 +1,187 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	authenticatorFlagUserPresent  = 0x01
+	authenticatorFlagUserVerified = 0x04
+	authenticatorFlagAttestedData = 0x40
+)
+
+// SoftwareAuthenticator emulates a platform authenticator holding a single
+// ES256 passkey, producing the same JSON a browser would send to the server.
+type SoftwareAuthenticator struct {
+	Origin       string
+	CredentialID []byte
+	UserHandle   []byte
+	// Counter reported with the next assertion, it's incremented before signing.
+	SignCount uint32
+	// Asserts only user presence, as security keys without PIN do.
+	SkipUserVerification bool
+
+	key *ecdsa.PrivateKey
+}
+
+func NewSoftwareAuthenticator(origin string) *SoftwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate authenticator key: %v", err))
+	}
+
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		panic(fmt.Sprintf("failed to generate credential id: %v", err))
+	}
+
+	return &SoftwareAuthenticator{
+		Origin:       origin,
+		CredentialID: credentialID,
+		key:          key,
+	}
+}
+
+// Answers navigator.credentials.create() call with the given options, as
+// returned by the server, using "none" attestation.
+func (a *SoftwareAuthenticator) CreateCredential(optionsJSON []byte) ([]byte, error) {
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RP        struct {
+				ID string `json:"id"`
+			} `json:"rp"`
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user handle: %w", err)
+	}
+	a.UserHandle = userHandle
+
+	clientData, err := a.clientData("webauthn.create", options.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authData(options.PublicKey.RP.ID,
+		authenticatorFlagUserPresent|authenticatorFlagUserVerified|authenticatorFlagAttestedData, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// Answers navigator.credentials.get() call with the given options, as
+// returned by the server.
+func (a *SoftwareAuthenticator) GetAssertion(optionsJSON []byte, rpID string) ([]byte, error) {
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RPID      string `json:"rpId"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		return nil, err
+	}
+	if options.PublicKey.RPID != "" {
+		rpID = options.PublicKey.RPID
+	}
+
+	clientData, err := a.clientData("webauthn.get", options.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.SignCount++
+	var flags byte = authenticatorFlagUserPresent | authenticatorFlagUserVerified
+	if a.SkipUserVerification {
+		flags = authenticatorFlagUserPresent
+	}
+	authData := a.authData(rpID, flags, a.SignCount)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.UserHandle),
+		},
+	})
+}
+
+func (a *SoftwareAuthenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.Origin,
+	})
+}
+
+func (a *SoftwareAuthenticator) authData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, flags)
+	return binary.BigEndian.AppendUint32(authData, signCount)
+}
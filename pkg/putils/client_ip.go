@@ -0,0 +1,15 @@
+package putils
+
+import (
+	"net"
+	"net/http"
+)
+
+// Returns IP address request came from, without port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
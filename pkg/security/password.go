@@ -1,22 +1,195 @@
 package security
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-// Hashes the given plain-text password.
-func HashPassword(password string) (string, error) {
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmptyPassword   = errors.New("password is empty")
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	ErrMalformedHash   = errors.New("malformed password hash")
+)
+
+// Hashes passwords into PHC strings. Hashes of every supported algorithm are
+// verified regardless of the one used for new hashes, so algorithm and its
+// parameters can be changed without invalidating existing passwords.
+type PasswordHasher interface {
+	// Hashes password with random salt. Empty password gives ErrEmptyPassword.
+	Hash(password string) (string, error)
+	// Reports whether password matches hash. Mismatch isn't an error.
+	Verify(hash, password string) (bool, error)
+	// Reports whether hash was made by another algorithm or with other
+	// parameters and should be replaced by a new one.
+	NeedsRehash(hash string) bool
+}
+
+// Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// Salt and key lengths default to 16 and 32 bytes.
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	if params.SaltLength == 0 {
+		params.SaltLength = 16
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = 32
+	}
+	return &Argon2idHasher{
+		params: params,
+	}
+}
+
+// Hash is formatted as $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func (ah *Argon2idHasher) Hash(password string) (string, error) {
 	if password == "" {
-		return "", nil
+		return "", ErrEmptyPassword
+	}
+
+	salt := make([]byte, ah.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	key := argon2.IDKey([]byte(password), salt, ah.params.Iterations, ah.params.Memory, ah.params.Parallelism, ah.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		ah.params.Memory, ah.params.Iterations, ah.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (ah *Argon2idHasher) Verify(hash, password string) (bool, error) {
+	return verifyPassword(hash, password)
+}
+
+func (ah *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != ah.params.Memory || params.Iterations != ah.params.Iterations ||
+		params.Parallelism != ah.params.Parallelism ||
+		uint32(len(salt)) != ah.params.SaltLength || uint32(len(key)) != ah.params.KeyLength
+}
+
+type BcryptHasher struct {
+	cost int
+}
+
+// Cost below bcrypt.MinCost is raised to it.
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{
+		cost: max(cost, bcrypt.MinCost),
+	}
+}
+
+// Bcrypt hashes keep their modular crypt format, e.g. $2a$12$<salt and key>,
+// which PHC strings are compatible with.
+func (bh *BcryptHasher) Hash(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bh.cost)
 	if err != nil {
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return string(hash), nil
+}
+
+func (bh *BcryptHasher) Verify(hash, password string) (bool, error) {
+	return verifyPassword(hash, password)
+}
+
+func (bh *BcryptHasher) NeedsRehash(hash string) bool {
+	if !isBcrypt(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != bh.cost
+}
+
+// Verifies password against hash of any supported algorithm.
+func verifyPassword(hash, password string) (bool, error) {
+	if password == "" {
+		return false, ErrEmptyPassword
+	}
+
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+		}
+		return true, nil
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2 version %d", ErrUnsupportedHash, version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
 }
 
-// Compares a hashed password with a plain-text password.
-// Returns true if they match, false otherwise.
-func ComparePasswords(hashedPassword, plainPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	return err == nil
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
 }
@@ -0,0 +1,103 @@
+package security_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Mixturka/vm-hub/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = security.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := map[string]security.PasswordHasher{
+		"argon2id": security.NewArgon2idHasher(testArgon2idParams),
+		"bcrypt":   security.NewBcryptHasher(bcrypt.MinCost),
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			hash, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+
+			other, err := hasher.Hash("correct horse")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other, "Hashes should be salted")
+
+			ok, err := hasher.Verify(hash, "correct horse")
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = hasher.Verify(hash, "wrong horse")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.False(t, hasher.NeedsRehash(hash))
+
+			_, err = hasher.Hash("")
+			assert.ErrorIs(t, err, security.ErrEmptyPassword)
+			ok, err = hasher.Verify(hash, "")
+			assert.ErrorIs(t, err, security.ErrEmptyPassword)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestArgon2idHasher_PHCFormat(t *testing.T) {
+	hash, err := security.NewArgon2idHasher(testArgon2idParams).Hash("correct horse")
+	require.NoError(t, err)
+
+	parts := strings.Split(hash, "$")
+	require.Len(t, parts, 6)
+	assert.Equal(t, []string{"", "argon2id", "v=19", "m=64,t=1,p=1"}, parts[:4])
+	assert.Len(t, parts[4], 22, "16 byte salt should be base64 encoded without padding")
+	assert.Len(t, parts[5], 43, "32 byte key should be base64 encoded without padding")
+}
+
+func TestPasswordHashers_Migration(t *testing.T) {
+	argon2id := security.NewArgon2idHasher(testArgon2idParams)
+	bcryptHasher := security.NewBcryptHasher(bcrypt.MinCost)
+
+	bcryptHash, err := bcryptHasher.Hash("correct horse")
+	require.NoError(t, err)
+	argon2idHash, err := argon2id.Hash("correct horse")
+	require.NoError(t, err)
+
+	ok, err := argon2id.Verify(bcryptHash, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, ok, "Hashes of other algorithm should still be verified")
+	assert.True(t, argon2id.NeedsRehash(bcryptHash))
+
+	ok, err = bcryptHasher.Verify(argon2idHash, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, ok, "Hashes of other algorithm should still be verified")
+	assert.True(t, bcryptHasher.NeedsRehash(argon2idHash))
+
+	stronger := security.NewArgon2idHasher(security.Argon2idParams{Memory: 128, Iterations: 2, Parallelism: 1})
+	assert.True(t, stronger.NeedsRehash(argon2idHash), "Hash with other parameters should be rehashed")
+	ok, err = stronger.Verify(argon2idHash, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, ok, "Parameters of the hash should be used for verification")
+
+	assert.True(t, security.NewBcryptHasher(bcrypt.MinCost+1).NeedsRehash(bcryptHash))
+}
+
+func TestPasswordHashers_InvalidHash(t *testing.T) {
+	hasher := security.NewArgon2idHasher(testArgon2idParams)
+
+	_, err := hasher.Verify("", "correct horse")
+	assert.ErrorIs(t, err, security.ErrUnsupportedHash)
+	_, err = hasher.Verify("$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", "correct horse")
+	assert.ErrorIs(t, err, security.ErrUnsupportedHash)
+	_, err = hasher.Verify("$argon2id$v=19$m=64,t=1$c2FsdA$aGFzaA", "correct horse")
+	assert.ErrorIs(t, err, security.ErrMalformedHash)
+	_, err = hasher.Verify("$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA", "correct horse")
+	assert.ErrorIs(t, err, security.ErrUnsupportedHash)
+	_, err = hasher.Verify("$2a$04$short", "correct horse")
+	assert.ErrorIs(t, err, security.ErrMalformedHash)
+
+	assert.True(t, hasher.NeedsRehash(""))
+}
@@ -0,0 +1,82 @@
+package security_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mixturka/vm-hub/pkg/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from RFC 6238 appendix B, truncated to 6 digits.
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := security.TOTPCode(secret, security.TOTPStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "Unexpected code at %d", tt.unix)
+	}
+}
+
+func TestValidateTOTP_Skew(t *testing.T) {
+	secret, err := security.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	step := security.TOTPStep(now)
+	previous, err := security.TOTPCode(secret, step-1)
+	require.NoError(t, err)
+
+	matched, ok := security.ValidateTOTP(secret, previous, now, 1)
+	assert.True(t, ok, "Code of previous step should be accepted within skew")
+	assert.Equal(t, step-1, matched)
+
+	_, ok = security.ValidateTOTP(secret, previous, now, 0)
+	assert.False(t, ok, "Code of previous step shouldn't be accepted without skew")
+
+	old, err := security.TOTPCode(secret, step-3)
+	require.NoError(t, err)
+	_, ok = security.ValidateTOTP(secret, old, now, 1)
+	assert.False(t, ok, "Code outside of skew shouldn't be accepted")
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(security.TOTPURI("vm-hub", "user@example.com", "SECRET"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/vm-hub:user@example.com", uri.Path)
+	assert.Equal(t, "SECRET", uri.Query().Get("secret"))
+	assert.Equal(t, "vm-hub", uri.Query().Get("issuer"))
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	encrypted, err := security.Encrypt(key, "secret")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "secret")
+
+	decrypted, err := security.Decrypt(key, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+
+	_, err = security.Decrypt([]byte("fedcba9876543210fedcba9876543210"), encrypted)
+	assert.Error(t, err, "Decryption with other key should fail")
+}